@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 成就：订阅投注和结算事件，每次事件之后用用户的投注历史重新计算一遍规则，
+// 新达成的成就写入 achievement 表。规则只在代码里定义，新增规则不需要改表
+
+type Achievement struct {
+	AchievementID string `json:"achievement_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Achieved      bool   `json:"achieved"`
+	AwardedAt     string `json:"awarded_at,omitempty"`
+}
+
+type AchievementUnlockedEvent struct {
+	UserID        int    `json:"user_id"`
+	AchievementID string `json:"achievement_id"`
+	Name          string `json:"name"`
+}
+
+// 计算成就用到的一条投注
+type achievementBet struct {
+	ScheduleID   int
+	ScheduleType ScheduleType
+	BettingMoney Money
+	BettingOdds  Odds
+	BetStatus    int
+}
+
+type achievementContext struct {
+	UserID          int
+	Bets            []achievementBet // 按比赛时间排序
+	GroupMatchCount int              // 小组赛一共有多少场
+}
+
+type achievementRule struct {
+	ID          string
+	Name        string
+	Description string
+	Check       func(ctx achievementContext) bool
+}
+
+var achievementRules = []achievementRule{
+	{"first_bet", "初出茅庐", "完成第一次投注", func(ctx achievementContext) bool {
+		return len(ctx.Bets) > 0
+	}},
+	{"first_win", "旗开得胜", "第一次猜中比赛结果", func(ctx achievementContext) bool {
+		return countWins(ctx) > 0
+	}},
+	{"ten_wins", "十全十美", "累计猜中 10 场比赛", func(ctx achievementContext) bool {
+		return countWins(ctx) >= 10
+	}},
+	{"five_win_streak", "五连胜", "连续猜中 5 场比赛", func(ctx achievementContext) bool {
+		return longestWinStreak(ctx) >= 5
+	}},
+	{"upset_pick", "慧眼识珠", "以高于 3.0 的赔率猜中冷门", func(ctx achievementContext) bool {
+		for _, bet := range ctx.Bets {
+			if bet.BetStatus == WinBet && bet.BettingOdds > 3*oddsUnit {
+				return true
+			}
+		}
+		return false
+	}},
+	{"all_group_matches", "全勤", "投注了每一场小组赛", func(ctx achievementContext) bool {
+		if ctx.GroupMatchCount == 0 {
+			return false
+		}
+		schedules := make(map[int]bool)
+		for _, bet := range ctx.Bets {
+			if bet.ScheduleType == GroupMatches {
+				schedules[bet.ScheduleID] = true
+			}
+		}
+		return len(schedules) == ctx.GroupMatchCount
+	}},
+}
+
+func countWins(ctx achievementContext) int {
+	wins := 0
+	for _, bet := range ctx.Bets {
+		if bet.BetStatus == WinBet {
+			wins++
+		}
+	}
+	return wins
+}
+
+// 只看已经结算的投注，退款的投注不打断连胜
+func longestWinStreak(ctx achievementContext) int {
+	streak, longest := 0, 0
+	for _, bet := range ctx.Bets {
+		switch bet.BetStatus {
+		case WinBet:
+			streak++
+			if streak > longest {
+				longest = streak
+			}
+		case LostBet:
+			streak = 0
+		}
+	}
+	return longest
+}
+
+func loadAchievementContext(userID int) (achievementContext, error) {
+	ctx := achievementContext{UserID: userID, Bets: []achievementBet{}}
+	err := db.QueryRow("SELECT COUNT(*) FROM schedule WHERE schedule_type = ?", GroupMatches).Scan(&ctx.GroupMatchCount)
+	if err != nil {
+		return ctx, err
+	}
+
+	rows, err := db.Query("SELECT b.schedule_id, s.schedule_type, b.betting_money, b.betting_odds, b.bet_status "+
+		"FROM bet b JOIN schedule s ON s.schedule_id = b.schedule_id WHERE b.user_id = ? "+
+		"ORDER BY s.schedule_time, s.schedule_id", userID)
+	if err != nil {
+		return ctx, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bet achievementBet
+		err := rows.Scan(&bet.ScheduleID, &bet.ScheduleType, &bet.BettingMoney, &bet.BettingOdds, &bet.BetStatus)
+		if err != nil {
+			return ctx, err
+		}
+		ctx.Bets = append(ctx.Bets, bet)
+	}
+	return ctx, rows.Err()
+}
+
+// awardedAchievements 返回用户已经获得的成就，achievement_id -> 获得时间
+func awardedAchievements(userID int) (map[string]string, error) {
+	rows, err := db.Query("SELECT achievement_id, awarded_at FROM achievement WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awarded := make(map[string]string)
+	for rows.Next() {
+		var id, awardedAt string
+		if err := rows.Scan(&id, &awardedAt); err != nil {
+			return nil, err
+		}
+		awarded[id] = formatAPITime(awardedAt)
+	}
+	return awarded, rows.Err()
+}
+
+// evaluateAchievements 计算用户新达成的成就并保存，重复计算不会重复发放
+func evaluateAchievements(userID int, now time.Time) error {
+	ctx, err := loadAchievementContext(userID)
+	if err != nil {
+		return err
+	}
+	awarded, err := awardedAchievements(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range achievementRules {
+		if _, ok := awarded[rule.ID]; ok || !rule.Check(ctx) {
+			continue
+		}
+		result, err := db.Exec("INSERT IGNORE INTO achievement(user_id, achievement_id, awarded_at) VALUES (?,?,?)",
+			userID, rule.ID, toDBTime(now))
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			bus.Publish(EventAchievementUnlocked, AchievementUnlockedEvent{userID, rule.ID, rule.Name})
+		}
+	}
+	return nil
+}
+
+func evaluateUsersAchievements(query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		if err := evaluateAchievements(userID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleAchievementEvent(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "handle achievement event %v panic: %v\n", event.ID, r)
+		}
+	}()
+
+	var err error
+	switch payload := event.Payload.(type) {
+	case BetPlacedEvent:
+		err = evaluateAchievements(payload.UserID, time.Now())
+	case ScheduleSettledEvent:
+		err = evaluateUsersAchievements("SELECT DISTINCT user_id FROM bet WHERE schedule_id = ?", payload.ScheduleID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "evaluate achievements for event %v failed, err: %v\n", event.ID, err)
+	}
+}
+
+// runAchievementWorker 启动时先为所有下过注的用户补算一次，之后按事件计算。
+// 补算可能很久，期间的事件在订阅的队列里排队，补算完之后再处理
+func runAchievementWorker() {
+	_, events := bus.SubscribeQueue()
+	if err := evaluateUsersAchievements("SELECT DISTINCT user_id FROM bet"); err != nil {
+		fmt.Fprintf(os.Stderr, "evaluate achievements failed, err: %v\n", err)
+	}
+	for event := range events {
+		handleAchievementEvent(event)
+	}
+}
+
+// userAchievements 返回所有成就以及用户是否已经获得，onlyAchieved 为 true 时只返回已经获得的
+func userAchievements(userID int, onlyAchieved bool) ([]Achievement, error) {
+	awarded, err := awardedAchievements(userID)
+	if err != nil {
+		return nil, err
+	}
+	achievements := make([]Achievement, 0, len(achievementRules))
+	for _, rule := range achievementRules {
+		awardedAt, ok := awarded[rule.ID]
+		if onlyAchieved && !ok {
+			continue
+		}
+		achievements = append(achievements, Achievement{
+			AchievementID: rule.ID,
+			Name:          rule.Name,
+			Description:   rule.Description,
+			Achieved:      ok,
+			AwardedAt:     awardedAt,
+		})
+	}
+	return achievements, nil
+}
+
+func handleAchievements(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	achievements, err := userAchievements(userID, false)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query achievements failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"achievements": achievements,
+	})
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// 管理员手动调整用户余额，代替直接改 user.money。
+// 调整和其他余额变动一样走账本，/my、排行榜和 /transactions 都能看到；
+// 原因、备注和操作人另外记在 balance_adjustment 表里。
+// 请求要带上客户端生成的 request_id，网络出错重试时同一个 request_id 返回第一次的结果，不会重复调整
+
+const (
+	maxAdjustNoteLength      = 512
+	maxAdjustRequestIDLength = 64
+)
+
+// 每种原因在账本中对应的记账原因：修正结算算作输赢，其他都算系统发放，不影响净盈利
+var adjustLedgerReasons = map[AdjustReason]LedgerReason{
+	types.AdjustSettlementFix: LedgerAdminCorrection,
+	types.AdjustCompensation:  LedgerAdminGrant,
+	types.AdjustPrize:         LedgerAdminGrant,
+	types.AdjustPenalty:       LedgerAdminGrant,
+	types.AdjustOther:         LedgerAdminGrant,
+}
+
+var (
+	errAdjustRefNotExist   = errors.New("referenced schedule or bet does not exist")
+	errBalanceNegative     = errors.New("balance would become negative")
+	errAdjustRequestReused = errors.New("request_id was already used for a different adjustment")
+)
+
+type BalanceAdjustment struct {
+	AdjustmentID int64        `json:"adjustment_id"`
+	RequestID    string       `json:"request_id,omitempty"`
+	EntryID      int64        `json:"entry_id"`
+	UserID       int          `json:"user_id"`
+	Amount       Money        `json:"amount"`
+	Balance      Money        `json:"balance"` // 调整之后的余额
+	Reason       AdjustReason `json:"reason"`
+	Note         string       `json:"note"`
+	RefType      string       `json:"ref_type,omitempty"`
+	RefID        int          `json:"ref_id,omitempty"`
+	Operator     string       `json:"operator"` // 和审计日志的 actor_name 一样来自 X-Admin-Operator 头，没有验证过
+	CreatedAt    string       `json:"created_at"`
+}
+
+// validateAdjustment 检查请求本身，返回不合法的原因
+func validateAdjustment(req AdjustBalanceReq) string {
+	if req.RequestID == "" || len(req.RequestID) > maxAdjustRequestIDLength {
+		return "request_id is required and at most 64 bytes"
+	}
+	if req.UserID <= 0 {
+		return "missing user_id"
+	}
+	if req.Amount == 0 {
+		return "amount must not be zero"
+	}
+	if _, ok := adjustLedgerReasons[req.Reason]; !ok {
+		return fmt.Sprintf("unknown reason %q", req.Reason)
+	}
+	// 补偿和奖品只能加币，违规扣除只能扣币
+	switch {
+	case (req.Reason == types.AdjustCompensation || req.Reason == types.AdjustPrize) && req.Amount < 0:
+		return fmt.Sprintf("amount must be positive when reason is %v", req.Reason)
+	case req.Reason == types.AdjustPenalty && req.Amount > 0:
+		return fmt.Sprintf("amount must be negative when reason is %v", req.Reason)
+	}
+	if req.Reason == types.AdjustOther && req.Note == "" {
+		return "note is required when reason is other"
+	}
+	if len(req.Note) > maxAdjustNoteLength {
+		return "note is too long"
+	}
+	switch req.RefType {
+	case RefNone:
+		if req.RefID != 0 {
+			return "ref_id without ref_type"
+		}
+	case types.AdjustRefSchedule, types.AdjustRefFuturesBet:
+		if req.RefID <= 0 {
+			return "missing ref_id"
+		}
+	default:
+		return fmt.Sprintf("unknown ref_type %q", req.RefType)
+	}
+	return ""
+}
+
+// adjustRefExists 检查关联的比赛或者长线竞猜投注存在，长线投注必须是这个用户的
+func adjustRefExists(tx *sql.Tx, req AdjustBalanceReq) (bool, error) {
+	var count int
+	var err error
+	switch req.RefType {
+	case RefNone:
+		return true, nil
+	case types.AdjustRefSchedule:
+		err = tx.QueryRow("SELECT COUNT(*) FROM schedule WHERE schedule_id = ?", req.RefID).Scan(&count)
+	case types.AdjustRefFuturesBet:
+		err = tx.QueryRow("SELECT COUNT(*) FROM futures_bet WHERE bet_id = ? and user_id = ?",
+			req.RefID, req.UserID).Scan(&count)
+	}
+	return count > 0, err
+}
+
+// findAdjustment 按 request_id 找已经完成的调整，没有时返回 sql.ErrNoRows
+func findAdjustment(q queryer, requestID string) (BalanceAdjustment, error) {
+	var a BalanceAdjustment
+	err := q.QueryRow("SELECT a.adjustment_id, a.request_id, a.entry_id, a.user_id, a.amount, l.balance, a.reason, a.note, "+
+		"a.ref_type, a.ref_id, a.operator, a.created_at FROM balance_adjustment a JOIN ledger l ON l.entry_id = a.entry_id "+
+		"WHERE a.request_id = ?", requestID).
+		Scan(&a.AdjustmentID, &a.RequestID, &a.EntryID, &a.UserID, &a.Amount, &a.Balance, &a.Reason, &a.Note,
+			&a.RefType, &a.RefID, &a.Operator, &a.CreatedAt)
+	a.CreatedAt = formatAPITime(a.CreatedAt)
+	return a, err
+}
+
+// previousAdjustment 返回 request_id 第一次的调整记录，参数和这次请求不一致时报错
+func previousAdjustment(q queryer, req AdjustBalanceReq) (BalanceAdjustment, error) {
+	previous, err := findAdjustment(q, req.RequestID)
+	if err != nil {
+		return previous, err
+	}
+	if previous.UserID != req.UserID || previous.Amount != req.Amount || previous.Reason != req.Reason ||
+		previous.RefType != req.RefType || previous.RefID != req.RefID {
+		return previous, errAdjustRequestReused
+	}
+	return previous, nil
+}
+
+// retryableAdjustError 判断是不是同一个 request_id 同时提交造成的错误：后提交的一方撞上唯一键，或者两边互相等锁死锁
+func retryableAdjustError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && (mysqlErr.Number == 1062 || mysqlErr.Number == 1213)
+}
+
+// adjustBalance 在一个事务里记账并写调整记录，扣币之后余额不能为负。operator 是 adminOperator 自报的操作人。
+// request_id 已经用过时不再调整，返回第一次的调整记录，第二个返回值为 false
+func adjustBalance(req AdjustBalanceReq, operator string, now time.Time) (BalanceAdjustment, bool, error) {
+	adj, created, err := tryAdjustBalance(req, operator, now)
+	if err != nil && retryableAdjustError(err) {
+		// 同时提交的另一个请求已经写入，事务回滚之后按第一次的结果返回
+		previous, findErr := previousAdjustment(db, req)
+		if findErr == sql.ErrNoRows {
+			// 死锁时对方也可能回滚了，这时重新调整一次
+			return tryAdjustBalance(req, operator, now)
+		}
+		return previous, false, findErr
+	}
+	return adj, created, err
+}
+
+func tryAdjustBalance(req AdjustBalanceReq, operator string, now time.Time) (BalanceAdjustment, bool, error) {
+	adj := BalanceAdjustment{
+		RequestID: req.RequestID,
+		UserID:    req.UserID,
+		Amount:    req.Amount,
+		Reason:    req.Reason,
+		Note:      req.Note,
+		RefType:   req.RefType,
+		RefID:     req.RefID,
+		Operator:  operator,
+		CreatedAt: now.In(serverLocation).Format(time.RFC3339),
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return adj, false, err
+	}
+	defer tx.Rollback()
+
+	// 不加锁读：request_id 还没有用过时加锁会锁住间隙，同时提交的两个请求会死锁
+	previous, err := previousAdjustment(tx, req)
+	if err == nil {
+		return previous, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return adj, false, err
+	}
+
+	exists, err := adjustRefExists(tx, req)
+	if err != nil {
+		return adj, false, err
+	}
+	if !exists {
+		return adj, false, errAdjustRefNotExist
+	}
+
+	adj.Balance, err = postLedger(tx, req.UserID, req.Amount, adjustLedgerReasons[req.Reason], req.RefType, req.RefID)
+	if err != nil {
+		return adj, false, err
+	}
+	if adj.Balance < 0 {
+		return adj, false, errBalanceNegative
+	}
+	if err := tx.QueryRow("SELECT LAST_INSERT_ID()").Scan(&adj.EntryID); err != nil {
+		return adj, false, err
+	}
+
+	// 同一个 request_id 同时提交时，唯一键保证只有一个能写入，另一个在 adjustBalance 里重新读取
+	result, err := tx.Exec("INSERT INTO balance_adjustment(request_id, entry_id, user_id, amount, reason, note, ref_type, "+
+		"ref_id, operator, created_at) VALUES (?,?,?,?,?,?,?,?,?,?)", adj.RequestID, adj.EntryID, adj.UserID, adj.Amount,
+		adj.Reason, adj.Note, adj.RefType, adj.RefID, adj.Operator, toDBTime(now))
+	if err != nil {
+		return adj, false, err
+	}
+	if adj.AdjustmentID, err = result.LastInsertId(); err != nil {
+		return adj, false, err
+	}
+	return adj, true, tx.Commit()
+}
+
+func handleAdjustBalance(c *gin.Context) {
+	var req AdjustBalanceReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	req.RequestID = strings.TrimSpace(req.RequestID)
+	req.Note = strings.TrimSpace(req.Note)
+	if reason := validateAdjustment(req); reason != "" {
+		invalidAdjustmentRsp(c, reason)
+		return
+	}
+
+	adj, created, err := adjustBalance(req, adminOperator(c), time.Now())
+	switch err {
+	case nil:
+	case errUserNotExist:
+		userNotExist(c)
+		return
+	case errBalanceNegative:
+		notEnoughMoney(c)
+		return
+	case errAdjustRefNotExist, errAdjustRequestReused:
+		invalidAdjustmentRsp(c, err.Error())
+		return
+	default:
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "adjust balance of user %v failed, err: %v\n", req.UserID, err)
+		return
+	}
+	if !created {
+		// 重试的请求，第一次已经记过审计日志、刷新过排行榜
+		c.JSON(http.StatusOK, gin.H{
+			"status":     0,
+			"desc":       "OK",
+			"adjustment": adj,
+		})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "adjust balance of user %v by %v (%v) by %q: %v\n",
+		adj.UserID, adj.Amount, adj.Reason, adj.Operator, adj.Note)
+	var scheduleID int
+	if adj.RefType == types.AdjustRefSchedule {
+		scheduleID = adj.RefID
+	}
+	recordAudit(c, auditRecord{
+		Action:     "adjust_balance",
+		TargetType: "user",
+		TargetID:   adj.UserID,
+		UserID:     adj.UserID,
+		ScheduleID: scheduleID,
+		Before:     gin.H{"money": adj.Balance - adj.Amount},
+		After:      adj,
+	})
+	if err := refreshLeaderboard(); err != nil {
+		fmt.Fprintf(os.Stderr, "refresh leaderboard after adjust balance failed, err: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"adjustment": adj,
+	})
+}
+
+// balanceAdjustments 按时间倒序列出调整记录，userID 为 0 时列出所有用户的
+func balanceAdjustments(userID, limit int) ([]BalanceAdjustment, error) {
+	query := "SELECT a.adjustment_id, COALESCE(a.request_id, ''), a.entry_id, a.user_id, a.amount, l.balance, a.reason, " +
+		"a.note, a.ref_type, a.ref_id, a.operator, a.created_at FROM balance_adjustment a JOIN ledger l ON l.entry_id = a.entry_id"
+	args := []interface{}{}
+	if userID != 0 {
+		query += " WHERE a.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY a.adjustment_id DESC LIMIT ?"
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := []BalanceAdjustment{}
+	for rows.Next() {
+		var a BalanceAdjustment
+		err := rows.Scan(&a.AdjustmentID, &a.RequestID, &a.EntryID, &a.UserID, &a.Amount, &a.Balance, &a.Reason, &a.Note,
+			&a.RefType, &a.RefID, &a.Operator, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		a.CreatedAt = formatAPITime(a.CreatedAt)
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
+
+func handleAdjustments(c *gin.Context) {
+	var (
+		userID int
+		limit  = 50
+		err    error
+	)
+	if s := c.Query("user_id"); s != "" {
+		if userID, err = strconv.Atoi(s); err != nil {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 500 {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+
+	adjustments, err := balanceAdjustments(userID, limit)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query balance adjustments failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"adjustments": adjustments,
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestValidateAdjustment(t *testing.T) {
+	valid := AdjustBalanceReq{RequestID: "r1", UserID: 12, Amount: 15000, Reason: types.AdjustSettlementFix}
+	with := func(change func(*AdjustBalanceReq)) AdjustBalanceReq {
+		req := valid
+		change(&req)
+		return req
+	}
+	tests := []struct {
+		name string
+		req  AdjustBalanceReq
+		ok   bool
+	}{
+		{"valid", valid, true},
+		{"missing request id", with(func(r *AdjustBalanceReq) { r.RequestID = "" }), false},
+		{"long request id", with(func(r *AdjustBalanceReq) { r.RequestID = strings.Repeat("x", 65) }), false},
+		{"missing user", with(func(r *AdjustBalanceReq) { r.UserID = 0 }), false},
+		{"zero amount", with(func(r *AdjustBalanceReq) { r.Amount = 0 }), false},
+		{"unknown reason", with(func(r *AdjustBalanceReq) { r.Reason = "gift" }), false},
+		{"settlement fix debit", with(func(r *AdjustBalanceReq) { r.Amount = -500 }), true},
+		{"compensation credit", with(func(r *AdjustBalanceReq) { r.Reason = types.AdjustCompensation }), true},
+		{"compensation debit", with(func(r *AdjustBalanceReq) { r.Reason, r.Amount = types.AdjustCompensation, -500 }), false},
+		{"prize credit", with(func(r *AdjustBalanceReq) { r.Reason = types.AdjustPrize }), true},
+		{"prize debit", with(func(r *AdjustBalanceReq) { r.Reason, r.Amount = types.AdjustPrize, -500 }), false},
+		{"penalty debit", with(func(r *AdjustBalanceReq) { r.Reason, r.Amount = types.AdjustPenalty, -500 }), true},
+		{"penalty credit", with(func(r *AdjustBalanceReq) { r.Reason = types.AdjustPenalty }), false},
+		{"other without note", with(func(r *AdjustBalanceReq) { r.Reason = types.AdjustOther }), false},
+		{"other with note", with(func(r *AdjustBalanceReq) { r.Reason, r.Note = types.AdjustOther, "bug bounty" }), true},
+		{"ref id without type", with(func(r *AdjustBalanceReq) { r.RefID = 3 }), false},
+		{"schedule ref", with(func(r *AdjustBalanceReq) { r.RefType, r.RefID = types.AdjustRefSchedule, 3 }), true},
+		{"schedule ref without id", with(func(r *AdjustBalanceReq) { r.RefType = types.AdjustRefSchedule }), false},
+		{"unknown ref type", with(func(r *AdjustBalanceReq) { r.RefType, r.RefID = "bet", 3 }), false},
+	}
+	for _, tt := range tests {
+		if reason := validateAdjustment(tt.req); (reason == "") != tt.ok {
+			t.Errorf("%v: validateAdjustment = %q, want ok %v", tt.name, reason, tt.ok)
+		}
+	}
+}
+
+func TestRetryableAdjustError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'r1' for key 'request_id'"}, true},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, false},
+		{errBalanceNegative, false},
+		{sql.ErrNoRows, false},
+	}
+	for _, tt := range tests {
+		if got := retryableAdjustError(tt.err); got != tt.want {
+			t.Errorf("retryableAdjustError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
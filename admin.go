@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/gin-gonic/gin"
+)
+
+// 管理接口需要在 X-Admin-Token 头（或者 Authorization: Bearer）里带上 admin_token，
+// 网页表单没法设置请求头，也可以放在 admin_token 表单字段里。
+// admin_token 为空时拒绝所有管理请求，不会在没有配置的情况下把管理接口暴露出去
+
+func adminToken(c *gin.Context) string {
+	if token := c.GetHeader(types.AdminTokenHeader); token != "" {
+		return token
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return c.PostForm("admin_token")
+}
+
+func AdminAuthMiddleware() gin.HandlerFunc {
+	if config.AdminToken == "" {
+		fmt.Fprintf(os.Stderr, "admin_token is not set, all admin requests will be rejected\n")
+	}
+	return func(c *gin.Context) {
+		if config.AdminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(adminToken(c)), []byte(config.AdminToken)) != 1 {
+			invalidAdminTokenRsp(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleVoidSchedule 取消一场比赛，已经投注的金币全部退还
+func handleVoidSchedule(c *gin.Context) {
+	var req VoidScheduleReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schedule WHERE schedule_id = ?", req.ScheduleID).Scan(&exists); err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query schedule failed, err: %v\n", err)
+		return
+	}
+	if exists == 0 {
+		scheduleNotExistRsp(c)
+		return
+	}
+
+	refunded, err := voidSchedule(req.ScheduleID)
+	if err == errScheduleFinished {
+		scheduleFinishedRsp(c)
+		return
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "void schedule %v failed, err: %v\n", req.ScheduleID, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "void schedule %v, refunded %v bets\n", req.ScheduleID, refunded)
+	recordAudit(c, auditRecord{
+		Action:     "void_schedule",
+		TargetType: RefSchedule,
+		TargetID:   req.ScheduleID,
+		ScheduleID: req.ScheduleID,
+		Before:     gin.H{"schedule_status": NotStarted},
+		After:      gin.H{"schedule_status": Voided, "refunded_bets": refunded},
+	})
+	bus.Publish(EventScheduleVoided, ScheduleVoidedEvent{req.ScheduleID, refunded})
+	if err := refreshLeaderboard(); err != nil {
+		fmt.Fprintf(os.Stderr, "refresh leaderboard after void schedule %v failed, err: %v\n", req.ScheduleID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":        0,
+		"desc":          "OK",
+		"refunded_bets": refunded,
+	})
+}
+
+// handleTakeSnapshot 手动保存一个排行榜快照，比如在冻结排行榜之前
+func handleTakeSnapshot(c *gin.Context) {
+	snapshotID, err := snapshotLeaderboard(0)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "take leaderboard snapshot failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"snapshot_id": snapshotID,
+	})
+}
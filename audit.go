@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志：登录、投注、结算、奖励、重置密码和所有管理操作都记在 audit_log 表里，只追加不修改。
+// 管理接口里没有单独记录的写操作由 AuditAdminMiddleware 统一记一条，内容是请求参数
+
+const (
+	AuditActorUser   = "user"
+	AuditActorAdmin  = "admin"
+	AuditActorSystem = "system" // 结算等由服务端自己完成的操作
+
+	auditAdminKey    = "audit_admin"    // 请求经过了管理接口的鉴权
+	auditRecordedKey = "audit_recorded" // 处理函数已经记过审计日志
+
+	maxAuditBodySize  = 4096
+	maxAuditActorName = 64
+)
+
+// 请求参数里这些字段不写进审计日志
+var auditRedactedFields = []string{"password", "secret", "token", "admin_token"}
+
+type AuditEntry struct {
+	AuditID    int64           `json:"audit_id"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    int             `json:"actor_id,omitempty"`   // 用户操作时是用户 ID
+	ActorName  string          `json:"actor_name,omitempty"` // 管理操作时是 X-Admin-Operator 头自报的操作人，没有验证过
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   int             `json:"target_id,omitempty"`
+	UserID     int             `json:"user_id,omitempty"`     // 涉及的用户
+	ScheduleID int             `json:"schedule_id,omitempty"` // 涉及的比赛
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+// auditRecord 是调用方要记录的内容，Before 和 After 会序列化成 JSON
+type auditRecord struct {
+	Action     string
+	TargetType string
+	TargetID   int
+	UserID     int
+	ScheduleID int
+	Before     interface{}
+	After      interface{}
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func auditJSON(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func writeAudit(ex execer, actorType string, actorID int, actorName, ip string, r auditRecord, now time.Time) error {
+	before, err := auditJSON(r.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(r.After)
+	if err != nil {
+		return err
+	}
+	if len(actorName) > maxAuditActorName {
+		actorName = truncateUTF8(actorName, maxAuditActorName)
+	}
+	_, err = ex.Exec("INSERT INTO audit_log(actor_type, actor_id, actor_name, action, target_type, target_id, "+
+		"user_id, schedule_id, before_value, after_value, ip, created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)",
+		actorType, actorID, actorName, r.Action, r.TargetType, r.TargetID, r.UserID, r.ScheduleID,
+		before, after, ip, toDBTime(now))
+	return err
+}
+
+// adminOperator 返回管理请求自报的操作人。所有管理员共用 admin_token，服务端没法验证这个名字，
+// 只能作为参考；审计日志和调整记录都从这里取，不接受请求参数里另外填的操作人
+func adminOperator(c *gin.Context) string {
+	name := strings.TrimSpace(c.GetHeader(types.AdminOperatorHeader))
+	if len(name) > maxAuditActorName {
+		name = truncateUTF8(name, maxAuditActorName)
+	}
+	return name
+}
+
+// recordAudit 记录一次请求里的操作，管理接口记为管理员，其他记为 r.UserID 这个用户。
+// 写失败只打日志，不影响已经完成的操作
+func recordAudit(c *gin.Context, r auditRecord) {
+	actorType, actorID, actorName := AuditActorUser, r.UserID, ""
+	if c.GetBool(auditAdminKey) {
+		actorType, actorID, actorName = AuditActorAdmin, 0, adminOperator(c)
+	}
+	c.Set(auditRecordedKey, true)
+	if err := writeAudit(db, actorType, actorID, actorName, c.ClientIP(), r, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "record audit %v failed, err: %v\n", r.Action, err)
+	}
+}
+
+// recordSystemAudit 在结算等事务里记录，和事务一起提交或回滚
+func recordSystemAudit(ex execer, r auditRecord) error {
+	return writeAudit(ex, AuditActorSystem, 0, "", "", r, time.Now())
+}
+
+// auditRedacted 判断字段是否要去掉，new_password、results_token 这样的字段名也算
+func auditRedacted(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range auditRedactedFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditValue 逐层去掉 JSON 里要保密的字段
+func redactAuditValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if auditRedacted(key) {
+				v[key] = "***"
+			} else {
+				v[key] = redactAuditValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactAuditValue(value)
+		}
+	}
+	return v
+}
+
+// auditRequestBody 读出请求体给审计日志用，再放回去给处理函数。
+// JSON 和表单先去掉密码之类的字段再记录，去掉之后还太长的截断；
+// 上传文件和其他格式没法可靠地去掉保密字段，只记内容类型和长度
+func auditRequestBody(c *gin.Context) interface{} {
+	if c.Request.Body == nil {
+		return nil
+	}
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		// 上传的文件可能很大，不读出来
+		return gin.H{"content_type": c.ContentType(), "size": c.Request.ContentLength}
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+
+	var fields interface{}
+	switch {
+	case c.ContentType() == gin.MIMEPOSTForm:
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			break
+		}
+		fields = redactAuditForm(form)
+	case json.Unmarshal(body, &fields) == nil:
+		fields = redactAuditValue(fields)
+	default:
+		fields = nil
+	}
+	if fields == nil {
+		return gin.H{"content_type": c.ContentType(), "size": len(body)}
+	}
+	if b, err := json.Marshal(fields); err == nil && len(b) > maxAuditBodySize {
+		return truncateUTF8(string(b), maxAuditBodySize) + "..."
+	}
+	return fields
+}
+
+// redactAuditForm 去掉表单和查询参数里的密码、token
+func redactAuditForm(form url.Values) url.Values {
+	for key := range form {
+		if auditRedacted(key) {
+			form[key] = []string{"***"}
+		}
+	}
+	return form
+}
+
+// AuditAdminMiddleware 放在管理接口的鉴权之后，成功的写操作如果处理函数没有自己记录，就记下请求参数
+func AuditAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auditAdminKey, true)
+		if c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+		body := auditRequestBody(c)
+		c.Next()
+		if c.GetBool(auditRecordedKey) || c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		after := gin.H{}
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			after["query"] = redactAuditForm(query)
+		}
+		if body != nil {
+			after["body"] = body
+		}
+		recordAudit(c, auditRecord{Action: strings.TrimPrefix(c.Request.URL.Path, "/"), After: after})
+	}
+}
+
+type auditFilter struct {
+	UserID     int
+	ScheduleID int
+	Action     string
+	BeforeID   int64 // 翻页：只返回比这个 ID 更早的记录
+	Limit      int
+}
+
+func auditEntries(f auditFilter) ([]AuditEntry, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.UserID != 0 {
+		// 用户自己做的操作和别人对这个用户做的操作都算
+		conds = append(conds, "(user_id = ? or (actor_type = ? and actor_id = ?))")
+		args = append(args, f.UserID, AuditActorUser, f.UserID)
+	}
+	if f.ScheduleID != 0 {
+		conds = append(conds, "schedule_id = ?")
+		args = append(args, f.ScheduleID)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.BeforeID != 0 {
+		conds = append(conds, "audit_id < ?")
+		args = append(args, f.BeforeID)
+	}
+	query := "SELECT audit_id, actor_type, actor_id, actor_name, action, target_type, target_id, user_id, schedule_id, " +
+		"before_value, after_value, ip, created_at FROM audit_log"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " and ")
+	}
+	query += " ORDER BY audit_id DESC LIMIT ?"
+	rows, err := db.Query(query, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var (
+			e             AuditEntry
+			before, after string
+		)
+		err := rows.Scan(&e.AuditID, &e.ActorType, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID,
+			&e.UserID, &e.ScheduleID, &before, &after, &e.IP, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		e.CreatedAt = formatAPITime(e.CreatedAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func handleAuditLog(c *gin.Context) {
+	f := auditFilter{Action: c.Query("action"), Limit: 100}
+	var err error
+	for key, dst := range map[string]*int{"user_id": &f.UserID, "schedule_id": &f.ScheduleID, "limit": &f.Limit} {
+		if s := c.Query(key); s != "" {
+			if *dst, err = strconv.Atoi(s); err != nil {
+				illegalParametersRsp(c)
+				return
+			}
+		}
+	}
+	if s := c.Query("before_id"); s != "" {
+		if f.BeforeID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+	if f.Limit <= 0 || f.Limit > 1000 {
+		illegalParametersRsp(c)
+		return
+	}
+
+	entries, err := auditEntries(f)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query audit log failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"desc":    "OK",
+		"entries": entries,
+	})
+}
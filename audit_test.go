@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	long := `{"password":"hunter2","note":"` + strings.Repeat("x", maxAuditBodySize) + `"}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string // 记录的内容序列化之后的 JSON
+	}{
+		{"empty", "application/json", "", "null"},
+		{"json", "application/json", `{"user_id":3,"password":"hunter2"}`, `{"password":"***","user_id":3}`},
+		{"nested json", "application/json", `{"users":[{"en_name":"zhangsan","new_password":"x"}],"hook":{"secret":"s"}}`,
+			`{"hook":{"secret":"***"},"users":[{"en_name":"zhangsan","new_password":"***"}]}`},
+		{"form", gin.MIMEPOSTForm, "user_id=3&admin_token=abc&password=hunter2",
+			`{"admin_token":["***"],"password":["***"],"user_id":["3"]}`},
+		{"csv", "text/csv", "schedule_id,password\n1,hunter2\n", `{"content_type":"text/csv","size":31}`},
+		{"multipart", "multipart/form-data; boundary=x", "--x--", `{"content_type":"multipart/form-data","size":5}`},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/adjust_balance", strings.NewReader(tt.body))
+		c.Request.Header.Set("Content-Type", tt.contentType)
+
+		got, _ := json.Marshal(auditRequestBody(c))
+		if string(got) != tt.want {
+			t.Errorf("%v: auditRequestBody = %s, want %s", tt.name, got, tt.want)
+		}
+		if rest, _ := ioutil.ReadAll(c.Request.Body); string(rest) != tt.body {
+			t.Errorf("%v: body left for the handler = %q, want %q", tt.name, rest, tt.body)
+		}
+	}
+
+	// 太长的请求体先去掉密码再截断
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/adjust_balance", strings.NewReader(long))
+	c.Request.Header.Set("Content-Type", "application/json")
+	got, ok := auditRequestBody(c).(string)
+	if !ok || strings.Contains(got, "hunter2") || len(got) > maxAuditBodySize+len("...") {
+		t.Errorf("long body recorded as %.80q..., want redacted and truncated", got)
+	}
+}
+
+func TestRedactAuditForm(t *testing.T) {
+	query, _ := url.ParseQuery("schedule_id=3&admin_token=abc&Results_Token=t&user_id=1&user_id=2")
+	got := redactAuditForm(query)
+	want := url.Values{
+		"schedule_id":   {"3"},
+		"admin_token":   {"***"},
+		"Results_Token": {"***"},
+		"user_id":       {"1", "2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactAuditForm = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 日历订阅：/calendar.ics 以 iCalendar 格式返回赛程，日历客户端定时重新拉取。
+// 不带 user_id 时返回所有显示在投注页的比赛；带 user_id 时需要 token，
+// 每场比赛附上这个用户的投注，mine=true 时只返回投注过的比赛。
+// token 是用 calendar_secret 对 user_id 做的 HMAC，更换 calendar_secret 后所有订阅链接失效，
+// calendar_secret 为空时不提供个人日历。订阅链接由 POST /calendar_url 验证用户名和密码之后发放。
+// 比赛有改动（淘汰赛确定对阵、改时间、结算）时 updated_at 会变，客户端按 LAST-MODIFIED 和 SEQUENCE 更新
+
+const (
+	calendarTokenLen = 32
+	// 日历客户端重新拉取的间隔
+	calendarRefreshInterval = "PT1H"
+)
+
+var scheduleTypeNames = map[ScheduleType]string{
+	GroupMatches:       "小组赛",
+	RoundEight:         "八强赛",
+	FinalFour:          "四强赛",
+	Semifinal:          "半决赛",
+	MatchForThirdPlace: "季军赛",
+	Finals:             "总决赛",
+}
+
+func calendarToken(userID int) string {
+	mac := hmac.New(sha256.New, []byte(config.CalendarSecret))
+	mac.Write([]byte("calendar:" + strconv.Itoa(userID)))
+	return hex.EncodeToString(mac.Sum(nil))[:calendarTokenLen]
+}
+
+func validCalendarToken(userID int, token string) bool {
+	return config.CalendarSecret != "" && hmac.Equal([]byte(calendarToken(userID)), []byte(token))
+}
+
+func calendarURL(userID int, mine bool) string {
+	query := url.Values{}
+	query.Set("user_id", strconv.Itoa(userID))
+	query.Set("token", calendarToken(userID))
+	if mine {
+		query.Set("mine", "true")
+	}
+	return config.DomainName + "/calendar.ics?" + query.Encode()
+}
+
+// 日历里的一场比赛以及用户在这场比赛上的投注，没有投注时 bet 为 nil
+type calendarEntry struct {
+	schedule  Schedule
+	updatedAt time.Time
+	bet       *calendarBet
+}
+
+type calendarBet struct {
+	result   ScheduleStatus
+	stake    Money
+	odds     Odds
+	status   int64
+	winMoney Money
+}
+
+func calendarEntries(userID int, mine bool) ([]calendarEntry, error) {
+	columns := "s." + strings.Replace(scheduleColumns, ", ", ", s.", -1)
+	query := "SELECT " + columns + ", s.updated_at, " +
+		"b.betting_result, b.betting_money, b.betting_odds, b.bet_status, b.win_money FROM schedule s " +
+		"LEFT JOIN bet b ON b.schedule_id = s.schedule_id and b.user_id = ? WHERE s.enable_display = 1 "
+	if mine {
+		query += "and b.user_id IS NOT NULL "
+	}
+	rows, err := db.Query(query+"ORDER BY s.schedule_time, s.schedule_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []calendarEntry
+	for rows.Next() {
+		var (
+			e         calendarEntry
+			s         = &e.schedule
+			updatedAt string
+			result    sql.NullInt64
+			status    sql.NullInt64
+			bet       calendarBet
+		)
+		err := rows.Scan(&s.ScheduleID, &s.HomeTeam, &s.AwayTeam,
+			&s.HomeTeamWinOdds, &s.AwayTeamWinOdds, &s.TiedOdds,
+			&s.ScheduleTime, &s.ScheduleGroup, &s.ScheduleType,
+			&s.ScheduleStatus, &s.DisableBetting, &s.EnableDisplay, &s.BettingMode,
+			&s.HomeScore, &s.AwayScore, &updatedAt,
+			&result, &bet.stake, &bet.odds, &status, &bet.winMoney)
+		if err != nil {
+			return nil, err
+		}
+		if e.updatedAt, err = fromDBTime(updatedAt); err != nil {
+			return nil, err
+		}
+		if result.Valid {
+			bet.result, bet.status = ScheduleStatus(result.Int64), status.Int64
+			e.bet = &bet
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func outcomeName(s Schedule, result ScheduleStatus) string {
+	switch result {
+	case HomeTeamWin:
+		return s.HomeTeam + "胜"
+	case AwayTeamWin:
+		return s.AwayTeam + "胜"
+	case Draw:
+		return "平局"
+	case Voided:
+		return "比赛取消"
+	}
+	return ""
+}
+
+func calendarSummary(s Schedule) string {
+	summary := s.HomeTeam + " vs " + s.AwayTeam
+	if s.HomeScore != nil && s.AwayScore != nil {
+		summary = fmt.Sprintf("%s %d:%d %s", s.HomeTeam, *s.HomeScore, *s.AwayScore, s.AwayTeam)
+	}
+	return fmt.Sprintf("[%s] %s", stageName(s), summary)
+}
+
+// 小组赛显示组别，淘汰赛显示轮次
+func stageName(s Schedule) string {
+	if s.ScheduleType == GroupMatches {
+		return s.ScheduleGroup + "组"
+	}
+	return scheduleTypeNames[s.ScheduleType]
+}
+
+func calendarDescription(e calendarEntry) string {
+	s := e.schedule
+	var lines []string
+	if s.BettingMode == PoolBetting {
+		lines = append(lines, "奖池模式，赔率按开赛时的奖池计算")
+	} else {
+		lines = append(lines, fmt.Sprintf("赔率：%s %v / 平局 %v / %s %v",
+			outcomeName(s, HomeTeamWin), s.HomeTeamWinOdds, s.TiedOdds, outcomeName(s, AwayTeamWin), s.AwayTeamWinOdds))
+	}
+	if s.ScheduleStatus != NotStarted {
+		lines = append(lines, "赛果："+outcomeName(s, s.ScheduleStatus))
+	}
+	if b := e.bet; b != nil {
+		pick := fmt.Sprintf("我的投注：%s，%v 金币", outcomeName(s, b.result), b.stake)
+		if s.BettingMode == FixedOddsBetting {
+			pick += fmt.Sprintf("，赔率 %v", b.odds)
+		}
+		lines = append(lines, pick)
+		switch b.status {
+		case WinBet:
+			lines = append(lines, fmt.Sprintf("猜中了，赢得 %v 金币", b.winMoney))
+		case LostBet:
+			lines = append(lines, "没有猜中")
+		case RefundBet:
+			if s.ScheduleStatus == Voided {
+				lines = append(lines, "比赛取消，本金已退还")
+			} else {
+				lines = append(lines, "无人猜中，本金已退还")
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeCalendar(w *bytes.Buffer, name string, entries []calendarEntry, now time.Time) {
+	writeICSHeader(w, name)
+	writeICSLine(w, "REFRESH-INTERVAL;VALUE=DURATION", calendarRefreshInterval)
+	writeICSLine(w, "X-PUBLISHED-TTL", calendarRefreshInterval)
+	for _, e := range entries {
+		writeScheduleEvent(w, e.schedule, calendarSummary(e.schedule), now, func(w *bytes.Buffer) {
+			writeICSLine(w, "DESCRIPTION", icsEscape(calendarDescription(e)))
+			writeICSLine(w, "LAST-MODIFIED", icsTime(e.updatedAt))
+			// 每次改动 updated_at 都会变大，用它作为版本号
+			writeICSLine(w, "SEQUENCE", strconv.FormatInt(e.updatedAt.Unix(), 10))
+			writeICSLine(w, "CATEGORIES", icsEscape(stageName(e.schedule)))
+			if e.schedule.ScheduleStatus == Voided {
+				writeICSLine(w, "STATUS", "CANCELLED")
+			}
+		})
+	}
+	writeICSLine(w, "END", "VCALENDAR")
+}
+
+func handleCalendar(c *gin.Context) {
+	var (
+		userID int
+		err    error
+		mine   = c.Query("mine") == "true"
+		name   = "世界杯赛程"
+	)
+	if s := c.Query("user_id"); s != "" {
+		if userID, err = strconv.Atoi(s); err != nil {
+			illegalParametersRsp(c)
+			return
+		}
+		if !validCalendarToken(userID, c.Query("token")) {
+			invalidCalendarTokenRsp(c)
+			return
+		}
+		name = "世界杯赛程（我的投注）"
+	} else if mine {
+		illegalParametersRsp(c)
+		return
+	}
+
+	entries, err := calendarEntries(userID, mine)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query calendar of user %v failed, err: %v\n", userID, err)
+		return
+	}
+	var buf bytes.Buffer
+	writeCalendar(&buf, name, entries, time.Now())
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, fixtureContentTypes[FixtureICS], buf.Bytes())
+}
+
+// handleCalendarURL 验证中英文名和密码之后返回用户的日历订阅链接，链接里的 token 只发给用户本人
+func handleCalendarURL(c *gin.Context) {
+	var req AuthorizeRequest
+	if c.BindJSON(&req) != nil || config.CalendarSecret == "" {
+		illegalParametersRsp(c)
+		return
+	}
+	userID, err := checkUserCredential(req)
+	switch err {
+	case nil:
+	case errUserNotExist:
+		userNotExist(c)
+		return
+	case errIncorrectPassword:
+		incorrectPasswordRsp(c)
+		return
+	default:
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "check user credential failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"desc":     "OK",
+		"url":      calendarURL(userID, false),
+		"mine_url": calendarURL(userID, true),
+	})
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 一对一挑战：发起人选择一场比赛的结果和金额向同事发起挑战，
+// 对方接受即押注相反的一方（比赛结果不是发起人选的结果），双方本金都先扣下托管。
+// 比赛结算时赢家拿走双方的本金；开赛（截止投注）之前没有被接受的挑战自动过期并退款
+
+type ChallengeStatus string
+
+const (
+	ChallengePending   ChallengeStatus = "pending"   // 等待对方接受
+	ChallengeAccepted  ChallengeStatus = "accepted"  // 已接受，等待比赛结算
+	ChallengeDeclined  ChallengeStatus = "declined"  // 对方拒绝
+	ChallengeCancelled ChallengeStatus = "cancelled" // 发起人撤回
+	ChallengeExpired   ChallengeStatus = "expired"   // 截止投注前没有被接受
+	ChallengeSettled   ChallengeStatus = "settled"   // 已结算
+)
+
+type Challenge struct {
+	ChallengeID      int             `json:"challenge_id"`
+	ScheduleID       int             `json:"schedule_id"`
+	ChallengerID     int             `json:"challenger_id"`
+	OpponentID       int             `json:"opponent_id"`
+	ChallengerResult ScheduleStatus  `json:"challenger_result"` // 发起人押的结果，对方押其余两种结果
+	Stake            Money           `json:"stake"`             // 每一方的本金
+	Status           ChallengeStatus `json:"status"`
+	WinnerID         int             `json:"winner_id"`
+	CreatedAt        string          `json:"created_at"`
+}
+
+type ChallengeRequest struct {
+	UserID        int            `json:"user_id"`
+	OpponentID    int            `json:"opponent_id"`
+	ScheduleID    int            `json:"schedule_id"`
+	BettingResult ScheduleStatus `json:"betting_result"`
+	Stake         Money          `json:"stake"`
+}
+
+type ChallengeActionRequest struct {
+	UserID      int `json:"user_id"`
+	ChallengeID int `json:"challenge_id"`
+}
+
+const challengeColumns = "challenge_id, schedule_id, challenger_id, opponent_id, challenger_result, stake, status, winner_id, created_at"
+
+func scanChallenge(row interface {
+	Scan(dest ...interface{}) error
+}, ch *Challenge) error {
+	return row.Scan(&ch.ChallengeID, &ch.ScheduleID, &ch.ChallengerID, &ch.OpponentID, &ch.ChallengerResult,
+		&ch.Stake, &ch.Status, &ch.WinnerID, &ch.CreatedAt)
+}
+
+// 比赛是否还可以投注，截止时间的判断与 /bet 相同
+func scheduleOpen(q queryer, scheduleID int, now time.Time) (bool, error) {
+	var (
+		disableBetting bool
+		scheduleTime   string
+		status         ScheduleStatus
+	)
+	err := q.QueryRow("SELECT disable_betting, schedule_time, schedule_status FROM schedule WHERE schedule_id = ?",
+		scheduleID).Scan(&disableBetting, &scheduleTime, &status)
+	if err != nil {
+		return false, err
+	}
+	if disableBetting || status != NotStarted {
+		return false, nil
+	}
+	deadline, err := bettingDeadline(scheduleTime)
+	if err != nil {
+		return false, err
+	}
+	return now.Before(deadline), nil
+}
+
+// escrowStake 锁住用户并检查余额，够的话扣下本金托管
+func escrowStake(tx *sql.Tx, userID int, stake Money, challengeID int) (bool, error) {
+	var money Money
+	if err := tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", userID).Scan(&money); err != nil {
+		return false, err
+	}
+	if money < stake {
+		return false, nil
+	}
+	_, err := postLedger(tx, userID, -stake, LedgerChallengeEscrow, RefChallenge, challengeID)
+	return err == nil, err
+}
+
+// 退还托管的本金并把挑战置为终止状态，状态已经被别人改过的挑战不做处理，返回 false
+func closeChallenge(tx *sql.Tx, ch Challenge, status ChallengeStatus) (bool, error) {
+	result, err := tx.Exec("UPDATE challenge SET status = ?, closed_at = ? WHERE challenge_id = ? and status = ?",
+		status, toDBTime(time.Now()), ch.ChallengeID, ch.Status)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	if _, err := postLedger(tx, ch.ChallengerID, ch.Stake, LedgerChallengeRefund, RefChallenge, ch.ChallengeID); err != nil {
+		return false, err
+	}
+	if ch.Status == ChallengeAccepted {
+		_, err = postLedger(tx, ch.OpponentID, ch.Stake, LedgerChallengeRefund, RefChallenge, ch.ChallengeID)
+	}
+	return true, err
+}
+
+// closeChallengeBySystem 是结算、过期和取消比赛时由服务端关闭挑战，在同一个事务里记审计日志
+func closeChallengeBySystem(tx *sql.Tx, ch Challenge, status ChallengeStatus) error {
+	closed, err := closeChallenge(tx, ch, status)
+	if err != nil || !closed {
+		return err
+	}
+	return recordSystemAudit(tx, auditRecord{
+		Action:     "close_challenge",
+		TargetType: RefChallenge,
+		TargetID:   ch.ChallengeID,
+		UserID:     ch.ChallengerID,
+		ScheduleID: ch.ScheduleID,
+		Before:     map[string]interface{}{"status": ch.Status},
+		After:      map[string]interface{}{"status": status, "refund": ch.Stake, "opponent_id": ch.OpponentID},
+	})
+}
+
+func scheduleChallenges(tx *sql.Tx, scheduleID int, statuses ...ChallengeStatus) ([]Challenge, error) {
+	query := "SELECT " + challengeColumns + " FROM challenge WHERE schedule_id = ? and status IN ("
+	args := []interface{}{scheduleID}
+	for i, status := range statuses {
+		if i > 0 {
+			query += ","
+		}
+		query += "?"
+		args = append(args, status)
+	}
+	rows, err := tx.Query(query+") FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []Challenge{}
+	for rows.Next() {
+		var ch Challenge
+		if err := scanChallenge(rows, &ch); err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, ch)
+	}
+	return challenges, rows.Err()
+}
+
+// settleChallenges 在比赛结算的事务中结算这场比赛的挑战，还没被接受的直接过期退款
+func settleChallenges(tx *sql.Tx, scheduleID int, result ScheduleStatus) error {
+	challenges, err := scheduleChallenges(tx, scheduleID, ChallengePending, ChallengeAccepted)
+	if err != nil {
+		return err
+	}
+	for _, ch := range challenges {
+		if ch.Status == ChallengePending {
+			if err := closeChallengeBySystem(tx, ch, ChallengeExpired); err != nil {
+				return err
+			}
+			continue
+		}
+
+		winnerID := ch.OpponentID
+		if ch.ChallengerResult == result {
+			winnerID = ch.ChallengerID
+		}
+		result, err := tx.Exec("UPDATE challenge SET status = ?, winner_id = ?, closed_at = ? WHERE challenge_id = ? and status = ?",
+			ChallengeSettled, winnerID, toDBTime(time.Now()), ch.ChallengeID, ChallengeAccepted)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			continue
+		}
+		if _, err := postLedger(tx, winnerID, 2*ch.Stake, LedgerChallengePayout, RefChallenge, ch.ChallengeID); err != nil {
+			return err
+		}
+		err = recordSystemAudit(tx, auditRecord{
+			Action:     "settle_challenge",
+			TargetType: RefChallenge,
+			TargetID:   ch.ChallengeID,
+			UserID:     winnerID,
+			ScheduleID: scheduleID,
+			Before:     map[string]interface{}{"status": ChallengeAccepted},
+			After:      map[string]interface{}{"status": ChallengeSettled, "winner_id": winnerID, "payout": 2 * ch.Stake},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireDueChallenges 把已经截止投注但还没被接受的挑战过期并退款
+func expireDueChallenges(now time.Time) error {
+	rows, err := db.Query("SELECT DISTINCT schedule_id FROM challenge WHERE status = ?", ChallengePending)
+	if err != nil {
+		return err
+	}
+	var scheduleIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		scheduleIDs = append(scheduleIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, scheduleID := range scheduleIDs {
+		open, err := scheduleOpen(db, scheduleID, now)
+		if err != nil {
+			return err
+		}
+		if open {
+			continue
+		}
+		if err := expireScheduleChallenges(scheduleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expireScheduleChallenges(scheduleID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	challenges, err := scheduleChallenges(tx, scheduleID, ChallengePending)
+	if err != nil {
+		return err
+	}
+	for _, ch := range challenges {
+		if err := closeChallengeBySystem(tx, ch, ChallengeExpired); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if len(challenges) > 0 {
+		fmt.Fprintf(os.Stderr, "expire %v challenges of schedule %v\n", len(challenges), scheduleID)
+	}
+	return nil
+}
+
+func userChallenges(userID int) ([]Challenge, error) {
+	rows, err := db.Query("SELECT "+challengeColumns+" FROM challenge WHERE challenger_id = ? or opponent_id = ? "+
+		"ORDER BY challenge_id DESC", userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []Challenge{}
+	for rows.Next() {
+		var ch Challenge
+		if err := scanChallenge(rows, &ch); err != nil {
+			return nil, err
+		}
+		ch.CreatedAt = formatAPITime(ch.CreatedAt)
+		challenges = append(challenges, ch)
+	}
+	return challenges, rows.Err()
+}
+
+func handleChallenges(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	challenges, err := userChallenges(userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query challenges failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"challenges": challenges,
+	})
+}
+
+func handleCreateChallenge(c *gin.Context) {
+	var req ChallengeRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	if req.Stake <= 0 || req.UserID == req.OpponentID ||
+		req.BettingResult < HomeTeamWin || req.BettingResult > Draw {
+		illegalParametersRsp(c)
+		return
+	}
+
+	now := time.Now()
+	open, err := scheduleOpen(db, req.ScheduleID, now)
+	if err == sql.ErrNoRows {
+		scheduleNotExistRsp(c)
+		return
+	}
+	var opponents int
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*) FROM user WHERE user_id = ?", req.OpponentID).Scan(&opponents)
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query challenge schedule failed, err: %v\n", err)
+		return
+	}
+	if !open {
+		disableBet(c)
+		return
+	}
+	if opponents == 0 {
+		userNotExist(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO challenge(schedule_id, challenger_id, opponent_id, challenger_result, stake, "+
+		"status, winner_id, created_at) VALUES (?,?,?,?,?,?,0,?)", req.ScheduleID, req.UserID, req.OpponentID,
+		req.BettingResult, req.Stake, ChallengePending, toDBTime(now))
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "insert challenge failed, err: %v\n", err)
+		return
+	}
+	challengeID, err := result.LastInsertId()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "insert challenge failed, err: %v\n", err)
+		return
+	}
+	enough, err := escrowStake(tx, req.UserID, req.Stake, int(challengeID))
+	if err == sql.ErrNoRows {
+		userNotExist(c)
+		return
+	}
+	if err == nil && !enough {
+		notEnoughMoney(c)
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "create challenge failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{
+		Action:     "create_challenge",
+		TargetType: RefChallenge,
+		TargetID:   int(challengeID),
+		UserID:     req.UserID,
+		ScheduleID: req.ScheduleID,
+		After:      req,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"challenge_id": challengeID,
+	})
+}
+
+// loadChallengeForUpdate 在事务中锁住挑战，检查状态是 pending
+func loadChallengeForUpdate(c *gin.Context, tx *sql.Tx, challengeID int) (Challenge, bool) {
+	var ch Challenge
+	err := scanChallenge(tx.QueryRow("SELECT "+challengeColumns+" FROM challenge WHERE challenge_id = ? FOR UPDATE",
+		challengeID), &ch)
+	if err == sql.ErrNoRows {
+		challengeNotExistRsp(c)
+		return ch, false
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query challenge failed, err: %v\n", err)
+		return ch, false
+	}
+	if ch.Status != ChallengePending {
+		challengeNotPendingRsp(c)
+		return ch, false
+	}
+	return ch, true
+}
+
+func handleAcceptChallenge(c *gin.Context) {
+	var req ChallengeActionRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	ch, ok := loadChallengeForUpdate(c, tx, req.ChallengeID)
+	if !ok {
+		return
+	}
+	if ch.OpponentID != req.UserID {
+		challengeNotExistRsp(c)
+		return
+	}
+	open, err := scheduleOpen(tx, ch.ScheduleID, time.Now())
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query challenge schedule failed, err: %v\n", err)
+		return
+	}
+	if !open {
+		disableBet(c)
+		return
+	}
+
+	enough, err := escrowStake(tx, req.UserID, ch.Stake, ch.ChallengeID)
+	if err == nil && !enough {
+		notEnoughMoney(c)
+		return
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE challenge SET status = ?, accepted_at = ? WHERE challenge_id = ?",
+			ChallengeAccepted, toDBTime(time.Now()), ch.ChallengeID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "accept challenge failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{
+		Action:     "accept_challenge",
+		TargetType: RefChallenge,
+		TargetID:   ch.ChallengeID,
+		UserID:     req.UserID,
+		ScheduleID: ch.ScheduleID,
+		Before:     gin.H{"status": ch.Status},
+		After:      gin.H{"status": ChallengeAccepted, "stake": ch.Stake},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+	})
+}
+
+// 对方拒绝，或者发起人在对方接受之前撤回，都退还发起人的本金
+func handleDeclineChallenge(c *gin.Context) {
+	var req ChallengeActionRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	ch, ok := loadChallengeForUpdate(c, tx, req.ChallengeID)
+	if !ok {
+		return
+	}
+	var status ChallengeStatus
+	switch req.UserID {
+	case ch.OpponentID:
+		status = ChallengeDeclined
+	case ch.ChallengerID:
+		status = ChallengeCancelled
+	default:
+		challengeNotExistRsp(c)
+		return
+	}
+
+	_, err = closeChallenge(tx, ch, status)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "close challenge failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{
+		Action:     "close_challenge",
+		TargetType: RefChallenge,
+		TargetID:   ch.ChallengeID,
+		UserID:     req.UserID,
+		ScheduleID: ch.ScheduleID,
+		Before:     gin.H{"status": ch.Status},
+		After:      gin.H{"status": status},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":           0,
+		"desc":             "OK",
+		"challenge_status": status,
+	})
+}
@@ -124,3 +124,125 @@ func overSchedueTime(c *gin.Context) {
 		"desc":   "Over schedule time",
 	})
 }
+
+func rebuyNotAllowedRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 18,
+		"desc":   "Rebuy is not allowed",
+	})
+}
+
+func snapshotNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 19,
+		"desc":   "Leaderboard snapshot does not exist",
+	})
+}
+
+func groupNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 20,
+		"desc":   "Group does not exist",
+	})
+}
+
+func groupNameExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 21,
+		"desc":   "Group name already exists",
+	})
+}
+
+func challengeNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 22,
+		"desc":   "Challenge does not exist",
+	})
+}
+
+func challengeNotPendingRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 23,
+		"desc":   "Challenge is no longer pending",
+	})
+}
+
+func futuresNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 24,
+		"desc":   "Futures selection does not exist",
+	})
+}
+
+func webhookNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 25,
+		"desc":   "Webhook does not exist",
+	})
+}
+
+func webhookDeliveryNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 26,
+		"desc":   "Webhook delivery does not exist",
+	})
+}
+
+func pendingResultNotExistRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 27,
+		"desc":   "Pending result does not exist or has been decided",
+	})
+}
+
+func scheduleFinishedRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 28,
+		"desc":   "Schedule already has a result",
+	})
+}
+
+// 赛程导入的文件不合法，results 里是每一行的校验结果，解析失败时只有 error
+func fixturesInvalidRsp(c *gin.Context, results []FixtureResult, reason string) {
+	rsp := gin.H{
+		"status": 29,
+		"desc":   "Fixtures are invalid",
+	}
+	if results != nil {
+		rsp["results"] = results
+	}
+	if reason != "" {
+		rsp["error"] = reason
+	}
+	c.JSON(http.StatusBadRequest, rsp)
+}
+
+func invalidCalendarTokenRsp(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"status": 30,
+		"desc":   "Calendar token is invalid",
+	})
+}
+
+func invalidAdminTokenRsp(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"status": 31,
+		"desc":   "Admin token is invalid",
+	})
+}
+
+func invalidAdjustmentRsp(c *gin.Context, reason string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 32,
+		"desc":   "Balance adjustment is invalid",
+		"error":  reason,
+	})
+}
+
+// 用户的 webhook 只能是公网地址
+func webhookURLNotAllowedRsp(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status": 33,
+		"desc":   "Webhook url is not allowed",
+	})
+}
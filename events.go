@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 服务内部的事件类型
+const (
+	EventBettingClosed       = "betting_closed"       // 比赛停止投注
+	EventBetPlaced           = "bet_placed"           // 用户投注成功
+	EventScheduleSettled     = "schedule_settled"     // 比赛结算完成
+	EventAchievementUnlocked = "achievement_unlocked" // 用户获得新成就
+	EventOddsChanged         = "odds_changed"         // 赔率变化，奖池模式下每次投注都会变化
+	EventBalanceChanged      = "balance_changed"      // 用户余额变化
+	EventLeaderboardUpdated  = "leaderboard_updated"  // 排行榜名次有变化
+	EventScheduleCreated     = "schedule_created"     // 新建了比赛
+	EventLeaderboardSnapshot = "leaderboard_snapshot" // 结算之后保存了排行榜快照
+	EventScheduleVoided      = "schedule_voided"      // 比赛取消，投注已退还
+)
+
+// 事件总线保留最近的事件，客户端断线重连时按 Last-Event-ID 补发
+const eventHistorySize = 1024
+
+type BetPlacedEvent struct {
+	UserID        int            `json:"user_id"`
+	ScheduleID    int            `json:"schedule_id"`
+	BettingResult ScheduleStatus `json:"betting_result"`
+	BettingMoney  Money          `json:"betting_money"`
+}
+
+type ScheduleSettledEvent struct {
+	ScheduleID     int            `json:"schedule_id"`
+	ScheduleStatus ScheduleStatus `json:"schedule_status"`
+}
+
+type ScheduleVoidedEvent struct {
+	ScheduleID   int `json:"schedule_id"`
+	RefundedBets int `json:"refunded_bets"`
+}
+
+type OddsChangedEvent struct {
+	ScheduleID      int       `json:"schedule_id"`
+	HomeTeamWinOdds Odds      `json:"home_team_win_odds"`
+	AwayTeamWinOdds Odds      `json:"away_team_win_odds"`
+	TiedOdds        Odds      `json:"tied_odds"`
+	Pool            *PoolInfo `json:"pool,omitempty"`
+}
+
+type BalanceChangedEvent struct {
+	UserID  int          `json:"user_id"`
+	Amount  Money        `json:"amount"`
+	Balance Money        `json:"balance"`
+	Reason  LedgerReason `json:"reason"`
+	EntryID int64        `json:"entry_id"`
+}
+
+type LeaderboardUpdatedEvent struct {
+	Metrics   []RankMetric `json:"metrics"` // 名次有变化的指标
+	UpdatedAt string       `json:"updated_at"`
+}
+
+type ScheduleCreatedEvent struct {
+	ScheduleID   int          `json:"schedule_id"`
+	HomeTeam     int          `json:"home_team"`
+	AwayTeam     int          `json:"away_team"`
+	ScheduleTime string       `json:"schedule_time"`
+	ScheduleType ScheduleType `json:"schedule_type"`
+	BettingMode  BettingMode  `json:"betting_mode"`
+}
+
+type LeaderboardSnapshotEvent struct {
+	SnapshotID int                      `json:"snapshot_id"`
+	ScheduleID int                      `json:"schedule_id"`
+	CreatedAt  string                   `json:"created_at"`
+	Top        map[RankMetric][]RankRsp `json:"top"` // 每个指标的前 10 名
+}
+
+type Event struct {
+	ID      int64       `json:"id"`
+	Type    string      `json:"type"`
+	Time    string      `json:"time"`
+	Payload interface{} `json:"payload"`
+}
+
+// eventBus 是一个进程内的事件总线，handler 和后台任务往里发布事件，
+// 订阅者各自持有一个带缓冲的 channel。消费太慢、缓冲满了的订阅者会被取消订阅，channel 被关闭，
+// 不会阻塞发布者；/events 的客户端随后断线重连，按 Last-Event-ID 从历史里补发。
+// 服务内部的后台任务用 SubscribeQueue，事件在内存里排队，不会被丢掉。
+// 事件 ID 从启动时间（微秒）开始递增，服务重启之后新的 ID 仍然比之前的大
+type eventBus struct {
+	mu          sync.Mutex
+	lastEventID int64
+	nextSubID   int
+	subscribers map[int]*subscriber
+	history     []Event // 最近的事件，按 ID 递增
+}
+
+type subscriber struct {
+	ch chan Event
+	// 只有 SubscribeQueue 的订阅者有：事件先放进 pending，再由单独的协程送进 ch
+	pending []Event
+	wake    chan struct{}
+}
+
+var bus = newEventBus()
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		lastEventID: time.Now().UnixNano() / int64(time.Microsecond),
+		subscribers: make(map[int]*subscriber),
+	}
+}
+
+func (b *eventBus) Subscribe() (int, <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribe()
+}
+
+// SubscribeSince 订阅并返回 ID 大于 lastID 的历史事件，补发和订阅在同一把锁里完成，中间不会漏事件。
+// lastID 之后的事件已经不在历史里（或者 lastID 不是这个总线发出的）时 complete 为 false，
+// 调用方需要让客户端重新拉取完整状态
+func (b *eventBus) SubscribeSince(lastID int64) (id int, missed []Event, complete bool, ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id, ch = b.subscribe()
+	if lastID >= b.lastEventID {
+		return id, nil, lastID == b.lastEventID, ch
+	}
+	complete = len(b.history) > 0 && b.history[0].ID <= lastID+1
+	for _, event := range b.history {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+	return id, missed, complete, ch
+}
+
+// SubscribeQueue 订阅之后不会因为处理慢被取消，来不及处理的事件在内存里排队，给服务内部的后台任务用
+func (b *eventBus) SubscribeQueue() (int, <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextSubID++
+	sub := &subscriber{ch: make(chan Event), wake: make(chan struct{}, 1)}
+	b.subscribers[b.nextSubID] = sub
+	go b.pump(sub)
+	return b.nextSubID, sub.ch
+}
+
+// pump 把排队的事件按顺序送给订阅者，取消订阅之后送完已经排队的事件再关闭 channel
+func (b *eventBus) pump(sub *subscriber) {
+	defer close(sub.ch)
+	for range sub.wake {
+		b.mu.Lock()
+		events := sub.pending
+		sub.pending = nil
+		b.mu.Unlock()
+		for _, event := range events {
+			sub.ch <- event
+		}
+	}
+}
+
+func (b *eventBus) subscribe() (int, <-chan Event) {
+	b.nextSubID++
+	sub := &subscriber{ch: make(chan Event, 256)}
+	b.subscribers[b.nextSubID] = sub
+	return b.nextSubID, sub.ch
+}
+
+func (b *eventBus) Unsubscribe(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unsubscribe(id)
+}
+
+func (b *eventBus) unsubscribe(id int) {
+	sub, ok := b.subscribers[id]
+	if !ok {
+		return
+	}
+	delete(b.subscribers, id)
+	if sub.wake != nil {
+		close(sub.wake)
+	} else {
+		close(sub.ch)
+	}
+}
+
+func (b *eventBus) Publish(eventType string, payload interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastEventID++
+	event := Event{
+		ID:      b.lastEventID,
+		Type:    eventType,
+		Time:    time.Now().In(serverLocation).Format(time.RFC3339),
+		Payload: payload,
+	}
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+	for id, sub := range b.subscribers {
+		if sub.wake != nil {
+			sub.pending = append(sub.pending, event)
+			select {
+			case sub.wake <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// 不能只丢掉这一个事件，否则订阅者不知道漏了事件；取消订阅让它重新连接补发
+			fmt.Fprintf(os.Stderr, "event subscriber %v is too slow at event %v, unsubscribe it\n", id, event.ID)
+			b.unsubscribe(id)
+		}
+	}
+	return event
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 赛程批量导入导出，支持 CSV、JSON 和 iCalendar 三种格式。
+// 导入时先整体校验，有任何一行不合法就全部不写入；dry_run 只查询不写入，返回每一行会怎么处理。
+// 已有的比赛按 schedule_id 对应，没有 schedule_id 时按开赛时间、比赛类别和组别对应：
+// 小组赛还要求主客队相同；淘汰赛的对阵可能在导入之后才确定，同一时间只有一场时直接对应，
+// 有多场时按主客队区分，区分不了需要指定 schedule_id。
+// upsert 为 true 时更新已有的未开赛比赛，否则跳过
+
+type FixtureFormat string
+
+const (
+	FixtureCSV  FixtureFormat = "csv"
+	FixtureJSON FixtureFormat = "json"
+	FixtureICS  FixtureFormat = "ics"
+)
+
+type FixtureAction string
+
+const (
+	FixtureCreated   FixtureAction = "created"
+	FixtureUpdated   FixtureAction = "updated"
+	FixtureUnchanged FixtureAction = "unchanged"
+	FixtureSkipped   FixtureAction = "skipped" // 比赛已经存在且没有指定 upsert
+	FixtureInvalid   FixtureAction = "invalid"
+)
+
+// 每一行的处理结果，CSV 的行号包含表头，JSON 和 ICS 从 1 开始按顺序编号
+type FixtureResult struct {
+	Row        int           `json:"row"`
+	Action     FixtureAction `json:"action"`
+	ScheduleID int           `json:"schedule_id,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type fixtureRow struct {
+	row      int
+	schedule Schedule
+}
+
+const (
+	// 淘汰赛没有组别，统一记为 "X"
+	knockoutGroup = "X"
+	// ICS 里每场比赛按两小时计算结束时间
+	fixtureDuration = 2 * time.Hour
+	icsProductID    = "-//GhostComputing//worldcup-betting//ZH"
+	icsUIDDomain    = "worldcup-betting"
+)
+
+var fixtureCSVHeader = []string{
+	"schedule_id", "schedule_time", "schedule_group", "schedule_type", "home_team", "away_team",
+	"home_team_win_odds", "away_team_win_odds", "tied_odds", "betting_mode", "disable_betting", "enable_display",
+}
+
+var fixtureContentTypes = map[FixtureFormat]string{
+	FixtureCSV:  "text/csv; charset=utf-8",
+	FixtureJSON: "application/json; charset=utf-8",
+	FixtureICS:  "text/calendar; charset=utf-8",
+}
+
+func parseFixtureFormat(s string) (FixtureFormat, bool) {
+	switch f := FixtureFormat(strings.ToLower(strings.TrimPrefix(s, "."))); f {
+	case FixtureCSV, FixtureJSON, FixtureICS:
+		return f, true
+	case "ical", "ifb", "icalendar":
+		return FixtureICS, true
+	}
+	return "", false
+}
+
+// 没有指定 format 时按 Content-Type 判断
+func fixtureFormatOf(c *gin.Context) (FixtureFormat, bool) {
+	if format := c.Query("format"); format != "" {
+		return parseFixtureFormat(format)
+	}
+	contentType := c.ContentType()
+	for format, t := range fixtureContentTypes {
+		if strings.HasPrefix(t, contentType+";") {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func newFixture() Schedule {
+	return Schedule{EnableDisplay: true}
+}
+
+func parseFixtures(format FixtureFormat, body []byte) ([]fixtureRow, error) {
+	switch format {
+	case FixtureCSV:
+		return parseFixturesCSV(body)
+	case FixtureJSON:
+		return parseFixturesJSON(body)
+	case FixtureICS:
+		return parseFixturesICS(body)
+	}
+	return nil, fmt.Errorf("unknown fixture format %q", format)
+}
+
+func parseFixtureBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "y", "是":
+		return true, nil
+	case "0", "false", "no", "n", "否":
+		return false, nil
+	}
+	return false, fmt.Errorf("bad bool %q", s)
+}
+
+// setFixtureField 把 CSV 的一列或者 ICS 的一个扩展属性写到赛程上，空值保持默认
+func setFixtureField(schedule *Schedule, name, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch name {
+	case "schedule_id":
+		schedule.ScheduleID, err = strconv.Atoi(value)
+	case "schedule_time":
+		schedule.ScheduleTime = value
+	case "schedule_group":
+		schedule.ScheduleGroup = strings.ToUpper(value)
+	case "schedule_type":
+		var t int
+		t, err = strconv.Atoi(value)
+		schedule.ScheduleType = ScheduleType(t)
+	case "home_team":
+		schedule.HomeTeam = value
+	case "away_team":
+		schedule.AwayTeam = value
+	case "home_team_win_odds":
+		err = schedule.HomeTeamWinOdds.UnmarshalJSON([]byte(value))
+	case "away_team_win_odds":
+		err = schedule.AwayTeamWinOdds.UnmarshalJSON([]byte(value))
+	case "tied_odds":
+		err = schedule.TiedOdds.UnmarshalJSON([]byte(value))
+	case "betting_mode":
+		var m int
+		m, err = strconv.Atoi(value)
+		schedule.BettingMode = BettingMode(m)
+	case "disable_betting":
+		schedule.DisableBetting, err = parseFixtureBool(value)
+	case "enable_display":
+		schedule.EnableDisplay, err = parseFixtureBool(value)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("bad %v %q", name, value)
+	}
+	return nil
+}
+
+// parseFixturesCSV 第一行是表头，列的顺序随意，不认识的列忽略
+func parseFixturesCSV(body []byte) ([]fixtureRow, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var fixtures []fixtureRow
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return fixtures, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fixture := fixtureRow{row: line, schedule: newFixture()}
+		for i, value := range record {
+			if i < len(header) {
+				if err := setFixtureField(&fixture.schedule, header[i], value); err != nil {
+					return nil, fmt.Errorf("line %v: %v", line, err)
+				}
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+}
+
+// parseFixturesJSON 接受赛程数组，或者导出时的 {"fixtures": [...]}
+func parseFixturesJSON(body []byte) ([]fixtureRow, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		var doc struct {
+			Fixtures []json.RawMessage `json:"fixtures"`
+		}
+		if json.Unmarshal(body, &doc) != nil {
+			return nil, err
+		}
+		items = doc.Fixtures
+	}
+
+	fixtures := make([]fixtureRow, 0, len(items))
+	for i, item := range items {
+		fixture := fixtureRow{row: i + 1, schedule: newFixture()}
+		if err := json.Unmarshal(item, &fixture.schedule); err != nil {
+			return nil, fmt.Errorf("fixture %v: %v", i+1, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// ICS 里赛程自己的字段放在 X-WORLDCUP-* 扩展属性里，例如 X-WORLDCUP-HOME-TEAM，
+// 其他日历导出的文件没有这些属性时从 SUMMARY（"主队 vs 客队"）和 DTSTART 里取
+const icsFixturePrefix = "X-WORLDCUP-"
+
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICS 解析出所有 VEVENT，只处理赛程用得到的部分：折行、参数和转义
+func parseICS(body []byte) ([][]icsProperty, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(string(body), "\r\n", "\n", -1), "\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var (
+		events  [][]icsProperty
+		current []icsProperty
+		inEvent bool
+	)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %v: missing colon", i+1)
+		}
+		parts := strings.Split(line[:colon], ";")
+		prop := icsProperty{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: icsUnescape(line[colon+1:])}
+		for _, param := range parts[1:] {
+			if kv := strings.SplitN(param, "=", 2); len(kv) == 2 {
+				prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+			}
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent, current = true, nil
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if !inEvent {
+				return nil, fmt.Errorf("line %v: END:VEVENT without BEGIN", i+1)
+			}
+			events = append(events, current)
+			inEvent = false
+		case inEvent:
+			current = append(current, prop)
+		}
+	}
+	if inEvent {
+		return nil, errors.New("unterminated VEVENT")
+	}
+	return events, nil
+}
+
+func icsUnescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// parseICSTime 支持 UTC、带 TZID 和不带时区（按部署时区）三种写法
+func parseICSTime(prop icsProperty) (time.Time, error) {
+	const layout = "20060102T150405"
+	if strings.HasSuffix(prop.value, "Z") {
+		return time.Parse(layout+"Z", prop.value)
+	}
+	loc := serverLocation
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.ParseInLocation(layout, prop.value, loc)
+}
+
+func parseFixturesICS(body []byte) ([]fixtureRow, error) {
+	events, err := parseICS(body)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make([]fixtureRow, 0, len(events))
+	for i, event := range events {
+		fixture := fixtureRow{row: i + 1, schedule: newFixture()}
+		for _, prop := range event {
+			switch {
+			case prop.name == "DTSTART":
+				t, err := parseICSTime(prop)
+				if err != nil {
+					return nil, fmt.Errorf("event %v: bad DTSTART %q", i+1, prop.value)
+				}
+				fixture.schedule.ScheduleTime = t.Format(time.RFC3339)
+			case prop.name == "SUMMARY":
+				if teams := strings.SplitN(prop.value, " vs ", 2); len(teams) == 2 {
+					fixture.schedule.HomeTeam = strings.TrimSpace(teams[0])
+					fixture.schedule.AwayTeam = strings.TrimSpace(teams[1])
+				}
+			case strings.HasPrefix(prop.name, icsFixturePrefix):
+				name := strings.ToLower(strings.Replace(strings.TrimPrefix(prop.name, icsFixturePrefix), "-", "_", -1))
+				if err := setFixtureField(&fixture.schedule, name, prop.value); err != nil {
+					return nil, fmt.Errorf("event %v: %v", i+1, err)
+				}
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// validateFixture 检查队名、组别、比赛类别和赔率，并把开赛时间转成数据库格式
+func validateFixture(schedule *Schedule) error {
+	if _, ok := countryMap[schedule.HomeTeam]; !ok {
+		return fmt.Errorf("unknown home team %q", schedule.HomeTeam)
+	}
+	if _, ok := countryMap[schedule.AwayTeam]; !ok {
+		return fmt.Errorf("unknown away team %q", schedule.AwayTeam)
+	}
+	if schedule.HomeTeam == schedule.AwayTeam && countryMap[schedule.HomeTeam] != 0 {
+		return errors.New("home team and away team are the same")
+	}
+	if schedule.ScheduleType < GroupMatches || schedule.ScheduleType > Finals {
+		return fmt.Errorf("bad schedule type %v", schedule.ScheduleType)
+	}
+	if schedule.ScheduleType == GroupMatches {
+		if len(schedule.ScheduleGroup) != 1 || schedule.ScheduleGroup < "A" || schedule.ScheduleGroup > "H" {
+			return fmt.Errorf("bad group %q for group matches", schedule.ScheduleGroup)
+		}
+		if countryMap[schedule.HomeTeam] == 0 || countryMap[schedule.AwayTeam] == 0 {
+			return errors.New("group matches must have both teams")
+		}
+	} else {
+		if schedule.ScheduleGroup != "" && schedule.ScheduleGroup != knockoutGroup {
+			return fmt.Errorf("knockout matches have no group, got %q", schedule.ScheduleGroup)
+		}
+		schedule.ScheduleGroup = knockoutGroup
+	}
+	if schedule.BettingMode != FixedOddsBetting && schedule.BettingMode != PoolBetting {
+		return fmt.Errorf("bad betting mode %v", schedule.BettingMode)
+	}
+	if schedule.BettingMode == FixedOddsBetting &&
+		(schedule.HomeTeamWinOdds <= 0 || schedule.AwayTeamWinOdds <= 0 || schedule.TiedOdds <= 0) {
+		return errors.New("fixed odds matches need positive odds")
+	}
+	if schedule.ScheduleTime == "" {
+		return errors.New("missing schedule time")
+	}
+	if normalizeScheduleTime(schedule) != nil {
+		return fmt.Errorf("bad schedule time %q", schedule.ScheduleTime)
+	}
+	return nil
+}
+
+var errAmbiguousFixture = errors.New("several schedules start at this time, specify schedule_id")
+
+func fixtureKey(schedule Schedule) string {
+	if schedule.ScheduleID != 0 {
+		return "#" + strconv.Itoa(schedule.ScheduleID)
+	}
+	return fmt.Sprintf("%s|%d|%s|%s|%s", schedule.ScheduleTime, schedule.ScheduleType, schedule.ScheduleGroup,
+		schedule.HomeTeam, schedule.AwayTeam)
+}
+
+// findFixture 找到导入的比赛对应的已有赛程，没有时返回 sql.ErrNoRows，对应不上唯一一场时返回 errAmbiguousFixture。
+// lock 为 true 时锁住找到的赛程
+func findFixture(tx *sql.Tx, schedule Schedule, lock bool) (Schedule, error) {
+	var (
+		existing Schedule
+		rows     *sql.Rows
+		err      error
+		suffix   string
+	)
+	if lock {
+		suffix = " FOR UPDATE"
+	}
+	if schedule.ScheduleID != 0 {
+		rows, err = tx.Query("SELECT "+scheduleColumns+" FROM schedule WHERE schedule_id = ?"+suffix, schedule.ScheduleID)
+	} else {
+		query, args := "SELECT "+scheduleColumns+" FROM schedule WHERE schedule_time = ? and schedule_type = ?",
+			[]interface{}{schedule.ScheduleTime, schedule.ScheduleType}
+		if schedule.ScheduleType == GroupMatches {
+			query += " and schedule_group = ? and home_team = ? and away_team = ?"
+			args = append(args, schedule.ScheduleGroup, schedule.HomeTeam, schedule.AwayTeam)
+		}
+		rows, err = tx.Query(query+" ORDER BY schedule_id"+suffix, args...)
+	}
+	if err != nil {
+		return existing, err
+	}
+	defer rows.Close()
+
+	var candidates []Schedule
+	for rows.Next() {
+		var candidate Schedule
+		if err := scanSchedule(rows, &candidate); err != nil {
+			return existing, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return existing, err
+	}
+	switch len(candidates) {
+	case 0:
+		return existing, sql.ErrNoRows
+	case 1:
+		return candidates[0], nil
+	}
+	for _, candidate := range candidates {
+		if candidate.HomeTeam == schedule.HomeTeam && candidate.AwayTeam == schedule.AwayTeam {
+			return candidate, nil
+		}
+	}
+	return existing, errAmbiguousFixture
+}
+
+func sameFixture(a, b Schedule) bool {
+	return a.HomeTeam == b.HomeTeam && a.AwayTeam == b.AwayTeam && a.ScheduleTime == b.ScheduleTime &&
+		a.ScheduleGroup == b.ScheduleGroup && a.ScheduleType == b.ScheduleType &&
+		a.HomeTeamWinOdds == b.HomeTeamWinOdds && a.AwayTeamWinOdds == b.AwayTeamWinOdds && a.TiedOdds == b.TiedOdds &&
+		a.DisableBetting == b.DisableBetting && a.EnableDisplay == b.EnableDisplay
+}
+
+// applyFixture 在事务里创建或者更新一场比赛，返回的 error 是数据库错误，
+// 不能导入的原因放在 FixtureResult.Error 里。dryRun 时只查询，不写入任何数据
+func applyFixture(tx *sql.Tx, schedule Schedule, upsert, dryRun bool) (FixtureResult, *Schedule, error) {
+	var result FixtureResult
+	existing, err := findFixture(tx, schedule, !dryRun)
+	if err == errAmbiguousFixture {
+		result.Action, result.Error = FixtureInvalid, err.Error()
+		return result, nil, nil
+	}
+	if err == sql.ErrNoRows {
+		if schedule.ScheduleID != 0 {
+			result.Action, result.Error = FixtureInvalid, fmt.Sprintf("schedule %v does not exist", schedule.ScheduleID)
+			return result, nil, nil
+		}
+		if dryRun {
+			result.Action = FixtureCreated
+			return result, nil, nil
+		}
+		res, err := tx.Exec("INSERT INTO "+
+			"schedule(home_team,away_team,home_team_win_odds,away_team_win_odds,tied_odds,schedule_time,schedule_group,schedule_type,schedule_status,disable_betting,enable_display,betting_mode) "+
+			"VALUES (?,?,?,?,?,?,?,?,?,?,?,?)",
+			schedule.HomeTeam, schedule.AwayTeam, schedule.HomeTeamWinOdds, schedule.AwayTeamWinOdds, schedule.TiedOdds,
+			schedule.ScheduleTime, schedule.ScheduleGroup, schedule.ScheduleType, NotStarted,
+			schedule.DisableBetting, schedule.EnableDisplay, schedule.BettingMode)
+		if err != nil {
+			return result, nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return result, nil, err
+		}
+		result.Action, result.ScheduleID = FixtureCreated, int(id)
+		return result, nil, nil
+	}
+	if err != nil {
+		return result, nil, err
+	}
+
+	result.ScheduleID = existing.ScheduleID
+	switch {
+	case !upsert:
+		result.Action = FixtureSkipped
+	case existing.ScheduleStatus != NotStarted:
+		result.Action, result.Error = FixtureInvalid, "schedule already has a result"
+	case existing.BettingMode != schedule.BettingMode:
+		// 和 update_schedule 一样，投注模式以建赛程时为准
+		result.Action, result.Error = FixtureInvalid, "betting mode can not be changed"
+	case sameFixture(existing, schedule):
+		result.Action = FixtureUnchanged
+	case dryRun:
+		result.Action = FixtureUpdated
+	default:
+		_, err := tx.Exec("UPDATE schedule SET home_team = ?, away_team = ?, "+
+			"home_team_win_odds = ?, away_team_win_odds = ?, tied_odds = ?, "+
+			"schedule_time = ?, schedule_group = ?, schedule_type = ?, "+
+			"disable_betting = ?, enable_display = ? WHERE schedule_id = ?",
+			schedule.HomeTeam, schedule.AwayTeam, schedule.HomeTeamWinOdds, schedule.AwayTeamWinOdds, schedule.TiedOdds,
+			schedule.ScheduleTime, schedule.ScheduleGroup, schedule.ScheduleType,
+			schedule.DisableBetting, schedule.EnableDisplay, existing.ScheduleID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Action = FixtureUpdated
+	}
+	return result, &existing, nil
+}
+
+// importFixtures 导入一批赛程，返回每一行的结果以及是否全部合法。
+// 不合法时回滚，不会写入任何一行；dryRun 时只查询已有的赛程，不执行任何写入
+func importFixtures(fixtures []fixtureRow, upsert, dryRun bool) ([]FixtureResult, bool, error) {
+	results := make([]FixtureResult, len(fixtures))
+	valid := true
+	seen := map[string]int{}
+	for i := range fixtures {
+		f := &fixtures[i]
+		results[i].Row = f.row
+		if err := validateFixture(&f.schedule); err != nil {
+			results[i].Action, results[i].Error = FixtureInvalid, err.Error()
+			valid = false
+			continue
+		}
+		key := fixtureKey(f.schedule)
+		if row, ok := seen[key]; ok {
+			results[i].Action, results[i].Error = FixtureInvalid, fmt.Sprintf("duplicate of row %v", row)
+			valid = false
+			continue
+		}
+		seen[key] = f.row
+	}
+	if !valid {
+		return results, false, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	previous := make([]*Schedule, len(fixtures))
+	matched := map[int]int{} // 已有赛程对应的行，两行不能对应同一场比赛
+	for i, f := range fixtures {
+		result, existing, err := applyFixture(tx, f.schedule, upsert, dryRun)
+		if err != nil {
+			return nil, false, fmt.Errorf("row %v: %v", f.row, err)
+		}
+		result.Row = f.row
+		if existing != nil {
+			if row, ok := matched[existing.ScheduleID]; ok {
+				result.Action, result.Error = FixtureInvalid, fmt.Sprintf("same schedule as row %v", row)
+			}
+			matched[existing.ScheduleID] = f.row
+		}
+		results[i], previous[i] = result, existing
+		valid = valid && result.Action != FixtureInvalid
+	}
+	if !valid || dryRun {
+		return results, valid, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	for i, result := range results {
+		schedule := fixtures[i].schedule
+		switch result.Action {
+		case FixtureCreated:
+			bus.Publish(EventScheduleCreated, ScheduleCreatedEvent{
+				ScheduleID:   result.ScheduleID,
+				HomeTeam:     countryToID(schedule.HomeTeam),
+				AwayTeam:     countryToID(schedule.AwayTeam),
+				ScheduleTime: formatAPITime(schedule.ScheduleTime),
+				ScheduleType: schedule.ScheduleType,
+				BettingMode:  schedule.BettingMode,
+			})
+		case FixtureUpdated:
+			old := previous[i]
+			if schedule.BettingMode == FixedOddsBetting && (schedule.HomeTeamWinOdds != old.HomeTeamWinOdds ||
+				schedule.AwayTeamWinOdds != old.AwayTeamWinOdds || schedule.TiedOdds != old.TiedOdds) {
+				bus.Publish(EventOddsChanged, OddsChangedEvent{
+					ScheduleID:      result.ScheduleID,
+					HomeTeamWinOdds: schedule.HomeTeamWinOdds,
+					AwayTeamWinOdds: schedule.AwayTeamWinOdds,
+					TiedOdds:        schedule.TiedOdds,
+				})
+			}
+		}
+	}
+	return results, true, nil
+}
+
+func allSchedules() ([]Schedule, error) {
+	rows, err := db.Query("SELECT " + scheduleColumns + " FROM schedule ORDER BY schedule_time, schedule_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var schedule Schedule
+		if err := scanSchedule(rows, &schedule); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func exportFixturesCSV(w io.Writer, schedules []Schedule) error {
+	cw := csv.NewWriter(w)
+	cw.Write(fixtureCSVHeader)
+	for _, s := range schedules {
+		cw.Write([]string{
+			strconv.Itoa(s.ScheduleID), formatAPITime(s.ScheduleTime), s.ScheduleGroup,
+			strconv.Itoa(int(s.ScheduleType)), s.HomeTeam, s.AwayTeam,
+			s.HomeTeamWinOdds.String(), s.AwayTeamWinOdds.String(), s.TiedOdds.String(),
+			strconv.Itoa(int(s.BettingMode)), strconv.FormatBool(s.DisableBetting), strconv.FormatBool(s.EnableDisplay),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportFixturesJSON(w io.Writer, schedules []Schedule) error {
+	for i := range schedules {
+		schedules[i].ScheduleTime = formatAPITime(schedules[i].ScheduleTime)
+	}
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(gin.H{"fixtures": schedules})
+}
+
+// writeICSLine 写一行 ICS 属性，超过 75 字节时按 RFC 5545 折行，不会截断 UTF-8 字符
+func writeICSLine(w *bytes.Buffer, name, value string) {
+	line := name + ":" + value
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func writeICSHeader(w *bytes.Buffer, name string) {
+	writeICSLine(w, "BEGIN", "VCALENDAR")
+	writeICSLine(w, "VERSION", "2.0")
+	writeICSLine(w, "PRODID", icsProductID)
+	writeICSLine(w, "CALSCALE", "GREGORIAN")
+	writeICSLine(w, "METHOD", "PUBLISH")
+	writeICSLine(w, "X-WR-CALNAME", icsEscape(name))
+}
+
+// writeScheduleEvent 写一场比赛的 VEVENT，props 用来追加调用方自己的属性
+func writeScheduleEvent(w *bytes.Buffer, s Schedule, summary string, now time.Time, props func(w *bytes.Buffer)) {
+	start, err := fromDBTime(s.ScheduleTime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bad schedule time %v of schedule %v\n", s.ScheduleTime, s.ScheduleID)
+		return
+	}
+	writeICSLine(w, "BEGIN", "VEVENT")
+	writeICSLine(w, "UID", fmt.Sprintf("schedule-%v@%v", s.ScheduleID, icsUIDDomain))
+	writeICSLine(w, "DTSTAMP", icsTime(now))
+	writeICSLine(w, "DTSTART", icsTime(start))
+	writeICSLine(w, "DTEND", icsTime(start.Add(fixtureDuration)))
+	writeICSLine(w, "SUMMARY", icsEscape(summary))
+	props(w)
+	writeICSLine(w, "END", "VEVENT")
+}
+
+func writeFixtureEvent(w *bytes.Buffer, s Schedule, now time.Time) {
+	writeScheduleEvent(w, s, s.HomeTeam+" vs "+s.AwayTeam, now, func(w *bytes.Buffer) {
+		writeICSLine(w, icsFixturePrefix+"SCHEDULE-ID", strconv.Itoa(s.ScheduleID))
+		writeICSLine(w, icsFixturePrefix+"HOME-TEAM", icsEscape(s.HomeTeam))
+		writeICSLine(w, icsFixturePrefix+"AWAY-TEAM", icsEscape(s.AwayTeam))
+		writeICSLine(w, icsFixturePrefix+"SCHEDULE-GROUP", icsEscape(s.ScheduleGroup))
+		writeICSLine(w, icsFixturePrefix+"SCHEDULE-TYPE", strconv.Itoa(int(s.ScheduleType)))
+		writeICSLine(w, icsFixturePrefix+"HOME-TEAM-WIN-ODDS", s.HomeTeamWinOdds.String())
+		writeICSLine(w, icsFixturePrefix+"AWAY-TEAM-WIN-ODDS", s.AwayTeamWinOdds.String())
+		writeICSLine(w, icsFixturePrefix+"TIED-ODDS", s.TiedOdds.String())
+		writeICSLine(w, icsFixturePrefix+"BETTING-MODE", strconv.Itoa(int(s.BettingMode)))
+		writeICSLine(w, icsFixturePrefix+"DISABLE-BETTING", strconv.FormatBool(s.DisableBetting))
+		writeICSLine(w, icsFixturePrefix+"ENABLE-DISPLAY", strconv.FormatBool(s.EnableDisplay))
+	})
+}
+
+func exportFixturesICS(w io.Writer, schedules []Schedule) error {
+	var buf bytes.Buffer
+	now := time.Now()
+	writeICSHeader(&buf, "世界杯赛程")
+	for _, s := range schedules {
+		writeFixtureEvent(&buf, s, now)
+	}
+	writeICSLine(&buf, "END", "VCALENDAR")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func exportFixtures(w io.Writer, format FixtureFormat, schedules []Schedule) error {
+	switch format {
+	case FixtureCSV:
+		return exportFixturesCSV(w, schedules)
+	case FixtureJSON:
+		return exportFixturesJSON(w, schedules)
+	case FixtureICS:
+		return exportFixturesICS(w, schedules)
+	}
+	return fmt.Errorf("unknown fixture format %q", format)
+}
+
+// handleImportFixtures 请求体是整个文件，格式由 format 参数或者 Content-Type 决定
+func handleImportFixtures(c *gin.Context) {
+	format, ok := fixtureFormatOf(c)
+	if !ok {
+		illegalParametersRsp(c)
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	fixtures, err := parseFixtures(format, body)
+	if err != nil {
+		fixturesInvalidRsp(c, nil, err.Error())
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	results, valid, err := importFixtures(fixtures, c.Query("upsert") == "true", dryRun)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "import fixtures failed, err: %v\n", err)
+		return
+	}
+	if !valid {
+		fixturesInvalidRsp(c, results, "")
+		return
+	}
+
+	counts := map[FixtureAction]int{}
+	for _, result := range results {
+		counts[result.Action]++
+	}
+	if !dryRun {
+		fmt.Fprintf(os.Stderr, "import %v fixtures: %v created, %v updated\n",
+			len(results), counts[FixtureCreated], counts[FixtureUpdated])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"desc":      "OK",
+		"dry_run":   dryRun,
+		"created":   counts[FixtureCreated],
+		"updated":   counts[FixtureUpdated],
+		"unchanged": counts[FixtureUnchanged],
+		"skipped":   counts[FixtureSkipped],
+		"results":   results,
+	})
+}
+
+func handleExportFixtures(c *gin.Context) {
+	format := FixtureJSON
+	if s := c.Query("format"); s != "" {
+		var ok bool
+		if format, ok = parseFixtureFormat(s); !ok {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+	schedules, err := allSchedules()
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query schedules failed, err: %v\n", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := exportFixtures(&buf, format, schedules); err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "export fixtures failed, err: %v\n", err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="fixtures.%v"`, format))
+	c.Data(http.StatusOK, fixtureContentTypes[format], buf.Bytes())
+}
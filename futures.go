@@ -0,0 +1,537 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 长线竞猜（冠军、决赛球队等）：整届比赛期间一直开放，赔率由管理员设置。
+// 球队被淘汰时对应的选项停止投注，总决赛结算时所有长线竞猜一起结算，本金和派彩都记入账本
+
+type FuturesKind string
+
+const (
+	FuturesChampion FuturesKind = "champion" // 冠军：总决赛的胜者
+	FuturesFinalist FuturesKind = "finalist" // 进入决赛：总决赛的两支球队
+	FuturesCustom   FuturesKind = "custom"   // 其他：总决赛结算时仍未淘汰的选项获胜
+)
+
+type FuturesStatus string
+
+const (
+	FuturesOpen       FuturesStatus = "open"       // 可以投注
+	FuturesEliminated FuturesStatus = "eliminated" // 已淘汰，不能再投注
+	FuturesSettled    FuturesStatus = "settled"    // 已结算
+)
+
+const RefFutures = "futures_bet"
+
+var errKnockoutNeedWinner = errors.New("knockout matches must be won by one team, record the penalty shoot-out winner")
+
+// validKnockoutResult 小组赛之后的比赛一定会分出胜负，点球决胜时结果录入点球的胜者，不能是平局
+func validKnockoutResult(scheduleType ScheduleType, result ScheduleStatus) bool {
+	return scheduleType == GroupMatches || result != Draw
+}
+
+type FuturesSelection struct {
+	SelectionID int           `json:"selection_id"`
+	MarketID    int           `json:"market_id"`
+	TeamID      int           `json:"team_id"` // 对应 /country 中的 ID，0 表示不是球队
+	Name        string        `json:"name"`
+	Odds        Odds          `json:"odds"`
+	Status      FuturesStatus `json:"status"`
+	Won         bool          `json:"won"`
+}
+
+type FuturesMarket struct {
+	MarketID    int                `json:"market_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Kind        FuturesKind        `json:"kind"`
+	Status      FuturesStatus      `json:"status"`
+	Selections  []FuturesSelection `json:"selections"`
+}
+
+type FuturesBet struct {
+	BetID         int    `json:"bet_id"`
+	UserID        int    `json:"user_id"`
+	MarketID      int    `json:"market_id"`
+	MarketName    string `json:"market_name"`
+	SelectionID   int    `json:"selection_id"`
+	SelectionName string `json:"selection_name"`
+	BettingMoney  Money  `json:"betting_money"`
+	BettingOdds   Odds   `json:"betting_odds"`
+	BetStatus     int    `json:"bet_status"`
+	WinMoney      Money  `json:"win_money"`
+	BetTime       string `json:"bet_time"`
+}
+
+type FuturesBetRequest struct {
+	UserID       int   `json:"user_id"`
+	SelectionID  int   `json:"selection_id"`
+	BettingMoney Money `json:"betting_money"`
+}
+
+type NewFuturesMarketRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Kind        FuturesKind        `json:"kind"`
+	Selections  []FuturesSelection `json:"selections"`
+}
+
+type UpdateFuturesSelectionRequest struct {
+	SelectionID int  `json:"selection_id"`
+	Odds        Odds `json:"odds"`       // 0 表示不修改赔率
+	Eliminated  bool `json:"eliminated"` // 标记为已淘汰
+}
+
+func futuresMarkets() ([]FuturesMarket, error) {
+	rows, err := db.Query("SELECT market_id, name, description, kind, status FROM futures_market ORDER BY market_id")
+	if err != nil {
+		return nil, err
+	}
+	markets := []FuturesMarket{}
+	index := make(map[int]int)
+	for rows.Next() {
+		m := FuturesMarket{Selections: []FuturesSelection{}}
+		if err := rows.Scan(&m.MarketID, &m.Name, &m.Description, &m.Kind, &m.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[m.MarketID] = len(markets)
+		markets = append(markets, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT selection_id, market_id, team_id, name, odds, status, won FROM futures_selection " +
+		"ORDER BY market_id, odds, selection_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s FuturesSelection
+		if err := rows.Scan(&s.SelectionID, &s.MarketID, &s.TeamID, &s.Name, &s.Odds, &s.Status, &s.Won); err != nil {
+			return nil, err
+		}
+		if i, ok := index[s.MarketID]; ok {
+			markets[i].Selections = append(markets[i].Selections, s)
+		}
+	}
+	return markets, rows.Err()
+}
+
+func userFuturesBets(userID int) ([]FuturesBet, error) {
+	rows, err := db.Query("SELECT b.bet_id, b.user_id, b.market_id, m.name, b.selection_id, s.name, b.betting_money, "+
+		"b.betting_odds, b.bet_status, b.win_money, b.bet_time FROM futures_bet b "+
+		"JOIN futures_market m ON m.market_id = b.market_id JOIN futures_selection s ON s.selection_id = b.selection_id "+
+		"WHERE b.user_id = ? ORDER BY b.bet_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bets := []FuturesBet{}
+	for rows.Next() {
+		var b FuturesBet
+		err := rows.Scan(&b.BetID, &b.UserID, &b.MarketID, &b.MarketName, &b.SelectionID, &b.SelectionName,
+			&b.BettingMoney, &b.BettingOdds, &b.BetStatus, &b.WinMoney, &b.BetTime)
+		if err != nil {
+			return nil, err
+		}
+		b.BetTime = formatAPITime(b.BetTime)
+		bets = append(bets, b)
+	}
+	return bets, rows.Err()
+}
+
+// eliminateTeam 淘汰赛结束后，输球的球队在冠军和进入决赛两类竞猜中被淘汰
+func eliminateTeam(tx *sql.Tx, teamID int) error {
+	_, err := tx.Exec("UPDATE futures_selection s JOIN futures_market m ON m.market_id = s.market_id "+
+		"SET s.status = ? WHERE s.team_id = ? and s.status = ? and m.status = ? and m.kind IN (?,?)",
+		FuturesEliminated, teamID, FuturesOpen, FuturesOpen, FuturesChampion, FuturesFinalist)
+	return err
+}
+
+// 结算一个长线竞猜，winners 是获胜的选项，nil 表示无法确定结果，所有投注退还本金
+func settleFuturesMarket(tx *sql.Tx, marketID int, winners map[int]bool) error {
+	rows, err := tx.Query("SELECT bet_id, user_id, selection_id, betting_money, betting_odds FROM futures_bet "+
+		"WHERE market_id = ? and bet_status = ? FOR UPDATE", marketID, BetNotFinish)
+	if err != nil {
+		return err
+	}
+	type openBet struct {
+		betID, userID, selectionID int
+		stake                      Money
+		odds                       Odds
+	}
+	var bets []openBet
+	for rows.Next() {
+		var b openBet
+		if err := rows.Scan(&b.betID, &b.userID, &b.selectionID, &b.stake, &b.odds); err != nil {
+			rows.Close()
+			return err
+		}
+		bets = append(bets, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, b := range bets {
+		var (
+			betStatus int
+			winMoney  Money
+		)
+		switch {
+		case winners == nil:
+			betStatus = RefundBet
+			_, err = postLedger(tx, b.userID, b.stake, LedgerRefund, RefFutures, b.betID)
+		case winners[b.selectionID]:
+			betStatus = WinBet
+			winMoney = b.stake.MulOdds(b.odds)
+			_, err = postLedger(tx, b.userID, b.stake+winMoney, LedgerPayout, RefFutures, b.betID)
+		default:
+			betStatus = LostBet
+			winMoney = -b.stake
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE futures_bet SET bet_status = ?, win_money = ? WHERE bet_id = ?", betStatus, winMoney, b.betID)
+		if err != nil {
+			return err
+		}
+		err = recordSystemAudit(tx, auditRecord{
+			Action:     "settle_futures_bet",
+			TargetType: RefFutures,
+			TargetID:   b.betID,
+			UserID:     b.userID,
+			Before:     map[string]interface{}{"bet_status": BetNotFinish},
+			After:      map[string]interface{}{"bet_status": betStatus, "win_money": winMoney},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for selectionID := range winners {
+		if _, err := tx.Exec("UPDATE futures_selection SET won = ? WHERE selection_id = ?", true, selectionID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("UPDATE futures_market SET status = ?, settled_at = ? WHERE market_id = ?",
+		FuturesSettled, toDBTime(time.Now()), marketID)
+	return err
+}
+
+// 选出某个长线竞猜中满足条件的选项
+func futuresSelections(tx *sql.Tx, marketID int, cond string, args ...interface{}) (map[int]bool, error) {
+	rows, err := tx.Query("SELECT selection_id FROM futures_selection WHERE market_id = ? and "+cond,
+		append([]interface{}{marketID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	selections := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		selections[id] = true
+	}
+	return selections, rows.Err()
+}
+
+// settleFutures 在比赛结算的事务中处理长线竞猜：淘汰赛输球的球队被淘汰，总决赛结算所有长线竞猜
+func settleFutures(tx *sql.Tx, scheduleID int, result ScheduleStatus) error {
+	var (
+		scheduleType       ScheduleType
+		homeTeam, awayTeam string
+	)
+	err := tx.QueryRow("SELECT schedule_type, home_team, away_team FROM schedule WHERE schedule_id = ?", scheduleID).
+		Scan(&scheduleType, &homeTeam, &awayTeam)
+	if err != nil {
+		return err
+	}
+	if !validKnockoutResult(scheduleType, result) {
+		return errKnockoutNeedWinner
+	}
+	if scheduleType == GroupMatches || scheduleType == MatchForThirdPlace {
+		return nil
+	}
+	homeID, awayID := countryMap[homeTeam], countryMap[awayTeam]
+	winnerID, loserID := homeID, awayID
+	if result == AwayTeamWin {
+		winnerID, loserID = awayID, homeID
+	}
+	if scheduleType != Finals {
+		return eliminateTeam(tx, loserID)
+	}
+
+	rows, err := tx.Query("SELECT market_id, kind FROM futures_market WHERE status != ? FOR UPDATE", FuturesSettled)
+	if err != nil {
+		return err
+	}
+	markets := make(map[int]FuturesKind)
+	for rows.Next() {
+		var (
+			id   int
+			kind FuturesKind
+		)
+		if err := rows.Scan(&id, &kind); err != nil {
+			rows.Close()
+			return err
+		}
+		markets[id] = kind
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for marketID, kind := range markets {
+		var winners map[int]bool
+		switch kind {
+		case FuturesChampion:
+			winners, err = futuresSelections(tx, marketID, "team_id = ?", winnerID)
+		case FuturesFinalist:
+			winners, err = futuresSelections(tx, marketID, "team_id IN (?,?)", homeID, awayID)
+		default:
+			winners, err = futuresSelections(tx, marketID, "status = ?", FuturesOpen)
+		}
+		if err != nil {
+			return err
+		}
+		if len(winners) == 0 {
+			winners = nil
+		}
+		if err := settleFuturesMarket(tx, marketID, winners); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "settle %v futures markets with finals schedule %v\n", len(markets), scheduleID)
+	return nil
+}
+
+func handleFutures(c *gin.Context) {
+	markets, err := futuresMarkets()
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query futures markets failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"desc":    "OK",
+		"markets": markets,
+	})
+}
+
+func handleFuturesBet(c *gin.Context) {
+	var req FuturesBetRequest
+	if c.Bind(&req) != nil || req.BettingMoney <= 0 {
+		illegalParametersRsp(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// 锁住选项，避免投注时管理员同时修改赔率或者淘汰
+	var (
+		marketID     int
+		odds         Odds
+		status       FuturesStatus
+		marketStatus FuturesStatus
+	)
+	err = tx.QueryRow("SELECT s.market_id, s.odds, s.status, m.status FROM futures_selection s "+
+		"JOIN futures_market m ON m.market_id = s.market_id WHERE s.selection_id = ? FOR UPDATE", req.SelectionID).
+		Scan(&marketID, &odds, &status, &marketStatus)
+	if err == sql.ErrNoRows {
+		futuresNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query futures selection failed, err: %v\n", err)
+		return
+	}
+	if status != FuturesOpen || marketStatus != FuturesOpen {
+		disableBet(c)
+		return
+	}
+
+	var money Money
+	err = tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", req.UserID).Scan(&money)
+	if err == sql.ErrNoRows {
+		userNotExist(c)
+		return
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query user failed, err: %v\n", err)
+		return
+	}
+	if money < req.BettingMoney {
+		notEnoughMoney(c)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO futures_bet(user_id, market_id, selection_id, betting_money, betting_odds, "+
+		"bet_status, win_money, bet_time) VALUES (?,?,?,?,?,?,0,?)", req.UserID, marketID, req.SelectionID,
+		req.BettingMoney, odds, BetNotFinish, toDBTime(time.Now()))
+	var betID int64
+	if err == nil {
+		betID, err = result.LastInsertId()
+	}
+	if err == nil {
+		money, err = postLedger(tx, req.UserID, -req.BettingMoney, LedgerStake, RefFutures, int(betID))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "futures bet failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{
+		Action:     "futures_bet",
+		TargetType: RefFutures,
+		TargetID:   int(betID),
+		UserID:     req.UserID,
+		After: gin.H{"money": money, "selection_id": req.SelectionID, "betting_money": req.BettingMoney,
+			"betting_odds": odds},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"bet_id":       betID,
+		"betting_odds": odds,
+		"money":        money,
+	})
+}
+
+func handleNewFuturesMarket(c *gin.Context) {
+	var req NewFuturesMarketRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Kind == "" {
+		req.Kind = FuturesCustom
+	}
+	if req.Name == "" || len(req.Selections) == 0 ||
+		(req.Kind != FuturesChampion && req.Kind != FuturesFinalist && req.Kind != FuturesCustom) {
+		illegalParametersRsp(c)
+		return
+	}
+	for _, s := range req.Selections {
+		// 冠军和进入决赛两类竞猜按球队判断结果，每个选项都必须是球队
+		if s.Odds <= 0 || (req.Kind != FuturesCustom && s.TeamID <= 0) {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO futures_market(name, description, kind, status, created_at) VALUES (?,?,?,?,?)",
+		req.Name, req.Description, req.Kind, FuturesOpen, toDBTime(time.Now()))
+	var marketID int64
+	if err == nil {
+		marketID, err = result.LastInsertId()
+	}
+	for _, s := range req.Selections {
+		if err != nil {
+			break
+		}
+		name := s.Name
+		if name == "" && s.TeamID > 0 && s.TeamID < len(CountryInfoList) {
+			name = CountryInfoList[s.TeamID].CountryName
+		}
+		_, err = tx.Exec("INSERT INTO futures_selection(market_id, team_id, name, odds, status, won) VALUES (?,?,?,?,?,?)",
+			marketID, s.TeamID, name, s.Odds, FuturesOpen, false)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "create futures market failed, err: %v\n", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"desc":      "OK",
+		"market_id": marketID,
+	})
+}
+
+// 管理员修改选项的赔率，或者标记为已淘汰。已经下的注按投注时的赔率结算
+func handleUpdateFuturesSelection(c *gin.Context) {
+	var req UpdateFuturesSelectionRequest
+	if c.Bind(&req) != nil || req.Odds < 0 {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var status FuturesStatus
+	err := db.QueryRow("SELECT status FROM futures_selection WHERE selection_id = ?", req.SelectionID).Scan(&status)
+	if err == sql.ErrNoRows {
+		futuresNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query futures selection failed, err: %v\n", err)
+		return
+	}
+	if status != FuturesOpen {
+		disableBet(c)
+		return
+	}
+
+	query := "UPDATE futures_selection SET odds = IF(? > 0, ?, odds)"
+	args := []interface{}{req.Odds, req.Odds}
+	if req.Eliminated {
+		query += ", status = ?"
+		args = append(args, FuturesEliminated)
+	}
+	if _, err := db.Exec(query+" WHERE selection_id = ?", append(args, req.SelectionID)...); err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "update futures selection failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+	})
+}
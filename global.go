@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"os"
+	"sync"
 )
 
 var (
@@ -82,9 +83,8 @@ var (
 	config           Config
 	GdisplayFileList = []string{}
 
-	timiUserWhiteList = make(map[string]string)
-	timiNewUsers      *os.File
-
-	GRank       = []RankRsp{}
-	DisplayRank = true
+	timiUserWhiteList   = make(map[string]string)   // 英文名 -> 中文名
+	timiUserGroups      = make(map[string][]string) // 英文名 -> 白名单中的部门
+	timiUserWhiteListMu sync.RWMutex                // 两个表一起读写，通过 setWhiteListUser、isIllegalUser 和 userDepartments 访问
+	timiNewUsers        *os.File
 )
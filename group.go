@@ -0,0 +1,560 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 分组：部门分组来自白名单第一列，用户登陆时自动加入；
+// 私人分组由用户创建，其他人通过邀请码加入。每个分组有自己的排行榜，分组之间也有排行榜
+
+type GroupKind string
+
+const (
+	GroupDepartment GroupKind = "department"
+	GroupPrivate    GroupKind = "private"
+)
+
+const groupInviteCodeLen = 8
+
+type Group struct {
+	GroupID     int       `json:"group_id"`
+	Name        string    `json:"name"`
+	Kind        GroupKind `json:"kind"`
+	InviteCode  string    `json:"invite_code,omitempty"` // 只有私人分组有邀请码
+	OwnerID     int       `json:"owner_id"`
+	MemberCount int       `json:"member_count"`
+}
+
+// 分组的汇总统计，只统计下过注的成员
+type GroupStats struct {
+	Rank           int       `json:"rank"`
+	GroupID        int       `json:"group_id"`
+	Name           string    `json:"name"`
+	Kind           GroupKind `json:"kind"`
+	MemberCount    int       `json:"member_count"`
+	ActiveCount    int       `json:"active_count"`
+	TotalMoney     Money     `json:"total_money"`
+	TotalNetProfit Money     `json:"total_net_profit"`
+	AvgNetProfit   Money     `json:"avg_net_profit"`
+	BetCount       int       `json:"bet_count"`
+	WinCount       int       `json:"win_count"`
+	WinRate        float64   `json:"win_rate"`
+}
+
+type CreateGroupReq struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type JoinGroupReq struct {
+	UserID     int    `json:"user_id"`
+	InviteCode string `json:"invite_code"`
+}
+
+type LeaveGroupReq struct {
+	UserID  int `json:"user_id"`
+	GroupID int `json:"group_id"`
+}
+
+// 白名单第一列是部门，多个部门用分号分隔，"X" 或空表示没有部门
+func parseDepartments(column string) []string {
+	departments := []string{}
+	for _, d := range strings.Split(column, ";") {
+		d = strings.TrimSpace(d)
+		if d == "" || d == "X" {
+			continue
+		}
+		departments = append(departments, d)
+	}
+	return departments
+}
+
+func newInviteCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b)[:groupInviteCodeLen], nil
+}
+
+func departmentGroupID(name string) (int, error) {
+	_, err := db.Exec("INSERT IGNORE INTO user_group(name, kind, invite_code, owner_id, created_at) VALUES (?,?,NULL,0,?)",
+		name, GroupDepartment, toDBTime(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	var groupID int
+	err = db.QueryRow("SELECT group_id FROM user_group WHERE kind = ? and name = ?", GroupDepartment, name).Scan(&groupID)
+	return groupID, err
+}
+
+// syncDepartmentGroups 按白名单把用户加入所在部门的分组，已经不在的部门分组退出。
+// 不在白名单里的用户不做修改
+func syncDepartmentGroups(userID int, englishName string) error {
+	departments, ok := userDepartments(englishName)
+	if !ok {
+		return nil
+	}
+	groupIDs := make([]interface{}, 0, len(departments))
+	for _, department := range departments {
+		groupID, err := departmentGroupID(department)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("INSERT IGNORE INTO group_member(group_id, user_id, joined_at) VALUES (?,?,?)",
+			groupID, userID, toDBTime(time.Now()))
+		if err != nil {
+			return err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	query := "DELETE m FROM group_member m JOIN user_group g ON g.group_id = m.group_id WHERE m.user_id = ? and g.kind = ?"
+	args := []interface{}{userID, GroupDepartment}
+	if len(groupIDs) > 0 {
+		query += " and m.group_id NOT IN (?" + strings.Repeat(",?", len(groupIDs)-1) + ")"
+		args = append(args, groupIDs...)
+	}
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// 启动时为已经登陆过的用户同步部门分组
+func syncAllDepartmentGroups() error {
+	rows, err := db.Query("SELECT user_id, rtx_name FROM user")
+	if err != nil {
+		return err
+	}
+	users := make(map[int]string)
+	for rows.Next() {
+		var (
+			userID      int
+			englishName string
+		)
+		if err := rows.Scan(&userID, &englishName); err != nil {
+			rows.Close()
+			return err
+		}
+		users[userID] = englishName
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userID, englishName := range users {
+		if err := syncDepartmentGroups(userID, englishName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func memberIDs(groupID int) ([]int, error) {
+	rows, err := db.Query("SELECT user_id FROM group_member WHERE group_id = ?", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		members = append(members, userID)
+	}
+	return members, rows.Err()
+}
+
+func queryGroup(groupID int) (Group, error) {
+	var (
+		g          Group
+		inviteCode sql.NullString
+	)
+	err := db.QueryRow("SELECT g.group_id, g.name, g.kind, g.invite_code, g.owner_id, COUNT(m.user_id) FROM user_group g "+
+		"LEFT JOIN group_member m ON m.group_id = g.group_id WHERE g.group_id = ? GROUP BY g.group_id", groupID).
+		Scan(&g.GroupID, &g.Name, &g.Kind, &inviteCode, &g.OwnerID, &g.MemberCount)
+	g.InviteCode = inviteCode.String
+	return g, err
+}
+
+func userGroups(userID int) ([]Group, error) {
+	rows, err := db.Query("SELECT g.group_id, g.name, g.kind, g.invite_code, g.owner_id, "+
+		"(SELECT COUNT(*) FROM group_member c WHERE c.group_id = g.group_id) FROM user_group g "+
+		"JOIN group_member m ON m.group_id = g.group_id WHERE m.user_id = ? ORDER BY g.kind, g.group_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var (
+			g          Group
+			inviteCode sql.NullString
+		)
+		if err := rows.Scan(&g.GroupID, &g.Name, &g.Kind, &inviteCode, &g.OwnerID, &g.MemberCount); err != nil {
+			return nil, err
+		}
+		g.InviteCode = inviteCode.String
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// 某一类（kind 为空表示全部）分组以及成员，group_id -> user_id 列表
+func groupMembers(kind GroupKind) (map[int][]int, []Group, error) {
+	query := "SELECT group_id, name, kind FROM user_group"
+	args := []interface{}{}
+	if kind != "" {
+		query += " WHERE kind = ?"
+		args = append(args, kind)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.GroupID, &g.Name, &g.Kind); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = db.Query("SELECT group_id, user_id FROM group_member")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	members := make(map[int][]int)
+	for rows.Next() {
+		var groupID, userID int
+		if err := rows.Scan(&groupID, &userID); err != nil {
+			return nil, nil, err
+		}
+		members[groupID] = append(members[groupID], userID)
+	}
+	return members, groups, rows.Err()
+}
+
+// 用排行榜缓存中的数据汇总一个分组的统计
+func aggregateGroup(g Group, members []int, users map[int]RankRsp) GroupStats {
+	stats := GroupStats{GroupID: g.GroupID, Name: g.Name, Kind: g.Kind, MemberCount: len(members)}
+	settled := 0
+	for _, userID := range members {
+		u, ok := users[userID]
+		if !ok {
+			continue
+		}
+		stats.ActiveCount++
+		stats.TotalMoney += u.Money
+		stats.TotalNetProfit += u.NetProfit
+		stats.BetCount += u.BetCount
+		stats.WinCount += u.WinCount
+		settled += u.SettledCount
+	}
+	if stats.ActiveCount > 0 {
+		stats.AvgNetProfit = Money(roundDiv(int64(stats.TotalNetProfit), int64(stats.ActiveCount)))
+	}
+	stats.WinRate = ratio(float64(stats.WinCount), float64(settled))
+	return stats
+}
+
+func rankUsersByID() map[int]RankRsp {
+	users := make(map[int]RankRsp)
+	for _, u := range rankCache.allBoards()[RankByBalance] {
+		users[u.UserID] = u
+	}
+	return users
+}
+
+func handleGroups(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	groups, err := userGroups(userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query user groups failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+		"groups": groups,
+	})
+}
+
+func handleCreateGroup(c *gin.Context) {
+	var req CreateGroupReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		illegalParametersRsp(c)
+		return
+	}
+
+	inviteCode, err := newInviteCode()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "generate invite code failed, err: %v\n", err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var userCount, groupCount int
+	err = tx.QueryRow("SELECT COUNT(*) FROM user WHERE user_id = ?", req.UserID).Scan(&userCount)
+	if err == nil {
+		err = tx.QueryRow("SELECT COUNT(*) FROM user_group WHERE kind = ? and name = ?",
+			GroupPrivate, req.Name).Scan(&groupCount)
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query group failed, err: %v\n", err)
+		return
+	}
+	if userCount == 0 {
+		userNotExist(c)
+		return
+	}
+	if groupCount > 0 {
+		groupNameExistRsp(c)
+		return
+	}
+
+	now := toDBTime(time.Now())
+	result, err := tx.Exec("INSERT INTO user_group(name, kind, invite_code, owner_id, created_at) VALUES (?,?,?,?,?)",
+		req.Name, GroupPrivate, inviteCode, req.UserID, now)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "insert group failed, err: %v\n", err)
+		return
+	}
+	groupID, err := result.LastInsertId()
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO group_member(group_id, user_id, joined_at) VALUES (?,?,?)", groupID, req.UserID, now)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "create group failed, err: %v\n", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"group_id":    groupID,
+		"invite_code": inviteCode,
+	})
+}
+
+func handleJoinGroup(c *gin.Context) {
+	var req JoinGroupReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var groupID int
+	err := db.QueryRow("SELECT group_id FROM user_group WHERE kind = ? and invite_code = ?",
+		GroupPrivate, strings.ToUpper(strings.TrimSpace(req.InviteCode))).Scan(&groupID)
+	if err == sql.ErrNoRows {
+		groupNotExistRsp(c)
+		return
+	}
+	var count int
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*) FROM user WHERE user_id = ?", req.UserID).Scan(&count)
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query group failed, err: %v\n", err)
+		return
+	}
+	if count == 0 {
+		userNotExist(c)
+		return
+	}
+
+	_, err = db.Exec("INSERT IGNORE INTO group_member(group_id, user_id, joined_at) VALUES (?,?,?)",
+		groupID, req.UserID, toDBTime(time.Now()))
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "join group failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"desc":     "OK",
+		"group_id": groupID,
+	})
+}
+
+// 只能退出私人分组，部门分组由白名单决定
+func handleLeaveGroup(c *gin.Context) {
+	var req LeaveGroupReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	_, err := db.Exec("DELETE m FROM group_member m JOIN user_group g ON g.group_id = m.group_id "+
+		"WHERE m.group_id = ? and m.user_id = ? and g.kind = ?", req.GroupID, req.UserID, GroupPrivate)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "leave group failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+	})
+}
+
+// 分组内的排行榜和汇总统计
+func handleGroupRank(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Query("group_id"))
+	metric, ok := parseRankMetric(c.Query("metric"))
+	page, pageSize, validPage := parsePagination(c)
+	if err != nil || !ok || !validPage {
+		illegalParametersRsp(c)
+		return
+	}
+
+	group, err := queryGroup(groupID)
+	if err == sql.ErrNoRows {
+		groupNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query group failed, err: %v\n", err)
+		return
+	}
+	members, err := memberIDs(groupID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query group members failed, err: %v\n", err)
+		return
+	}
+
+	inGroup := make(map[int]bool)
+	for _, userID := range members {
+		inGroup[userID] = true
+	}
+	board := []RankRsp{}
+	for _, u := range rankCache.allBoards()[metric] {
+		if !inGroup[u.UserID] {
+			continue
+		}
+		// 分组内重新编号，名次变化是全站的，在分组内没有意义
+		u.Rank = len(board) + 1
+		u.PreviousRank, u.Movement = 0, 0
+		board = append(board, u)
+	}
+	ranks, total := paginateRanks(board, page, pageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"group":      aggregateGroup(group, members, rankUsersByID()),
+		"rank":       ranks,
+		"metric":     metric,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
+		"updated_at": rankCache.lastUpdated(),
+	})
+}
+
+// 分组之间的排行榜，默认按人均净盈利排序，避免人多的分组占优
+func handleGroupLeague(c *gin.Context) {
+	kind := GroupKind(c.Query("kind"))
+	if kind != "" && kind != GroupDepartment && kind != GroupPrivate {
+		illegalParametersRsp(c)
+		return
+	}
+	orderBy := c.DefaultQuery("order_by", "avg_net_profit")
+	if orderBy != "avg_net_profit" && orderBy != "total_net_profit" && orderBy != "win_rate" {
+		illegalParametersRsp(c)
+		return
+	}
+
+	members, groups, err := groupMembers(kind)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query group members failed, err: %v\n", err)
+		return
+	}
+	users := rankUsersByID()
+	league := []GroupStats{}
+	for _, g := range groups {
+		stats := aggregateGroup(g, members[g.GroupID], users)
+		if stats.ActiveCount == 0 {
+			continue
+		}
+		league = append(league, stats)
+	}
+	sort.Slice(league, func(i, j int) bool {
+		a, b := league[i], league[j]
+		switch orderBy {
+		case "total_net_profit":
+			if a.TotalNetProfit != b.TotalNetProfit {
+				return a.TotalNetProfit > b.TotalNetProfit
+			}
+		case "win_rate":
+			if a.WinRate != b.WinRate {
+				return a.WinRate > b.WinRate
+			}
+		}
+		if a.AvgNetProfit != b.AvgNetProfit {
+			return a.AvgNetProfit > b.AvgNetProfit
+		}
+		return a.GroupID < b.GroupID
+	})
+	for i := range league {
+		league[i].Rank = i + 1
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"groups":     league,
+		"order_by":   orderBy,
+		"updated_at": rankCache.lastUpdated(),
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 比赛投注分布：按 betting_result 汇总 bet 表。开赛前只公布汇总数据，并且投注人数
+// 达到 insights_min_bettors 才公布，避免通过分布反推出个人的投注；开赛后公布每个人的投注，
+// 结算后公布这场比赛赢得最多的用户
+
+const insightsTopWinners = 5
+
+type OutcomeInsight struct {
+	BettingResult ScheduleStatus `json:"betting_result"`
+	BettorCount   int            `json:"bettor_count"`
+	TotalStake    Money          `json:"total_stake"`
+	StakeShare    float64        `json:"stake_share"`  // 投注额占比
+	BettorShare   float64        `json:"bettor_share"` // 投注人数占比
+}
+
+type InsightBet struct {
+	UserID        int            `json:"user_id"`
+	RTXName       string         `json:"en_name"`
+	ChineseName   string         `json:"cn_name"`
+	BettingResult ScheduleStatus `json:"betting_result"`
+	BettingMoney  Money          `json:"betting_money"`
+	BetStatus     int            `json:"bet_status"`
+	WinMoney      Money          `json:"win_money"`
+}
+
+// scheduleKickedOff 比赛已经公布结果，或者已经到了开赛时间
+func scheduleKickedOff(scheduleTime string, status ScheduleStatus, now time.Time) (bool, error) {
+	if status != NotStarted {
+		return true, nil
+	}
+	t, err := fromDBTime(scheduleTime)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(t), nil
+}
+
+func scheduleBets(scheduleID int) ([]InsightBet, error) {
+	rows, err := db.Query("SELECT b.user_id, u.rtx_name, u.chinese_name, b.betting_result, b.betting_money, "+
+		"b.bet_status, b.win_money FROM bet b JOIN user u ON u.user_id = b.user_id WHERE b.schedule_id = ? "+
+		"ORDER BY b.betting_money DESC, b.user_id", scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bets := []InsightBet{}
+	for rows.Next() {
+		var b InsightBet
+		err := rows.Scan(&b.UserID, &b.RTXName, &b.ChineseName, &b.BettingResult, &b.BettingMoney, &b.BetStatus, &b.WinMoney)
+		if err != nil {
+			return nil, err
+		}
+		bets = append(bets, b)
+	}
+	return bets, rows.Err()
+}
+
+func outcomeInsights(bets []InsightBet) ([]OutcomeInsight, Money) {
+	outcomes := []OutcomeInsight{{BettingResult: HomeTeamWin}, {BettingResult: AwayTeamWin}, {BettingResult: Draw}}
+	var total Money
+	for _, b := range bets {
+		for i := range outcomes {
+			if outcomes[i].BettingResult == b.BettingResult {
+				outcomes[i].BettorCount++
+				outcomes[i].TotalStake += b.BettingMoney
+			}
+		}
+		total += b.BettingMoney
+	}
+	for i := range outcomes {
+		outcomes[i].StakeShare = ratio(float64(outcomes[i].TotalStake), float64(total))
+		outcomes[i].BettorShare = ratio(float64(outcomes[i].BettorCount), float64(len(bets)))
+	}
+	return outcomes, total
+}
+
+func biggestWinners(bets []InsightBet) []InsightBet {
+	winners := []InsightBet{}
+	for _, b := range bets {
+		if b.BetStatus == WinBet && b.WinMoney > 0 {
+			winners = append(winners, b)
+		}
+	}
+	sort.SliceStable(winners, func(i, j int) bool {
+		if winners[i].WinMoney != winners[j].WinMoney {
+			return winners[i].WinMoney > winners[j].WinMoney
+		}
+		return winners[i].UserID < winners[j].UserID
+	})
+	if len(winners) > insightsTopWinners {
+		winners = winners[:insightsTopWinners]
+	}
+	return winners
+}
+
+func handleScheduleInsights(c *gin.Context) {
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var (
+		scheduleTime string
+		status       ScheduleStatus
+	)
+	err = db.QueryRow("SELECT schedule_time, schedule_status FROM schedule WHERE schedule_id = ?", scheduleID).
+		Scan(&scheduleTime, &status)
+	if err == sql.ErrNoRows {
+		scheduleNotExistRsp(c)
+		return
+	}
+	var kickedOff bool
+	if err == nil {
+		kickedOff, err = scheduleKickedOff(scheduleTime, status, time.Now())
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query schedule %v failed, err: %v\n", scheduleID, err)
+		return
+	}
+	bets, err := scheduleBets(scheduleID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query schedule %v bets failed, err: %v\n", scheduleID, err)
+		return
+	}
+	rsp := gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"schedule_id":  scheduleID,
+		"kicked_off":   kickedOff,
+		"settled":      status != NotStarted,
+		"bettor_count": len(bets),
+	}
+	// 开赛前人数不够时不公布分布
+	if !kickedOff && len(bets) < config.InsightsMinBettors {
+		rsp["hidden"] = true
+		c.JSON(http.StatusOK, rsp)
+		return
+	}
+
+	outcomes, total := outcomeInsights(bets)
+	rsp["hidden"] = false
+	rsp["total_stake"] = total
+	rsp["outcomes"] = outcomes
+	if kickedOff {
+		rsp["bets"] = bets
+	}
+	if status != NotStarted {
+		rsp["biggest_winners"] = biggestWinners(bets)
+	}
+	c.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 排行榜在内存中缓存，每次结算之后以及定时刷新，
+// /rank 分页和 /my 查询名次都直接读缓存，不再每次扫整张 user 表
+
+type RankMetric string
+
+const (
+	RankByBalance       RankMetric = "balance"        // 余额
+	RankByNetProfit     RankMetric = "net_profit"     // 净盈利
+	RankByWinRate       RankMetric = "win_rate"       // 胜率
+	RankByROI           RankMetric = "roi"            // 投资回报率
+	RankByLongestStreak RankMetric = "longest_streak" // 最长连胜
+)
+
+var rankMetrics = []RankMetric{RankByBalance, RankByNetProfit, RankByWinRate, RankByROI, RankByLongestStreak}
+
+const (
+	defaultLeaderboardRefresh = time.Minute
+	defaultRankPageSize       = 10
+	maxRankPageSize           = 100
+)
+
+type leaderboard struct {
+	mu        sync.RWMutex
+	updatedAt time.Time
+	boards    map[RankMetric][]RankRsp
+	positions map[RankMetric]map[int]int // user_id -> 名次
+}
+
+var rankCache = &leaderboard{}
+
+func parseRankMetric(s string) (RankMetric, bool) {
+	// 兼容旧的 order_by=money
+	if s == "" || s == "money" {
+		return RankByBalance, true
+	}
+	for _, m := range rankMetrics {
+		if string(m) == s {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+// 投注结算后的统计，用于计算胜率、回报率和连胜
+type bettingStats struct {
+	settled       int
+	wins          int
+	totalStake    Money
+	totalWinMoney Money
+	streak        int
+	longestStreak int
+}
+
+func loadRankUsers() ([]RankRsp, error) {
+	placeholder, args := grantReasonsPlaceholder()
+	rows, err := db.Query("SELECT u.user_id, u.rtx_name, u.chinese_name, u.money, "+
+		"u.money - COALESCE(SUM(l.amount), 0) AS net_profit, u.win_count, u.bet_count FROM user u "+
+		"LEFT JOIN ledger l ON l.user_id = u.user_id and l.reason IN ("+placeholder+") "+
+		"WHERE u.bet_count > 0 GROUP BY u.user_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []RankRsp{}
+	for rows.Next() {
+		var rank RankRsp
+		err := rows.Scan(&rank.UserID, &rank.RTXName, &rank.ChineseName, &rank.Money, &rank.NetProfit,
+			&rank.WinCount, &rank.BetCount)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, rank)
+	}
+	return users, rows.Err()
+}
+
+// 按比赛时间顺序读出所有已结算的投注，计算每个用户的统计
+func loadBettingStats() (map[int]*bettingStats, error) {
+	rows, err := db.Query("SELECT b.user_id, b.betting_money, b.bet_status, b.win_money FROM bet b "+
+		"JOIN schedule s ON s.schedule_id = b.schedule_id WHERE b.bet_status IN (?,?) "+
+		"ORDER BY s.schedule_time, s.schedule_id", WinBet, LostBet)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[int]*bettingStats)
+	for rows.Next() {
+		var (
+			userID    int
+			stake     Money
+			betStatus int
+			winMoney  Money
+		)
+		if err := rows.Scan(&userID, &stake, &betStatus, &winMoney); err != nil {
+			return nil, err
+		}
+		s := stats[userID]
+		if s == nil {
+			s = &bettingStats{}
+			stats[userID] = s
+		}
+		s.settled++
+		s.totalStake += stake
+		s.totalWinMoney += winMoney
+		if betStatus == WinBet {
+			s.wins++
+			s.streak++
+			if s.streak > s.longestStreak {
+				s.longestStreak = s.streak
+			}
+		} else {
+			s.streak = 0
+		}
+	}
+	return stats, rows.Err()
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(a/b*10000) / 10000
+}
+
+// 每个指标的比较函数，指标相同时依次按余额、user_id 排序，保证名次稳定
+func rankLess(metric RankMetric) func(a, b RankRsp) bool {
+	return func(a, b RankRsp) bool {
+		switch metric {
+		case RankByNetProfit:
+			if a.NetProfit != b.NetProfit {
+				return a.NetProfit > b.NetProfit
+			}
+		case RankByWinRate:
+			if a.WinRate != b.WinRate {
+				return a.WinRate > b.WinRate
+			}
+		case RankByROI:
+			if a.ROI != b.ROI {
+				return a.ROI > b.ROI
+			}
+		case RankByLongestStreak:
+			if a.LongestStreak != b.LongestStreak {
+				return a.LongestStreak > b.LongestStreak
+			}
+		}
+		if a.Money != b.Money {
+			return a.Money > b.Money
+		}
+		return a.UserID < b.UserID
+	}
+}
+
+func refreshLeaderboard() error {
+	users, err := loadRankUsers()
+	if err != nil {
+		return err
+	}
+	stats, err := loadBettingStats()
+	if err != nil {
+		return err
+	}
+	baseline, err := baselineRanks(time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if s := stats[users[i].UserID]; s != nil {
+			users[i].SettledCount = s.settled
+			users[i].WinRate = ratio(float64(s.wins), float64(s.settled))
+			users[i].ROI = ratio(float64(s.totalWinMoney), float64(s.totalStake))
+			users[i].LongestStreak = s.longestStreak
+		}
+	}
+
+	boards := make(map[RankMetric][]RankRsp)
+	positions := make(map[RankMetric]map[int]int)
+	for _, metric := range rankMetrics {
+		board := []RankRsp{}
+		for _, u := range users {
+			// 胜率和回报率只统计结算场次足够多的用户，避免一两场就排到最前面
+			if (metric == RankByWinRate || metric == RankByROI) && u.SettledCount < config.RankMinSettledBets {
+				continue
+			}
+			board = append(board, u)
+		}
+		less := rankLess(metric)
+		sort.Slice(board, func(i, j int) bool { return less(board[i], board[j]) })
+
+		positions[metric] = make(map[int]int, len(board))
+		for i := range board {
+			board[i].Rank = i + 1
+			positions[metric][board[i].UserID] = i + 1
+			if prev := baseline[metric][board[i].UserID]; prev > 0 {
+				board[i].PreviousRank = prev
+				board[i].Movement = prev - board[i].Rank
+			}
+		}
+		boards[metric] = board
+	}
+
+	rankCache.mu.Lock()
+	changed := []RankMetric{}
+	for _, metric := range rankMetrics {
+		if !samePositions(rankCache.positions[metric], positions[metric]) {
+			changed = append(changed, metric)
+		}
+	}
+	rankCache.boards = boards
+	rankCache.positions = positions
+	rankCache.updatedAt = time.Now()
+	updatedAt := rankCache.updatedAt
+	rankCache.mu.Unlock()
+
+	if len(changed) > 0 {
+		bus.Publish(EventLeaderboardUpdated, LeaderboardUpdatedEvent{
+			Metrics:   changed,
+			UpdatedAt: updatedAt.In(serverLocation).Format(time.RFC3339),
+		})
+	}
+	return nil
+}
+
+func samePositions(a, b map[int]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for userID, rank := range a {
+		if b[userID] != rank {
+			return false
+		}
+	}
+	return true
+}
+
+// page 返回某个指标下第 page 页的排名（page 从 1 开始）以及总人数
+func (l *leaderboard) page(metric RankMetric, page, pageSize int) ([]RankRsp, int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return paginateRanks(l.boards[metric], page, pageSize)
+}
+
+func paginateRanks(board []RankRsp, page, pageSize int) ([]RankRsp, int) {
+	// 先比较页数，页数很大时 (page-1)*pageSize 不会溢出
+	if page < 1 || page-1 > len(board)/pageSize {
+		return []RankRsp{}, len(board)
+	}
+	start := (page - 1) * pageSize
+	if start >= len(board) {
+		return []RankRsp{}, len(board)
+	}
+	end := start + pageSize
+	if end > len(board) {
+		end = len(board)
+	}
+	result := make([]RankRsp, end-start)
+	copy(result, board[start:end])
+	return result, len(board)
+}
+
+// position 返回用户在某个指标下的名次，不在榜上返回 0
+func (l *leaderboard) position(metric RankMetric, userID int) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.positions[metric][userID]
+}
+
+// movement 返回用户在某个指标下相对上一个比赛日的名次变化，正数表示上升
+func (l *leaderboard) movement(metric RankMetric, userID int) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if rank := l.positions[metric][userID]; rank > 0 {
+		return l.boards[metric][rank-1].Movement
+	}
+	return 0
+}
+
+// allBoards 返回当前所有指标的排行榜，刷新时整体替换，返回的切片不会再被修改
+func (l *leaderboard) allBoards() map[RankMetric][]RankRsp {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.boards
+}
+
+func (l *leaderboard) userRanks(userID int) map[RankMetric]int {
+	ranks := make(map[RankMetric]int, len(rankMetrics))
+	for _, metric := range rankMetrics {
+		ranks[metric] = l.position(metric, userID)
+	}
+	return ranks
+}
+
+func (l *leaderboard) lastUpdated() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.updatedAt.IsZero() {
+		return ""
+	}
+	return l.updatedAt.In(serverLocation).Format(time.RFC3339)
+}
+
+func refreshLeaderboardTask(now time.Time) error {
+	return refreshLeaderboard()
+}
+
+// 结算之后立即刷新一次并保存快照，失败只记录日志，定时任务会再次刷新
+func refreshLeaderboardAfterSettlement(scheduleID int) {
+	if _, err := snapshotLeaderboard(scheduleID); err != nil {
+		fmt.Fprintf(os.Stderr, "snapshot leaderboard after settle schedule %v failed, err: %v\n", scheduleID, err)
+	}
+}
+
+// snapshotLeaderboard 刷新排行榜并保存快照，scheduleID 为 0 表示管理员手动生成
+func snapshotLeaderboard(scheduleID int) (int, error) {
+	if err := refreshLeaderboard(); err != nil {
+		return 0, fmt.Errorf("refresh leaderboard failed: %v", err)
+	}
+	now := time.Now()
+	boards := rankCache.allBoards()
+	snapshotID, err := takeLeaderboardSnapshot(scheduleID, boards, now)
+	if err != nil {
+		return 0, err
+	}
+	top := make(map[RankMetric][]RankRsp, len(boards))
+	for metric, board := range boards {
+		top[metric], _ = paginateRanks(board, 1, snapshotTopSize)
+	}
+	bus.Publish(EventLeaderboardSnapshot, LeaderboardSnapshotEvent{
+		SnapshotID: snapshotID,
+		ScheduleID: scheduleID,
+		CreatedAt:  now.In(serverLocation).Format(time.RFC3339),
+		Top:        top,
+	})
+	return snapshotID, nil
+}
+
+// 快照事件里每个指标带上前几名
+const snapshotTopSize = 10
+
+// 解析分页参数，兼容旧的 limit 参数
+func parsePagination(c *gin.Context) (int, int, bool) {
+	page, pageSize := 1, defaultRankPageSize
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return 0, 0, false
+		}
+		pageSize = n
+	}
+	if size := c.Query("page_size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return 0, 0, false
+		}
+		pageSize = n
+	}
+	if p := c.Query("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, 0, false
+		}
+		page = n
+	}
+	// 限制页数，调用方算 (page-1)*pageSize 作为 OFFSET 时不会溢出成负数
+	if page < 1 || pageSize < 1 || pageSize > maxRankPageSize || page > math.MaxInt32/pageSize {
+		return 0, 0, false
+	}
+	return page, pageSize, true
+}
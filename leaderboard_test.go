@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query          string
+		page, pageSize int
+		ok             bool
+	}{
+		{"", 1, defaultRankPageSize, true},
+		{"page=3&page_size=20", 3, 20, true},
+		{"limit=5", 1, 5, true},
+		{"limit=5&page_size=7", 1, 7, true},
+		{"page=0", 0, 0, false},
+		{"page=-1", 0, 0, false},
+		{"page_size=0", 0, 0, false},
+		{"page_size=101", 0, 0, false},
+		{"page=x", 0, 0, false},
+		{"page=4611686018427387904&page_size=4", 0, 0, false},
+		{"page=536870912&page_size=4", 0, 0, false},
+		{"page=536870911&page_size=4", 536870911, 4, true},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/rank?"+tt.query, nil)
+		page, pageSize, ok := parsePagination(c)
+		if ok != tt.ok || page != tt.page || pageSize != tt.pageSize {
+			t.Errorf("parsePagination(%q) = %v, %v, %v, want %v, %v, %v",
+				tt.query, page, pageSize, ok, tt.page, tt.pageSize, tt.ok)
+		}
+	}
+}
+
+func TestPaginateRanks(t *testing.T) {
+	board := make([]RankRsp, 5)
+	for i := range board {
+		board[i].UserID = i + 1
+	}
+	tests := []struct {
+		page, pageSize int
+		want           []int
+	}{
+		{1, 2, []int{1, 2}},
+		{2, 2, []int{3, 4}},
+		{3, 2, []int{5}},
+		{4, 2, []int{}},
+		{1, 10, []int{1, 2, 3, 4, 5}},
+		{4611686018427387904, 4, []int{}},
+		{0, 2, []int{}},
+	}
+	for _, tt := range tests {
+		got, total := paginateRanks(board, tt.page, tt.pageSize)
+		ids := []int{}
+		for _, r := range got {
+			ids = append(ids, r.UserID)
+		}
+		if total != len(board) || len(ids) != len(tt.want) {
+			t.Errorf("paginateRanks(page %v, size %v) = %v, %v, want %v", tt.page, tt.pageSize, ids, total, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("paginateRanks(page %v, size %v) = %v, want %v", tt.page, tt.pageSize, ids, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户金币的每一次变动都要记一笔账，user.money 只是账本余额的缓存。
+// 账本是复式的：ledger 是用户一方，house_ledger 是系统账户一方，每笔账两边金额相反，对账时检查加起来为 0
+
+type LedgerReason string
+
+const (
+	LedgerOpeningBalance LedgerReason = "opening_balance" // 上线账本时已有的余额
+	LedgerInitialGrant   LedgerReason = "initial_grant"   // 第一次登陆赠送
+	LedgerDailyReward    LedgerReason = "daily_reward"    // 每日奖励
+	LedgerStreakBonus    LedgerReason = "streak_bonus"    // 连续领取奖励
+	LedgerMatchDayBonus  LedgerReason = "match_day_bonus" // 比赛日奖励
+	LedgerBrokeTopUp     LedgerReason = "broke_top_up"    // 余额过低补助
+	LedgerRebuy          LedgerReason = "rebuy"           // 破产重买
+	LedgerStake          LedgerReason = "stake"           // 投注扣款
+	LedgerPayout         LedgerReason = "payout"          // 赢得投注后派彩（含本金）
+	LedgerRefund         LedgerReason = "refund"          // 退还本金
+
+	LedgerChallengeEscrow LedgerReason = "challenge_escrow" // 挑战本金托管
+	LedgerChallengePayout LedgerReason = "challenge_payout" // 赢得挑战，拿走双方本金
+	LedgerChallengeRefund LedgerReason = "challenge_refund" // 挑战取消或过期，退还本金
+
+	LedgerAdminGrant      LedgerReason = "admin_grant"      // 管理员发放或扣除，不算输赢
+	LedgerAdminCorrection LedgerReason = "admin_correction" // 管理员修正结算，算作输赢
+)
+
+// 系统发放的金币，不算用户赢来的，计算净盈利时要扣除
+var grantLedgerReasons = []LedgerReason{
+	LedgerOpeningBalance, LedgerInitialGrant, LedgerDailyReward,
+	LedgerStreakBonus, LedgerMatchDayBonus, LedgerBrokeTopUp, LedgerRebuy, LedgerAdminGrant,
+}
+
+// 拼接 SQL 中 reason IN (...) 的占位符和参数
+func grantReasonsPlaceholder() (string, []interface{}) {
+	placeholder := ""
+	args := make([]interface{}, len(grantLedgerReasons))
+	for i, reason := range grantLedgerReasons {
+		if i > 0 {
+			placeholder += ","
+		}
+		placeholder += "?"
+		args[i] = reason
+	}
+	return placeholder, args
+}
+
+// 账目关联的对象类型
+const (
+	RefNone      = ""
+	RefSchedule  = "schedule"
+	RefChallenge = "challenge"
+)
+
+const defaultReconcileInterval = time.Hour
+
+var errUserNotExist = errors.New("user is not exist")
+
+type LedgerEntry struct {
+	EntryID   int64        `json:"entry_id"`
+	UserID    int          `json:"user_id"`
+	Amount    Money        `json:"amount"`  // 正数为入账，负数为出账
+	Balance   Money        `json:"balance"` // 记账之后的余额
+	Reason    LedgerReason `json:"reason"`
+	RefType   string       `json:"ref_type,omitempty"`
+	RefID     int          `json:"ref_id,omitempty"`
+	Note      string       `json:"note,omitempty"` // 管理员调整余额时写的备注
+	CreatedAt string       `json:"created_at"`
+}
+
+type LedgerMismatch struct {
+	UserID        int   `json:"user_id"`
+	Money         Money `json:"money"`          // user 表中的余额
+	LedgerBalance Money `json:"ledger_balance"` // 账本汇总出来的余额
+}
+
+// postLedger 在事务中变动用户余额并记一笔账，返回记账后的余额。
+// 先 FOR UPDATE 锁住用户这一行，保证同一用户的并发变动串行执行
+func postLedger(tx *sql.Tx, userID int, amount Money, reason LedgerReason, refType string, refID int) (Money, error) {
+	var money Money
+	err := tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", userID).Scan(&money)
+	if err == sql.ErrNoRows {
+		return 0, errUserNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	balance := money + amount
+	if _, err := tx.Exec("UPDATE user SET money = ? WHERE user_id = ?", balance, userID); err != nil {
+		return 0, err
+	}
+	now := toDBTime(time.Now())
+	result, err := tx.Exec("INSERT INTO ledger(user_id, amount, balance, reason, ref_type, ref_id, created_at) "+
+		"VALUES (?,?,?,?,?,?,?)", userID, amount, balance, reason, refType, refID, now)
+	if err != nil {
+		return 0, err
+	}
+	entryID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	// 系统账户的对应分录，house_ledger 没有自增列，不影响调用方用 LAST_INSERT_ID() 取 entry_id
+	_, err = tx.Exec("INSERT INTO house_ledger(entry_id, amount, reason, ref_type, ref_id, created_at) VALUES (?,?,?,?,?,?)",
+		entryID, -amount, reason, refType, refID, now)
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func ledgerEntries(userID int, limit int) ([]LedgerEntry, error) {
+	rows, err := db.Query("SELECT l.entry_id, l.user_id, l.amount, l.balance, l.reason, l.ref_type, l.ref_id, "+
+		"COALESCE(a.note, ''), l.created_at FROM ledger l LEFT JOIN balance_adjustment a ON a.entry_id = l.entry_id "+
+		"WHERE l.user_id = ? ORDER BY l.entry_id DESC LIMIT ?", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		err := rows.Scan(&e.EntryID, &e.UserID, &e.Amount, &e.Balance, &e.Reason, &e.RefType, &e.RefID, &e.Note, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.CreatedAt = formatAPITime(e.CreatedAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// reconcileLedger 核对每个用户 user.money 和账本汇总是否一致
+func reconcileLedger() ([]LedgerMismatch, error) {
+	rows, err := db.Query("SELECT u.user_id, u.money, COALESCE(SUM(l.amount), 0) FROM user u " +
+		"LEFT JOIN ledger l ON l.user_id = u.user_id GROUP BY u.user_id, u.money")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mismatches := []LedgerMismatch{}
+	for rows.Next() {
+		var m LedgerMismatch
+		if err := rows.Scan(&m.UserID, &m.Money, &m.LedgerBalance); err != nil {
+			return nil, err
+		}
+		if m.Money != m.LedgerBalance {
+			mismatches = append(mismatches, m)
+		}
+	}
+	return mismatches, rows.Err()
+}
+
+// unbalancedEntries 返回两边对不上的账目：缺少系统账户分录，或者金额不是相反数，
+// 以及系统账户多出来的分录。账目都对上时两边总额加起来为 0
+func unbalancedEntries() ([]int64, error) {
+	rows, err := db.Query("SELECT l.entry_id FROM ledger l LEFT JOIN house_ledger h ON h.entry_id = l.entry_id " +
+		"WHERE h.entry_id IS NULL or h.amount != -l.amount UNION " +
+		"SELECT h.entry_id FROM house_ledger h LEFT JOIN ledger l ON l.entry_id = h.entry_id WHERE l.entry_id IS NULL " +
+		"ORDER BY 1 LIMIT 1000")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entryIDs := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		entryIDs = append(entryIDs, id)
+	}
+	return entryIDs, rows.Err()
+}
+
+var (
+	reconcileMu         sync.Mutex
+	lastReconcileTime   string
+	lastReconcileResult = []LedgerMismatch{}
+	lastUnbalanced      = []int64{}
+)
+
+func runReconciliation(now time.Time) error {
+	mismatches, err := reconcileLedger()
+	if err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		fmt.Fprintf(os.Stderr, "[reconcile] user %v money %v does not match ledger balance %v\n",
+			m.UserID, m.Money, m.LedgerBalance)
+	}
+	unbalanced, err := unbalancedEntries()
+	if err != nil {
+		return err
+	}
+	if len(unbalanced) > 0 {
+		fmt.Fprintf(os.Stderr, "[reconcile] %v ledger entries have no matching house entry, first: %v\n",
+			len(unbalanced), unbalanced[0])
+	}
+
+	reconcileMu.Lock()
+	lastReconcileTime = now.In(serverLocation).Format(time.RFC3339)
+	lastReconcileResult = mismatches
+	lastUnbalanced = unbalanced
+	reconcileMu.Unlock()
+	return nil
+}
+
+func handleTransactions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 500 {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+
+	entries, err := ledgerEntries(userID, limit)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query ledger failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"transactions": entries,
+	})
+}
+
+// 管理员手动触发一次对账，返回所有不一致的用户
+func handleReconcile(c *gin.Context) {
+	if err := runReconciliation(time.Now()); err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "reconcile ledger failed, err: %v\n", err)
+		return
+	}
+
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"status":             0,
+		"desc":               "OK",
+		"checked_at":         lastReconcileTime,
+		"mismatches":         lastReconcileResult,
+		"unbalanced_entries": lastUnbalanced,
+		"consistent":         len(lastReconcileResult) == 0 && len(lastUnbalanced) == 0,
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/GhostComputing/worldcup-betting/types"
 	"github.com/gin-gonic/gin"
 	"github.com/go-sql-driver/mysql"
 	"github.com/spf13/viper"
@@ -25,6 +26,9 @@ func sqlDB() *sql.DB {
 		Addr:                 config.MySQLAddr,
 		DBName:               config.MySQLDBName,
 		AllowNativePasswords: true,
+		Loc:                  time.UTC,
+		// 会话时区固定为 UTC，NOW() 和 TIMESTAMP 列也都按 UTC 读写
+		Params: map[string]string{"time_zone": "'+00:00'"},
 	}
 	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
@@ -53,6 +57,18 @@ func parseConfig() {
 	}
 }
 
+const scheduleColumns = "schedule_id, home_team, away_team, home_team_win_odds, away_team_win_odds, tied_odds, " +
+	"schedule_time, schedule_group, schedule_type, schedule_status, disable_betting, enable_display, betting_mode, " +
+	"home_score, away_score"
+
+func scanSchedule(rows *sql.Rows, schedule *Schedule) error {
+	return rows.Scan(&schedule.ScheduleID, &schedule.HomeTeam, &schedule.AwayTeam,
+		&schedule.HomeTeamWinOdds, &schedule.AwayTeamWinOdds, &schedule.TiedOdds,
+		&schedule.ScheduleTime, &schedule.ScheduleGroup, &schedule.ScheduleType,
+		&schedule.ScheduleStatus, &schedule.DisableBetting, &schedule.EnableDisplay, &schedule.BettingMode,
+		&schedule.HomeScore, &schedule.AwayScore)
+}
+
 func schedules(db *sql.DB, scheduleType ScheduleType) ([]Schedule2, error) {
 	var (
 		schedules []Schedule2
@@ -61,11 +77,16 @@ func schedules(db *sql.DB, scheduleType ScheduleType) ([]Schedule2, error) {
 	)
 
 	if scheduleType == All {
-		rows, err = db.Query("SELECT * FROM schedule")
+		rows, err = db.Query("SELECT " + scheduleColumns + " FROM schedule")
 	} else {
-		rows, err = db.Query("SELECT * FROM schedule WHERE schedule_type = ?", scheduleType)
+		rows, err = db.Query("SELECT "+scheduleColumns+" FROM schedule WHERE schedule_type = ?", scheduleType)
+	}
+	if err != nil {
+		return []Schedule2{}, err
 	}
 	defer rows.Close()
+
+	stakes, err := poolStakes(db)
 	if err != nil {
 		return []Schedule2{}, err
 	}
@@ -75,10 +96,7 @@ func schedules(db *sql.DB, scheduleType ScheduleType) ([]Schedule2, error) {
 			schedule  Schedule
 			schedule2 Schedule2
 		)
-		err := rows.Scan(&schedule.ScheduleID, &schedule.HomeTeam, &schedule.AwayTeam,
-			&schedule.HomeTeamWinOdds, &schedule.AwayTeamWinOdds, &schedule.TiedOdds,
-			&schedule.ScheduleTime, &schedule.ScheduleGroup, &schedule.ScheduleType,
-			&schedule.ScheduleStatus, &schedule.DisableBetting, &schedule.EnableDisplay)
+		err := scanSchedule(rows, &schedule)
 		if err != nil {
 			return []Schedule2{}, err
 		}
@@ -89,12 +107,18 @@ func schedules(db *sql.DB, scheduleType ScheduleType) ([]Schedule2, error) {
 		schedule2.HomeTeamWinOdds = schedule.HomeTeamWinOdds
 		schedule2.AwayTeamWinOdds = schedule.AwayTeamWinOdds
 		schedule2.TiedOdds = schedule.TiedOdds
-		schedule2.ScheduleTime = schedule.ScheduleTime
+		schedule2.ScheduleTime = formatAPITime(schedule.ScheduleTime)
 		schedule2.ScheduleGroup = schedule.ScheduleGroup
 		schedule2.ScheduleType = schedule.ScheduleType
 		schedule2.DisableBetting = schedule.DisableBetting
 		schedule2.ScheduleStatus = schedule.ScheduleStatus
 		schedule2.EnableDisplay = schedule.EnableDisplay
+		schedule2.BettingMode = schedule.BettingMode
+		schedule2.HomeScore = schedule.HomeScore
+		schedule2.AwayScore = schedule.AwayScore
+		if schedule.BettingMode == PoolBetting {
+			fillPoolOdds(&schedule2, stakes[schedule.ScheduleID])
+		}
 
 		schedules = append(schedules, schedule2)
 	}
@@ -109,9 +133,9 @@ func schedules2(db *sql.DB, scheduleType ScheduleType) ([]Schedule, error) {
 	)
 
 	if scheduleType == All {
-		rows, err = db.Query("SELECT * FROM schedule")
+		rows, err = db.Query("SELECT " + scheduleColumns + " FROM schedule")
 	} else {
-		rows, err = db.Query("SELECT * FROM schedule WHERE schedule_type = ?", scheduleType)
+		rows, err = db.Query("SELECT "+scheduleColumns+" FROM schedule WHERE schedule_type = ?", scheduleType)
 	}
 	if err != nil {
 		return []Schedule{}, err
@@ -121,13 +145,11 @@ func schedules2(db *sql.DB, scheduleType ScheduleType) ([]Schedule, error) {
 		var (
 			schedule Schedule
 		)
-		err := rows.Scan(&schedule.ScheduleID, &schedule.HomeTeam, &schedule.AwayTeam,
-			&schedule.HomeTeamWinOdds, &schedule.AwayTeamWinOdds, &schedule.TiedOdds,
-			&schedule.ScheduleTime, &schedule.ScheduleGroup, &schedule.ScheduleType,
-			&schedule.ScheduleStatus, &schedule.DisableBetting, &schedule.EnableDisplay)
+		err := scanSchedule(rows, &schedule)
 		if err != nil {
 			return []Schedule{}, err
 		}
+		schedule.ScheduleTime = formatAPITime(schedule.ScheduleTime)
 
 		schedules = append(schedules, schedule)
 	}
@@ -206,90 +228,120 @@ func handleSchedules2(c *gin.Context) {
 
 func handleUpdateSchedule(c *gin.Context) {
 	var schedule Schedule
-	if c.Bind(&schedule) != nil {
+	if c.Bind(&schedule) != nil || normalizeScheduleTime(&schedule) != nil {
 		illegalParametersRsp(c)
 		return
 	}
 
-	// 先验证要更新的赛程是在数据库中
-	rows, err := db.Query("SELECT * FROM schedule WHERE schedule_id = ?", schedule.ScheduleID)
-	defer rows.Close()
+	// 更新赛程和结算在同一个事务里，和自动导入比赛结果的 applyResult 一样，不会出现有结果但没有结算的比赛
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// 先验证要更新的赛程是在数据库中，同时锁住赛程
+	var (
+		bettingMode                        BettingMode
+		homeWinOdds, awayWinOdds, tiedOdds Odds
+		status                             ScheduleStatus
+		homeScore, awayScore               *int
+		settled                            bool
+	)
+	err = tx.QueryRow("SELECT betting_mode, home_team_win_odds, away_team_win_odds, tied_odds, schedule_status, "+
+		"home_score, away_score, settled_at IS NOT NULL FROM schedule WHERE schedule_id = ? FOR UPDATE", schedule.ScheduleID).
+		Scan(&bettingMode, &homeWinOdds, &awayWinOdds, &tiedOdds, &status, &homeScore, &awayScore, &settled)
+	if err == sql.ErrNoRows { // 赛事必须已在 schedule 表中才能更新成功
+		scheduleNotExistRsp(c)
+		return
+	}
 	if err != nil {
 		operateMySQLFailedRsp(c)
 		fmt.Fprintf(os.Stderr, "query schedule failed, err: %v\n", err)
 		return
 	}
-	if rows.Next() {
-		// 验证赛事的结果的合法性
-		if ScheduleStatus(schedule.ScheduleStatus) >= HomeTeamWin || ScheduleStatus(schedule.ScheduleStatus) <= Draw {
-			stmt, err := db.Prepare("UPDATE schedule SET home_team = ?, away_team = ?, " +
-				"home_team_win_odds = ?, away_team_win_odds = ?, tied_odds = ?, " +
-				"schedule_time = ?, schedule_group = ?, schedule_type = ?, " +
-				"schedule_status = ?, disable_betting = ?, enable_display = ? " + " WHERE schedule_id = ?")
-			if err != nil {
-				updateMySQLFailedRsp(c)
-				fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
-				return
-			}
-			result, err := stmt.Exec(schedule.HomeTeam, schedule.AwayTeam,
-				schedule.HomeTeamWinOdds, schedule.AwayTeamWinOdds, schedule.TiedOdds,
-				schedule.ScheduleTime, schedule.ScheduleGroup, schedule.ScheduleType, schedule.ScheduleStatus,
-				schedule.DisableBetting, schedule.EnableDisplay, schedule.ScheduleID)
-			defer stmt.Close()
-			if err != nil {
-				operateMySQLFailedRsp(c)
-				fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
-				return
-			}
+	// 已经取消的比赛投注都退还了，不能再录入结果；已经结算的比赛按原来的结果派过彩，不能再改结果和比分
+	if status == Voided || (settled && (schedule.ScheduleStatus != status ||
+		scoreChanged(homeScore, schedule.HomeScore) || scoreChanged(awayScore, schedule.AwayScore))) {
+		scheduleFinishedRsp(c)
+		return
+	}
 
-			// 遍历竞猜表，计算出每个人竞猜的结果，如果竞猜成功，增加相应用户的金币数
-			var betRequest BetRequest
-			rows, _ := db.Query("SELECT * FROM bet WHERE schedule_id = ? and bet_status = ?",
-				schedule.ScheduleID, BetNotFinish)
-			for rows.Next() {
-				rows.Scan(&betRequest.UserId, &betRequest.ScheduleId, &betRequest.BettingMoney, &betRequest.BettingResult,
-					&betRequest.BettingOdds, &betRequest.BettingStatus, &betRequest.WinMoney)
-				// 说明竞猜成功
-				var (
-					money     float64
-					win_count int
-					win_money float64
-					betStatus BetStatus
-				)
-				if ScheduleStatus(betRequest.BettingResult) == ScheduleStatus(schedule.ScheduleStatus) {
-					betStatus = WinBet
-					rows, _ := db.Query("SELECT money,win_count FROM user WHERE user_id = ?", betRequest.UserId)
-					if rows.Next() {
-						rows.Scan(&money, &win_count)
-					}
-					stmt, _ := db.Prepare("UPDATE user SET money = ?,win_count = ? WHERE user_id = ?")
-					win_money = float64(betRequest.BettingMoney) * (betRequest.BettingOdds)
-					currentMoney := win_money + money + float64(betRequest.BettingMoney)
-					stmt.Exec(currentMoney, win_count+1, betRequest.UserId)
-				} else {
-					betStatus = LostBet
-					win_money = -float64(betRequest.BettingMoney)
-				}
-				stmt, _ := db.Prepare("UPDATE bet SET bet_status = ?,win_money = ? WHERE user_id = ? and schedule_id = ?")
-				stmt.Exec(betStatus, win_money, betRequest.UserId, betRequest.ScheduleId)
-			}
+	// 验证赛事的结果的合法性
+	if schedule.ScheduleStatus < NotStarted || schedule.ScheduleStatus > Draw ||
+		!validKnockoutResult(schedule.ScheduleType, schedule.ScheduleStatus) ||
+		!validScore(schedule.HomeScore) || !validScore(schedule.AwayScore) ||
+		!validResultScore(schedule.ScheduleType, schedule.ScheduleStatus,
+			orOldScore(schedule.HomeScore, homeScore), orOldScore(schedule.AwayScore, awayScore)) {
+		illegalParametersRsp(c)
+		return
+	}
 
-			c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
-			return
-		} else {
-			illegalParametersRsp(c)
+	// 没有传比分时保留原来的比分
+	_, err = tx.Exec("UPDATE schedule SET home_team = ?, away_team = ?, "+
+		"home_team_win_odds = ?, away_team_win_odds = ?, tied_odds = ?, "+
+		"schedule_time = ?, schedule_group = ?, schedule_type = ?, "+
+		"schedule_status = ?, disable_betting = ?, enable_display = ?, "+
+		"home_score = COALESCE(?, home_score), away_score = COALESCE(?, away_score) WHERE schedule_id = ?",
+		schedule.HomeTeam, schedule.AwayTeam,
+		schedule.HomeTeamWinOdds, schedule.AwayTeamWinOdds, schedule.TiedOdds,
+		schedule.ScheduleTime, schedule.ScheduleGroup, schedule.ScheduleType, schedule.ScheduleStatus,
+		schedule.DisableBetting, schedule.EnableDisplay, schedule.HomeScore, schedule.AwayScore, schedule.ScheduleID)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "update schedule failed, err: %v\n", err)
+		return
+	}
+
+	// 比赛有了结果之后才结算投注，投注模式以建赛程时为准，不允许中途修改
+	var changed bool
+	if schedule.ScheduleStatus != NotStarted {
+		if changed, err = settleScheduleTx(tx, schedule.ScheduleID, schedule.ScheduleStatus, bettingMode); err != nil {
+			operateMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "settle schedule %v failed, err: %v\n", schedule.ScheduleID, err)
 			return
 		}
-
-	} else { // 赛事必须已在 schedule 表中才能更新成功
-		scheduleNotExistRsp(c)
+	}
+	if err := tx.Commit(); err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "commit schedule update failed, err: %v\n", err)
 		return
 	}
+
+	oddsChanged := schedule.HomeTeamWinOdds != homeWinOdds || schedule.AwayTeamWinOdds != awayWinOdds ||
+		schedule.TiedOdds != tiedOdds
+	if schedule.ScheduleStatus == NotStarted && bettingMode == FixedOddsBetting && oddsChanged {
+		bus.Publish(EventOddsChanged, OddsChangedEvent{
+			ScheduleID:      schedule.ScheduleID,
+			HomeTeamWinOdds: schedule.HomeTeamWinOdds,
+			AwayTeamWinOdds: schedule.AwayTeamWinOdds,
+			TiedOdds:        schedule.TiedOdds,
+		})
+	}
+
+	recordAudit(c, auditRecord{
+		Action:     "update_schedule",
+		TargetType: RefSchedule,
+		TargetID:   schedule.ScheduleID,
+		ScheduleID: schedule.ScheduleID,
+		Before: gin.H{"home_team_win_odds": homeWinOdds, "away_team_win_odds": awayWinOdds,
+			"tied_odds": tiedOdds, "schedule_status": status},
+		After: schedule,
+	})
+
+	if changed {
+		if err := afterSettlement(schedule.ScheduleID, schedule.ScheduleStatus, bettingMode); err != nil {
+			fmt.Fprintf(os.Stderr, "finish schedule %v failed, err: %v\n", schedule.ScheduleID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
 }
 
 func handleNewSchedule(c *gin.Context) {
 	var schedule Schedule
-	if c.Bind(&schedule) != nil {
+	if c.Bind(&schedule) != nil || normalizeScheduleTime(&schedule) != nil {
 		illegalParametersRsp(c)
 		return
 	}
@@ -305,8 +357,8 @@ func handleNewSchedule(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "schedule_id": id})
 	} else {
 		stmt, err := db.Prepare("INSERT INTO " +
-			"schedule(home_team,away_team,home_team_win_odds,away_team_win_odds,tied_odds,schedule_time,schedule_group,schedule_type,schedule_status,disable_betting,enable_display) " +
-			"VALUES (?,?,?,?,?,?,?,?,?,?,?)")
+			"schedule(home_team,away_team,home_team_win_odds,away_team_win_odds,tied_odds,schedule_time,schedule_group,schedule_type,schedule_status,disable_betting,enable_display,betting_mode) " +
+			"VALUES (?,?,?,?,?,?,?,?,?,?,?,?)")
 		if err != nil {
 			operateMySQLFailedRsp(c)
 			fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
@@ -315,7 +367,7 @@ func handleNewSchedule(c *gin.Context) {
 		result, err := stmt.Exec(schedule.HomeTeam, schedule.AwayTeam,
 			schedule.HomeTeamWinOdds, schedule.AwayTeamWinOdds, schedule.TiedOdds,
 			schedule.ScheduleTime, schedule.ScheduleGroup, schedule.ScheduleType,
-			schedule.ScheduleStatus, schedule.DisableBetting, schedule.EnableDisplay)
+			schedule.ScheduleStatus, schedule.DisableBetting, schedule.EnableDisplay, schedule.BettingMode)
 		defer stmt.Close()
 		if err != nil {
 			operateMySQLFailedRsp(c)
@@ -328,6 +380,22 @@ func handleNewSchedule(c *gin.Context) {
 			fmt.Fprintf(os.Stderr, "insert schedule failed, result:%v, err: %v\n", result, err)
 			return
 		}
+		schedule.ScheduleID = int(lastId)
+		recordAudit(c, auditRecord{
+			Action:     "new_schedule",
+			TargetType: RefSchedule,
+			TargetID:   schedule.ScheduleID,
+			ScheduleID: schedule.ScheduleID,
+			After:      schedule,
+		})
+		bus.Publish(EventScheduleCreated, ScheduleCreatedEvent{
+			ScheduleID:   int(lastId),
+			HomeTeam:     countryToID(schedule.HomeTeam),
+			AwayTeam:     countryToID(schedule.AwayTeam),
+			ScheduleTime: formatAPITime(schedule.ScheduleTime),
+			ScheduleType: schedule.ScheduleType,
+			BettingMode:  schedule.BettingMode,
+		})
 		c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "schedule_id": lastId})
 	}
 }
@@ -338,15 +406,22 @@ func handleBet(c *gin.Context) {
 		illegalParametersRsp(c)
 		return
 	}
+	if betRequest.BettingMoney <= 0 ||
+		ScheduleStatus(betRequest.BettingResult) < HomeTeamWin || ScheduleStatus(betRequest.BettingResult) > Draw {
+		illegalParametersRsp(c)
+		return
+	}
 
 	// 验证这场赛事已经可以下注
 	var (
 		disableBetting bool
 		scheduleTime   string
+		bettingMode    BettingMode
 		betTime        int64 = time.Now().Unix()
 	)
 
-	rows, err := db.Query("SELECT disable_betting,schedule_time FROM schedule WHERE schedule_id = ?", betRequest.ScheduleId)
+	rows, err := db.Query("SELECT disable_betting,schedule_time,betting_mode,"+
+		"home_team_win_odds,away_team_win_odds,tied_odds FROM schedule WHERE schedule_id = ?", betRequest.ScheduleId)
 	handleError(err)
 	defer rows.Close()
 	if err != nil {
@@ -355,7 +430,8 @@ func handleBet(c *gin.Context) {
 		return
 	}
 	if rows.Next() {
-		err := rows.Scan(&disableBetting, &scheduleTime)
+		var homeTeamWinOdds, awayTeamWinOdds, tiedOdds Odds
+		err := rows.Scan(&disableBetting, &scheduleTime, &bettingMode, &homeTeamWinOdds, &awayTeamWinOdds, &tiedOdds)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "scan rows: %v failed, error: %v\n", rows, err)
 			operateMySQLFailedRsp(c)
@@ -365,99 +441,127 @@ func handleBet(c *gin.Context) {
 			disableBet(c)
 			return
 		} else {
-			// 验证是不是超过投注时间
-			t, err := time.Parse("2006-01-02 15:04:05", scheduleTime)
+			// 验证是不是超过投注时间，后台调度器通常已经关掉了，这里兜底
+			deadline, err := bettingDeadline(scheduleTime)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintf(os.Stderr, "parse schedule time %v failed, err: %v\n", scheduleTime, err)
 			}
-			if betTime > t.Unix() {
-				stmt, err := db.Prepare("UPDATE schedule SET disable_betting = ? WHERE schedule_id = ?")
-				defer stmt.Close()
-				if err != nil {
-					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
-					return
-				}
+			if betTime >= deadline.Unix() {
 				// 把这场比赛设置为不可投注
-				result, err := stmt.Exec(true, betRequest.ScheduleId)
-				if err != nil {
+				if err := closeBetting(betRequest.ScheduleId, scheduleTime); err != nil {
 					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
+					fmt.Fprintf(os.Stderr, "update schedule failed, err: %v\n", err)
 					return
 				}
 				overSchedueTime(c)
 				return
 			}
-			// 验证用户是否已经对这场比赛下过注
-			rows, err := db.Query("SELECT * FROM bet WHERE user_id = ? and schedule_id = ?",
-				betRequest.UserId, betRequest.ScheduleId)
-			defer rows.Close()
-			if rows.Next() {
-				alreadyBet(c)
+			// 下注、扣款、记账放在同一个事务中
+			tx, err := db.Begin()
+			if err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
 				return
 			}
+			defer tx.Rollback()
 
+			// 验证用户是否已经对这场比赛下过注
 			var betCount int
+			err = tx.QueryRow("SELECT COUNT(*) FROM bet WHERE user_id = ? and schedule_id = ?",
+				betRequest.UserId, betRequest.ScheduleId).Scan(&betCount)
+			if err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "query mysql failed, err: %v\n", err)
+				return
+			}
+			if betCount > 0 {
+				alreadyBet(c)
+				return
+			}
 
-			// 验证用户是否有足够的钱进行下注
-			rows, err = db.Query("SELECT money, bet_count FROM user WHERE user_id = ?", betRequest.UserId)
+			// 验证用户是否有足够的钱进行下注，FOR UPDATE 锁住用户，避免并发下注透支
+			var money Money
+			err = tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", betRequest.UserId).Scan(&money)
+			if err == sql.ErrNoRows {
+				userNotExist(c)
+				return
+			}
 			if err != nil {
 				operateMySQLFailedRsp(c)
 				fmt.Fprintf(os.Stderr, "query mysql failed, err: %v\n", err)
 				return
 			}
-			if rows.Next() {
-				var money float64
-				err := rows.Scan(&money, &betCount)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "scan rows: %v failed, error: %v\n", rows, err)
-					operateMySQLFailedRsp(c)
-					return
-				}
 
-				// 如果用户已经没有足够的钱下注
-				if int(money) < betRequest.BettingMoney {
-					notEnoughMoney(c)
-					return
-				}
+			// 如果用户已经没有足够的钱下注
+			if money < betRequest.BettingMoney {
+				notEnoughMoney(c)
+				return
+			}
 
-				// 在 bet 表插入相应的记录
-				stmt, err := db.Prepare("INSERT INTO " +
-					"bet(user_id,schedule_id,betting_money,betting_result,betting_odds,bet_status,win_money) " +
-					"VALUES (?,?,?,?,?,?,?)")
-				defer stmt.Close()
-				if err != nil {
-					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
-					return
-				}
-				result, err := stmt.Exec(betRequest.UserId, betRequest.ScheduleId,
-					betRequest.BettingMoney, betRequest.BettingResult, betRequest.BettingOdds, 0, BetNotFinish)
-				if err != nil {
-					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "insert schedule failed, result:%v, err: %v\n", result, err)
-					return
-				}
+			// 赔率以赛程中的为准，不信任客户端传来的值；奖池模式下赔率要到结算时才确定
+			switch ScheduleStatus(betRequest.BettingResult) {
+			case HomeTeamWin:
+				betRequest.BettingOdds = homeTeamWinOdds
+			case AwayTeamWin:
+				betRequest.BettingOdds = awayTeamWinOdds
+			case Draw:
+				betRequest.BettingOdds = tiedOdds
+			}
+			if bettingMode == PoolBetting {
+				betRequest.BettingOdds = 0
+			}
 
-				// 更新 user 表中用户的金币（正确来说，应该这几个操作是一个 事务 操作）
-				stmt, err = db.Prepare("UPDATE user SET money = ?, bet_count = ? WHERE user_id = ?")
-				if err != nil {
-					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
-					return
-				}
-				result, err = stmt.Exec(int(money)-betRequest.BettingMoney, betCount+1, betRequest.UserId)
-				if err != nil {
-					operateMySQLFailedRsp(c)
-					fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
-					return
-				}
+			// 在 bet 表插入相应的记录
+			result, err := tx.Exec("INSERT INTO "+
+				"bet(user_id,schedule_id,betting_money,betting_result,betting_odds,bet_status,win_money) "+
+				"VALUES (?,?,?,?,?,?,?)", betRequest.UserId, betRequest.ScheduleId,
+				betRequest.BettingMoney, betRequest.BettingResult, betRequest.BettingOdds, BetNotFinish, 0)
+			if err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "insert bet failed, result:%v, err: %v\n", result, err)
+				return
+			}
 
-				c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
-			} else {
-				userNotExist(c)
+			// 扣除投注的金币并记账
+			balance, err := postLedger(tx, betRequest.UserId, -betRequest.BettingMoney, LedgerStake,
+				RefSchedule, betRequest.ScheduleId)
+			if err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "post ledger failed, err: %v\n", err)
+				return
+			}
+			result, err = tx.Exec("UPDATE user SET bet_count = bet_count + 1 WHERE user_id = ?", betRequest.UserId)
+			if err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "update user failed, result:%v, err: %v\n", result, err)
 				return
 			}
+			if err := tx.Commit(); err != nil {
+				operateMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "commit bet failed, err: %v\n", err)
+				return
+			}
+			bus.Publish(EventBetPlaced, BetPlacedEvent{
+				UserID:        betRequest.UserId,
+				ScheduleID:    betRequest.ScheduleId,
+				BettingResult: ScheduleStatus(betRequest.BettingResult),
+				BettingMoney:  betRequest.BettingMoney,
+			})
+			if bettingMode == PoolBetting {
+				publishPoolOdds(betRequest.ScheduleId)
+			}
+			recordAudit(c, auditRecord{
+				Action:     "bet",
+				TargetType: RefSchedule,
+				TargetID:   betRequest.ScheduleId,
+				UserID:     betRequest.UserId,
+				ScheduleID: betRequest.ScheduleId,
+				Before:     gin.H{"money": money},
+				After: gin.H{"money": balance, "betting_result": betRequest.BettingResult,
+					"betting_money": betRequest.BettingMoney, "betting_odds": betRequest.BettingOdds},
+			})
+
+			c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
 		}
 	} else {
 		scheduleNotExistRsp(c)
@@ -491,9 +595,8 @@ func handleAuthorize(c *gin.Context) {
 		return
 	}
 
-	loginTimeStamp := time.Now().Unix()
-	tm := time.Unix(loginTimeStamp, 0)
-	loginTime := tm.Format("2006-01-02 15:04:05")
+	now := time.Now()
+	loginTime := toDBTime(now)
 	if rows.Next() {
 		var user User
 		err := rows.Scan(&user.UserId, &user.EnglishName, &user.ChineseName, &user.Password,
@@ -507,6 +610,7 @@ func handleAuthorize(c *gin.Context) {
 			fmt.Fprintf(os.Stderr, "incorrect password, [ch_name:%v, en_name:%v], want: %v, got: %v\n",
 				user.ChineseName, user.EnglishName, user.Password, authorizeRequest.Password)
 			if user.EnableResetPassword != true {
+				recordAudit(c, auditRecord{Action: "login_failed", UserID: user.UserId})
 				incorrectPasswordRsp(c)
 				return
 			}
@@ -514,28 +618,28 @@ func handleAuthorize(c *gin.Context) {
 
 		// 更新登陆时间
 		if user.EnableResetPassword {
-			stmt, err := db.Prepare("UPDATE user SET money = ?, last_login_time = ?, enable_reset_password = ?, password = ? WHERE user_id = ?")
+			stmt, err := db.Prepare("UPDATE user SET last_login_time = ?, enable_reset_password = ?, password = ? WHERE user_id = ?")
 			defer stmt.Close()
 			if err != nil {
 				updateMySQLFailedRsp(c)
 				fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
 				return
 			}
-			result, err := stmt.Exec(user.Money, loginTime, false, authorizeRequest.Password, user.UserId)
+			result, err := stmt.Exec(loginTime, false, authorizeRequest.Password, user.UserId)
 			if err != nil {
 				updateMySQLFailedRsp(c)
 				fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
 				return
 			}
 		} else {
-			stmt, err := db.Prepare("UPDATE user SET money = ?, last_login_time = ? WHERE user_id = ?")
+			stmt, err := db.Prepare("UPDATE user SET last_login_time = ? WHERE user_id = ?")
 			defer stmt.Close()
 			if err != nil {
 				updateMySQLFailedRsp(c)
 				fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
 				return
 			}
-			result, err := stmt.Exec(user.Money, loginTime, user.UserId)
+			result, err := stmt.Exec(loginTime, user.UserId)
 			if err != nil {
 				updateMySQLFailedRsp(c)
 				fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
@@ -543,62 +647,59 @@ func handleAuthorize(c *gin.Context) {
 			}
 		}
 
+		if err := syncDepartmentGroups(user.UserId, user.EnglishName); err != nil {
+			fmt.Fprintf(os.Stderr, "sync department groups of user %v failed, err: %v\n", user.UserId, err)
+		}
+		// 允许重置密码时，登录会把密码改成这次输入的
+		if user.EnableResetPassword {
+			recordAudit(c, auditRecord{Action: "reset_password", UserID: user.UserId})
+		}
+		recordAudit(c, auditRecord{Action: "login", UserID: user.UserId,
+			Before: gin.H{"last_login_time": formatAPITime(user.LastLoginTime)}})
 		c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "user_id": user.UserId, "money": user.Money})
 	} else {
-		// 说明是第一次登陆
-		stmt, err := db.Prepare("INSERT INTO " +
-			"user(rtx_name,chinese_name,password,money,enable_reset_password,last_login_time,win_count,bet_count) " +
-			"VALUES (?,?,?,?,?,?,?,?)")
+		// 说明是第一次登陆，新用户余额从 0 开始，初始金币通过账本发放
+		tx, err := db.Begin()
 		if err != nil {
 			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "sql prepare failed, err: %v\n", err)
+			fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
 			return
 		}
-		result, err := stmt.Exec(authorizeRequest.EnglishName, authorizeRequest.ChineseName, authorizeRequest.Password,
-			config.InitialMoney, false, loginTime, 0, 0)
-		defer stmt.Close()
+		defer tx.Rollback()
+		result, err := tx.Exec("INSERT INTO "+
+			"user(rtx_name,chinese_name,password,money,enable_reset_password,last_login_time,win_count,bet_count) "+
+			"VALUES (?,?,?,?,?,?,?,?)", authorizeRequest.EnglishName, authorizeRequest.ChineseName, authorizeRequest.Password,
+			0, false, loginTime, 0, 0)
 		if err != nil {
 			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "insert schedule failed, result:%v, err: %v\n", result, err)
+			fmt.Fprintf(os.Stderr, "insert user failed, result:%v, err: %v\n", result, err)
 			return
 		}
 		lastId, err := result.LastInsertId()
 		if err != nil {
 			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "insert schedule failed, result:%v, err: %v\n", result, err)
+			fmt.Fprintf(os.Stderr, "insert user failed, result:%v, err: %v\n", result, err)
 			return
 		}
-		tm := time.Unix(loginTimeStamp, 0)
-		stmt, err = db.Prepare("INSERT INTO " + "reward(user_id, reward_time, reward_money) " + "VALUES (?,?,?)")
-		handleError(err)
-		_, err = stmt.Exec(lastId, tm.Format("2006-01-02 15:03:04"), config.InitialMoney)
-		handleError(err)
+		money, err := grantReward(tx, int(lastId), RewardGrant{RewardInitial, Coins(config.InitialMoney)}, now)
 		if err != nil {
 			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "grant initial money failed, err: %v\n", err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "user_id": lastId, "money": config.InitialMoney, "first_login": true})
-	}
-}
-
-func isDailyReward(userID int, loginTimeStamp int64) bool {
-	tm := time.Unix(loginTimeStamp, 0)
-	lowerBound := tm.Format("2006-01-02") + " 00:00:00"
-	upperBound := tm.Format("2006-01-02") + " 23:59:59"
-	rows, err := db.Query("SELECT * FROM reward WHERE user_id = ? and reward_time > ? and reward_time < ?",
-		userID, lowerBound, upperBound)
-	handleError(err)
-	if err != nil {
-		log.Fatalf("query db failed, error: %v\n", err)
-	}
-
-	// 如果查到 reward 表中已经有了记录，说明今天已经送过金币
-	if rows.Next() {
-		return false
+		if err := tx.Commit(); err != nil {
+			operateMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "commit new user failed, err: %v\n", err)
+			return
+		}
+		if err := syncDepartmentGroups(int(lastId), authorizeRequest.EnglishName); err != nil {
+			fmt.Fprintf(os.Stderr, "sync department groups of user %v failed, err: %v\n", lastId, err)
+		}
+		recordAudit(c, auditRecord{Action: "login", UserID: int(lastId), After: gin.H{"first_login": true}})
+		recordAudit(c, auditRecord{Action: "reward", UserID: int(lastId),
+			After: gin.H{"rewards": []RewardGrant{{RewardInitial, Coins(config.InitialMoney)}}, "money": money}})
+		c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "user_id": lastId, "money": money, "first_login": true})
 	}
-
-	return true
 }
 
 func handleBettingHistory(c *gin.Context) {
@@ -613,10 +714,12 @@ func handleBettingHistory(c *gin.Context) {
 	betHistory := []BetRequest{}
 	rows, err := db.Query("SELECT * FROM bet WHERE user_id = ?", userID)
 	handleError(err)
-	defer rows.Close()
 	if err != nil {
-		log.Fatalf("query db failed, error: %v\n", err)
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query bet history failed, err: %v\n", err)
+		return
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var betRequest BetRequest
 		err := rows.Scan(&betRequest.UserId, &betRequest.ScheduleId,
@@ -626,7 +729,13 @@ func handleBettingHistory(c *gin.Context) {
 		}
 		betHistory = append(betHistory, betRequest)
 	}
-	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "betting_history": betHistory})
+	futuresBets, err := userFuturesBets(userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query futures bet history failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "betting_history": betHistory, "futures_history": futuresBets})
 }
 
 func handleResetPassword(c *gin.Context) {
@@ -672,6 +781,7 @@ func handleResetPassword(c *gin.Context) {
 				fmt.Fprintf(os.Stderr, "update schedule failed, result:%v, err: %v\n", result, err)
 				return
 			}
+			recordAudit(c, auditRecord{Action: "reset_password", UserID: user.UserId})
 			c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK", "user_id": user.UserId, "money": user.Money})
 		} else {
 			notAllowResetPassword(c)
@@ -709,7 +819,18 @@ func handleGrantResetPassword(c *gin.Context) {
 			operateMySQLFailedRsp(c)
 			return
 		}
-		stmt.Exec(true, userID)
+		if _, err := stmt.Exec(true, userID); err != nil {
+			operateMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "grant reset password of user %v failed, err: %v\n", userID, err)
+			return
+		}
+		recordAudit(c, auditRecord{
+			Action:     "grant_reset_password",
+			TargetType: "user",
+			TargetID:   userID,
+			UserID:     userID,
+			After:      gin.H{"enable_reset_password": true},
+		})
 		c.JSON(http.StatusOK, gin.H{
 			"status": 0,
 			"desc":   "OK",
@@ -721,67 +842,75 @@ func handleGrantResetPassword(c *gin.Context) {
 }
 
 func handleRank(c *gin.Context) {
-	limit := c.Query("limit")
-	if limit == "" {
-		limit = "10"
+	metric, ok := parseRankMetric(c.Query("metric"))
+	if c.Query("metric") == "" && c.Query("order_by") != "" {
+		metric, ok = parseRankMetric(c.Query("order_by"))
+	}
+	page, pageSize, validPage := parsePagination(c)
+	if !ok || !validPage {
+		illegalParametersRsp(c)
+		return
 	}
 
-	if DisplayRank {
-		if len(GRank) > 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"status": 0,
-				"desc":   "OK",
-				"rank":   GRank,
-			})
-		} else {
-			ranks := []RankRsp{}
-			rows, err := db.Query("SELECT user_id, rtx_name, chinese_name, money,win_count,bet_count FROM user WHERE bet_count > 0 ORDER BY money desc limit ?", limit)
-			handleError(err)
-			defer rows.Close()
-			if err != nil {
-				operateMySQLFailedRsp(c)
-				return
-			}
-
-			for rows.Next() {
-				var rank RankRsp
-				err := rows.Scan(&rank.UserID, &rank.RTXName, &rank.ChineseName, &rank.Money, &rank.WinCount, &rank.BetCount)
-				if err != nil {
-					queryMySQLFailedRsp(c)
-					return
-				}
-				ranks = append(ranks, rank)
-			}
-			c.JSON(http.StatusOK, gin.H{
-				"status": 0,
-				"desc":   "OK",
-				"rank":   ranks,
-			})
-		}
-	} else {
+	display, snapshotID, frozenMetric, frozen := rankDisplay.get()
+	if !display {
 		c.JSON(http.StatusOK, gin.H{
 			"status": 0,
 			"desc":   "OK",
 			"rank":   []RankRsp{},
 		})
+		return
 	}
+
+	// 管理员冻结了某个快照时，展示快照中的排行榜
+	if snapshotID > 0 {
+		ranks, total := paginateRanks(frozen, page, pageSize)
+		c.JSON(http.StatusOK, gin.H{
+			"status":      0,
+			"desc":        "OK",
+			"rank":        ranks,
+			"metric":      frozenMetric,
+			"page":        page,
+			"page_size":   pageSize,
+			"total":       total,
+			"snapshot_id": snapshotID,
+		})
+		return
+	}
+
+	ranks, total := rankCache.page(metric, page, pageSize)
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"rank":       ranks,
+		"metric":     metric,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
+		"updated_at": rankCache.lastUpdated(),
+	})
 }
 
 func handleRewardHistory(c *gin.Context) {
 	userID := c.Query("user_id")
 
 	rewardHistory := []RewardHistory{}
-	rows, err := db.Query("SELECT user_id,reward_time,reward_money FROM reward WHERE user_id = ?", userID)
+	rows, err := db.Query("SELECT user_id,reward_time,reward_money,reward_type FROM reward WHERE user_id = ?", userID)
 	handleError(err)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		return
+	}
 	defer rows.Close()
 	for rows.Next() {
 		var history RewardHistory
-		err := rows.Scan(&history.UserId, &history.RewardTime, &history.RewardMoney)
+		err := rows.Scan(&history.UserId, &history.RewardTime, &history.RewardMoney, &history.RewardType)
 		handleError(err)
 		if err != nil {
 			operateMySQLFailedRsp(c)
 			return
 		}
+		history.RewardTime = formatAPITime(history.RewardTime)
 		rewardHistory = append(rewardHistory, history)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -791,18 +920,6 @@ func handleRewardHistory(c *gin.Context) {
 	})
 }
 
-func rankNumber(userID int) int {
-	rows, err := db.Query("SELECT u.rank FROM (select user_id, bet_count, (@ranknum:=@ranknum+1) as rank from user,(select (@ranknum :=0) ) b where bet_count > 0 order by money desc)u where u.user_id = ?", userID)
-	handleError(err)
-	defer rows.Close()
-	if rows.Next() {
-		var rank int
-		rows.Scan(&rank)
-		return rank
-	}
-	return 0
-}
-
 func handleMyInfo(c *gin.Context) {
 	userID := c.Query("user_id")
 	userID2, err := strconv.Atoi(userID)
@@ -810,11 +927,21 @@ func handleMyInfo(c *gin.Context) {
 		illegalParametersRsp(c)
 		return
 	}
-	isDailyReward := isDailyReward(userID2, time.Now().Unix())
+	isDailyReward, err := isDailyReward(db, userID2, time.Now())
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query reward failed, err: %v\n", err)
+		return
+	}
+	achievements, err := userAchievements(userID2, true)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query achievements failed, err: %v\n", err)
+		return
+	}
 	rows, err := db.Query("SELECT user_id,rtx_name,chinese_name,money,win_count,bet_count FROM user WHERE user_id = ?", userID2)
 	handleError(err)
 	defer rows.Close()
-	rank := rankNumber(userID2)
 	if rows.Next() {
 		var user User
 		err := rows.Scan(&user.UserId, &user.EnglishName, &user.ChineseName, &user.Money, &user.WinCount, &user.BetCount)
@@ -823,16 +950,19 @@ func handleMyInfo(c *gin.Context) {
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{
-			"status":       0,
-			"desc":         "OK",
-			"id":           user.UserId,
-			"money":        user.Money,
-			"cn_name":      user.ChineseName,
-			"en_name":      user.EnglishName,
-			"daily_reward": isDailyReward,
-			"rank":         rank,
-			"win_count":    user.WinCount,
-			"bet_count":    user.BetCount,
+			"status":        0,
+			"desc":          "OK",
+			"id":            user.UserId,
+			"money":         user.Money,
+			"cn_name":       user.ChineseName,
+			"en_name":       user.EnglishName,
+			"daily_reward":  isDailyReward,
+			"rank":          rankCache.position(RankByBalance, userID2),
+			"ranks":         rankCache.userRanks(userID2),
+			"rank_movement": rankCache.movement(RankByBalance, userID2),
+			"win_count":     user.WinCount,
+			"bet_count":     user.BetCount,
+			"achievements":  achievements,
 		})
 	} else {
 		userNotExist(c)
@@ -840,61 +970,6 @@ func handleMyInfo(c *gin.Context) {
 	}
 }
 
-func handleDailyReward(c *gin.Context) {
-	var req DailyRewardRequest
-	if c.Bind(&req) != nil {
-		illegalParametersRsp(c)
-		return
-	}
-
-	timestamp := time.Now().Unix()
-	if isDailyReward(req.UserID, timestamp) {
-		tm := time.Unix(timestamp, 0)
-		stmt, err := db.Prepare("INSERT INTO " + "reward(user_id, reward_time, reward_money) " + "VALUES (?,?,?)")
-		handleError(err)
-		_, err = stmt.Exec(req.UserID, tm.Format("2006-01-02 15:03:04"), config.DailyRewardMoney)
-		handleError(err)
-		defer stmt.Close()
-		if err != nil {
-			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			return
-		}
-
-		var money float64
-		rows, err := db.Query("SELECT money FROM user WHERE user_id = ?", req.UserID)
-		handleError(err)
-		defer rows.Close()
-		if err != nil {
-			operateMySQLFailedRsp(c)
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			return
-		}
-		if rows.Next() {
-			err = rows.Scan(&money)
-			if err != nil {
-				operateMySQLFailedRsp(c)
-				fmt.Fprintf(os.Stderr, "error: %v\n", err)
-				return
-			}
-			stmt, err = db.Prepare("UPDATE user SET money = ? where user_id = ?")
-			handleError(err)
-			stmt.Exec(money+float64(config.DailyRewardMoney), req.UserID)
-			defer stmt.Close()
-			c.JSON(http.StatusOK, gin.H{
-				"status": 0,
-				"desc":   "OK",
-			})
-		} else {
-			userNotExist(c)
-			return
-		}
-	} else {
-		alreayGetDailyReward(c)
-		return
-	}
-}
-
 func handleCountry(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  0,
@@ -1001,7 +1076,7 @@ func handleAddNewUser(c *gin.Context) {
 		return
 	}
 
-	if addNewUser(timiNewUsers, newUserReq.ChineseName, newUserReq.EnglishName) != true {
+	if addNewUser(timiNewUsers, newUserReq.ChineseName, newUserReq.EnglishName, newUserReq.Department) != true {
 		addNewUserFailed(c)
 		return
 	}
@@ -1011,27 +1086,19 @@ func handleAddNewUser(c *gin.Context) {
 	})
 }
 
-func handleUpdateRanks(c *gin.Context) {
-	var req UpdateRankReq
-	if c.Bind(&req) != nil {
-		illegalParametersRsp(c)
-		return
-	}
-
-	DisplayRank = req.EnableDisplayRank
-	GRank = req.Rank
-
-	c.JSON(http.StatusOK, gin.H{
-		"status": 0,
-		"desc":   "OK",
-	})
-}
-
-func init() {
+// setup 读取配置、连接数据库，放在 main 里而不是 init 里，测试时不需要配置和数据库
+func setup() {
 	parseConfig()
 	db = sqlDB()
 
+	loadServerLocation()
+	if err := loadRankSetting(); err != nil {
+		fmt.Fprintf(os.Stderr, "load rank setting failed, err: %v\n", err)
+	}
 	readUserFile(config.CSVNameList, config.TimiNewUser)
+	if err := syncAllDepartmentGroups(); err != nil {
+		fmt.Fprintf(os.Stderr, "sync department groups failed, err: %v\n", err)
+	}
 	if _, err := os.Stat("assets"); os.IsNotExist(err) {
 		if err := os.Mkdir("assets", 0755); err != nil {
 			log.Fatalf("create assets failed, error: %v\n", err)
@@ -1051,7 +1118,7 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, XMLHttpRequest, "+
-			"Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept-Encoding, X-CSRF-Token, Authorization, "+types.AdminTokenHeader+", "+types.AdminOperatorHeader)
 		if c.Request.Method == "OPTIONS" {
 			c.String(200, "ok")
 			return
@@ -1061,32 +1128,87 @@ func CORSMiddleware() gin.HandlerFunc {
 }
 
 func main() {
+	setup()
 	router := gin.Default()
 	router.Use(CORSMiddleware())
 
-	router.PUT("/new_schedule", handleNewSchedule)
-
 	router.GET("/schedules", handleSchedules)
 	router.GET("/schedules2", handleSchedules2)
+	router.GET("/schedules/:id/insights", handleScheduleInsights)
 	router.GET("/rank", handleRank)
+	router.GET("/rank_history", handleRankHistory)
+	router.GET("/rank_snapshots", handleRankSnapshots)
+	router.GET("/groups", handleGroups)
+	router.GET("/group_rank", handleGroupRank)
+	router.GET("/group_league", handleGroupLeague)
+	router.GET("/challenges", handleChallenges)
+	router.GET("/achievements", handleAchievements)
+	router.GET("/futures", handleFutures)
+	router.GET("/predictions", handlePredictions)
+	router.GET("/prediction_rank", handlePredictionRank)
 	router.GET("/betting_history", handleBettingHistory)
 	router.GET("/reward_history", handleRewardHistory)
 	router.GET("/my", handleMyInfo)
+	router.GET("/stats", handleStats)
 	router.GET("/country", handleCountry)
 	router.GET("/tips", handleTips)
 	router.GET("/display", handleDisplay)
+	router.GET("/transactions", handleTransactions)
+	router.GET("/events", handleEvents)
+	router.GET("/notifications", handleNotifications)
+	router.GET("/calendar.ics", handleCalendar)
+	router.GET("/notification_preference", handleNotificationPreference)
 
-	router.POST("/update_schedule", handleUpdateSchedule)
 	router.POST("/bet", handleBet)
 	router.POST("/authorize", handleAuthorize)
 	router.POST("/daily_reward", handleDailyReward)
+	router.POST("/rebuy", handleRebuy)
+	router.POST("/create_group", handleCreateGroup)
+	router.POST("/join_group", handleJoinGroup)
+	router.POST("/leave_group", handleLeaveGroup)
+	router.POST("/challenge", handleCreateChallenge)
+	router.POST("/accept_challenge", handleAcceptChallenge)
+	router.POST("/decline_challenge", handleDeclineChallenge)
+	router.POST("/futures_bet", handleFuturesBet)
+	router.POST("/predict", handlePredict)
 	router.POST("/reset_password", handleResetPassword)
-	router.POST("/grant_reset_password", handleGrantResetPassword)
-	router.POST("/add_tips", handleAddTips)
-	router.POST("/upload_pictures", handleUploadPictures)
-	router.POST("/add_new_user", handleAddNewUser)
-	router.POST("/update_ranks", handleUpdateRanks)
+	router.POST("/notification_preference", handleUpdateNotificationPreference)
+	router.POST("/calendar_url", handleCalendarURL)
+
+	// 管理接口，需要带上 admin_token
+	admin := router.Group("/", AdminAuthMiddleware(), AuditAdminMiddleware())
+	admin.PUT("/new_schedule", handleNewSchedule)
+
+	admin.GET("/reconcile", handleReconcile)
+	admin.GET("/webhooks", handleWebhooks)
+	admin.GET("/webhook_deliveries", handleWebhookDeliveries)
+	admin.GET("/pending_results", handlePendingResults)
+	admin.GET("/export_fixtures", handleExportFixtures)
+	admin.GET("/adjustments", handleAdjustments)
+	admin.GET("/audit_log", handleAuditLog)
+
+	admin.POST("/update_schedule", handleUpdateSchedule)
+	admin.POST("/new_futures_market", handleNewFuturesMarket)
+	admin.POST("/update_futures_selection", handleUpdateFuturesSelection)
+	admin.POST("/grant_reset_password", handleGrantResetPassword)
+	admin.POST("/add_tips", handleAddTips)
+	admin.POST("/upload_pictures", handleUploadPictures)
+	admin.POST("/add_new_user", handleAddNewUser)
+	admin.POST("/import_results", handleImportResults)
+	admin.POST("/import_fixtures", handleImportFixtures)
+	admin.POST("/approve_result", handleApproveResult)
+	admin.POST("/reject_result", handleRejectResult)
+	admin.POST("/add_webhook", handleAddWebhook)
+	admin.POST("/update_webhook", handleUpdateWebhook)
+	admin.POST("/delete_webhook", handleDeleteWebhook)
+	admin.POST("/replay_webhook", handleReplayWebhook)
+	admin.POST("/update_ranks", handleUpdateRanks)
+	admin.POST("/void_schedule", handleVoidSchedule)
+	admin.POST("/take_snapshot", handleTakeSnapshot)
+	admin.POST("/adjust_balance", handleAdjustBalance)
 
 	router.Static("/assets", "./assets")
+
+	startSchedulers()
 	router.Run(config.ServerPort)
 }
@@ -0,0 +1,25 @@
+package main
+
+import "github.com/GhostComputing/worldcup-betting/types"
+
+// 金额和赔率的定点数类型定义在 types 包里，和管理工具共用
+
+type (
+	Money = types.Money
+	Odds  = types.Odds
+)
+
+const (
+	Cent = types.Cent
+	Coin = types.Coin
+
+	oddsUnit = types.OddsUnit
+)
+
+func Coins(n int) Money {
+	return types.Coins(n)
+}
+
+func roundDiv(a, b int64) int64 {
+	return types.RoundDiv(a, b)
+}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 通知：开赛前提醒还没投注的用户、比赛结算结果、每日奖励提醒。
+// 通知先写入 notification 表（outbox），每个渠道一行，再由后台任务按用户的偏好通过各个渠道发送。
+// 站内信渠道的记录本身就是用户的收件箱，通过 /notifications 查看
+
+type NotificationKind string
+
+const (
+	NotifyMatchReminder NotificationKind = "match_reminder" // 开赛前提醒投注
+	NotifySettlement    NotificationKind = "settlement"     // 比赛结算结果
+	NotifyDailyReward   NotificationKind = "daily_reward"   // 每日奖励提醒
+)
+
+type NotificationChannel string
+
+const (
+	ChannelInbox   NotificationChannel = "inbox"   // 站内信，总是开启
+	ChannelEmail   NotificationChannel = "email"   // 邮件
+	ChannelWebhook NotificationChannel = "webhook" // 用户自己的 webhook，例如聊天机器人
+)
+
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "pending"
+	NotificationSent    NotificationStatus = "sent"
+	NotificationFailed  NotificationStatus = "failed"
+)
+
+const (
+	notificationCheckInterval    = 30 * time.Second
+	notificationMaxAttempts      = 3
+	notificationDispatchBatch    = 200
+	defaultReminderMinutes       = 60
+	defaultDailyRewardRemindHour = 10
+)
+
+type Notification struct {
+	NotificationID int                 `json:"notification_id"`
+	UserID         int                 `json:"user_id"`
+	Kind           NotificationKind    `json:"kind"`
+	Channel        NotificationChannel `json:"channel"`
+	Title          string              `json:"title"`
+	Content        string              `json:"content"`
+	Status         NotificationStatus  `json:"status"`
+	CreatedAt      string              `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	UserID        int    `json:"user_id"`
+	Email         string `json:"email,omitempty"`       // 为空时使用 英文名@notification_email_domain
+	WebhookURL    string `json:"webhook_url,omitempty"` // 用户自己的 webhook 地址，查询时不返回
+	EnableEmail   bool   `json:"enable_email"`
+	EnableWebhook bool   `json:"enable_webhook"`
+	MatchReminder bool   `json:"match_reminder"`
+	Settlement    bool   `json:"settlement"`
+	DailyReward   bool   `json:"daily_reward"`
+}
+
+// NotificationSender 是一个通知渠道，新增渠道只需要实现这个接口并注册到 notificationSenders
+type NotificationSender interface {
+	Send(n Notification, pref NotificationPreference) error
+}
+
+// 站内信不需要发送，写进 outbox 的记录就是收件箱
+type inboxSender struct{}
+
+func (inboxSender) Send(n Notification, pref NotificationPreference) error {
+	return nil
+}
+
+type smtpSender struct{}
+
+func (smtpSender) Send(n Notification, pref NotificationPreference) error {
+	if config.SMTPAddr == "" {
+		return errors.New("smtp_addr is not configured")
+	}
+	if pref.Email == "" {
+		return errors.New("user has no email address")
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", pref.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.Replace(n.Content, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if config.SMTPUsername != "" {
+		host, _, err := net.SplitHostPort(config.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, host)
+	}
+	return smtp.SendMail(config.SMTPAddr, auth, config.SMTPFrom, []string{pref.Email}, msg.Bytes())
+}
+
+// 用户自己填的 webhook 地址不可信，不能让服务端替用户访问内网：
+// 保存时检查一次，发送时连接前再按解析出来的地址检查一次，防止域名解析结果被换掉
+var nonPublicNetworks = mustParseCIDRs("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "::1/128", "fc00::/7", "fe80::/10")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolvePublicHost 解析主机名，有任何一个地址不是公网地址时返回错误
+func resolvePublicHost(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("host %v has no address", host)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return nil, fmt.Errorf("host %v resolves to non-public address %v", host, addr.IP)
+		}
+	}
+	return addrs, nil
+}
+
+func validUserWebhookURL(raw string) bool {
+	if !validWebhookURL(raw) {
+		return false
+	}
+	u, _ := url.Parse(raw)
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	_, err := resolvePublicHost(ctx, u.Hostname())
+	return err == nil
+}
+
+var userWebhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			addrs, err := resolvePublicHost(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+		},
+	},
+}
+
+type webhookSender struct{}
+
+func (webhookSender) Send(n Notification, pref NotificationPreference) error {
+	if !validWebhookURL(pref.WebhookURL) {
+		return errors.New("user has no valid webhook url")
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	rsp, err := userWebhookClient.Post(pref.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", rsp.StatusCode)
+	}
+	return nil
+}
+
+var notificationSenders = map[NotificationChannel]NotificationSender{
+	ChannelInbox:   inboxSender{},
+	ChannelEmail:   smtpSender{},
+	ChannelWebhook: webhookSender{},
+}
+
+// 没有设置过偏好的用户：所有通知都只发站内信
+func defaultNotificationPreference(userID int) NotificationPreference {
+	return NotificationPreference{UserID: userID, MatchReminder: true, Settlement: true, DailyReward: true}
+}
+
+// notificationPreferences 读出用户的通知偏好，userID 为 0 时读出所有用户的，没有设置过的用户使用默认值
+func notificationPreferences(userID int) (map[int]NotificationPreference, error) {
+	query := "SELECT u.user_id, u.rtx_name, COALESCE(p.email, ''), COALESCE(p.webhook_url, ''), " +
+		"COALESCE(p.enable_email, FALSE), COALESCE(p.enable_webhook, FALSE), COALESCE(p.match_reminder, TRUE), " +
+		"COALESCE(p.settlement, TRUE), COALESCE(p.daily_reward, TRUE) " +
+		"FROM user u LEFT JOIN notification_preference p ON p.user_id = u.user_id"
+	args := []interface{}{}
+	if userID != 0 {
+		query += " WHERE u.user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[int]NotificationPreference)
+	for rows.Next() {
+		var (
+			p       NotificationPreference
+			rtxName string
+		)
+		err := rows.Scan(&p.UserID, &rtxName, &p.Email, &p.WebhookURL, &p.EnableEmail, &p.EnableWebhook,
+			&p.MatchReminder, &p.Settlement, &p.DailyReward)
+		if err != nil {
+			return nil, err
+		}
+		if p.Email == "" && config.NotificationEmailDomain != "" && rtxName != "" {
+			p.Email = rtxName + "@" + config.NotificationEmailDomain
+		}
+		prefs[p.UserID] = p
+	}
+	return prefs, rows.Err()
+}
+
+func (p NotificationPreference) wants(kind NotificationKind) bool {
+	switch kind {
+	case NotifyMatchReminder:
+		return p.MatchReminder
+	case NotifySettlement:
+		return p.Settlement
+	case NotifyDailyReward:
+		return p.DailyReward
+	}
+	return false
+}
+
+func (p NotificationPreference) channels() []NotificationChannel {
+	channels := []NotificationChannel{ChannelInbox}
+	if p.EnableEmail {
+		channels = append(channels, ChannelEmail)
+	}
+	if p.EnableWebhook {
+		channels = append(channels, ChannelWebhook)
+	}
+	return channels
+}
+
+// 通知的去重键，同一个用户同一个键的通知只写一次
+func matchReminderKey(scheduleID int) string {
+	return "match_reminder:" + strconv.Itoa(scheduleID)
+}
+
+func settlementKey(scheduleID int) string {
+	return "settlement:" + strconv.Itoa(scheduleID)
+}
+
+// dailyRewardKey 按服务端所在时区的日期区分，day 是 dayBounds 返回的当天开始时间
+func dailyRewardKey(day time.Time) string {
+	return "daily_reward:" + day.In(serverLocation).Format("2006-01-02")
+}
+
+// notify 把通知写入 outbox，每个开启的渠道一行。dedupKey 相同的通知对同一个用户只会写一次，
+// 所以定时任务可以放心地重复执行；ex 是事务时和事务一起提交
+func notify(ex execer, pref NotificationPreference, kind NotificationKind, dedupKey, title, content string, now time.Time) error {
+	if !pref.wants(kind) {
+		return nil
+	}
+	for _, channel := range pref.channels() {
+		_, err := ex.Exec("INSERT IGNORE INTO notification(user_id, kind, dedup_key, channel, title, content, status, "+
+			"attempts, last_error, created_at) VALUES (?,?,?,?,?,?,?,0,'',?)",
+			pref.UserID, kind, dedupKey, channel, title, content, NotificationPending, toDBTime(now))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// 已经写入过提醒的比赛和日期，定时任务不再每次都给所有用户写一遍。
+// 只在定时任务的协程里读写；重启之后会再写一次，由去重键保证不会重复通知
+var (
+	remindedSchedules    = make(map[int]bool)
+	dailyRewardRemindDay string
+)
+
+// produceMatchReminders 截止投注前 notification_reminder_minutes 分钟内，提醒还没有投注的用户
+func produceMatchReminders(now time.Time, prefs map[int]NotificationPreference) error {
+	lead := time.Duration(defaultReminderMinutes) * time.Minute
+	if config.NotificationReminderMinutes > 0 {
+		lead = time.Duration(config.NotificationReminderMinutes) * time.Minute
+	}
+	cutoff := time.Duration(config.BettingCutoffMinutes) * time.Minute
+	rows, err := db.Query("SELECT schedule_id, home_team, away_team, schedule_time FROM schedule "+
+		"WHERE schedule_status = ? and disable_betting = ? and schedule_time > ? and schedule_time <= ?",
+		NotStarted, false, toDBTime(now.Add(cutoff)), toDBTime(now.Add(cutoff+lead)))
+	if err != nil {
+		return err
+	}
+	type upcoming struct {
+		id                 int
+		homeTeam, awayTeam string
+		scheduleTime       string
+	}
+	var schedules []upcoming
+	for rows.Next() {
+		var s upcoming
+		if err := rows.Scan(&s.id, &s.homeTeam, &s.awayTeam, &s.scheduleTime); err != nil {
+			rows.Close()
+			return err
+		}
+		schedules = append(schedules, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range schedules {
+		if remindedSchedules[s.id] {
+			continue
+		}
+		ids, err := userIDs("SELECT u.user_id FROM user u WHERE NOT EXISTS "+
+			"(SELECT 1 FROM bet b WHERE b.user_id = u.user_id and b.schedule_id = ?)", s.id)
+		if err != nil {
+			return err
+		}
+		title := fmt.Sprintf("%s vs %s 即将开赛", s.homeTeam, s.awayTeam)
+		content := fmt.Sprintf("%s vs %s 将于 %s 开赛，你还没有投注，截止前记得下注。",
+			s.homeTeam, s.awayTeam, formatAPITime(s.scheduleTime))
+		for _, id := range ids {
+			pref, ok := prefs[id]
+			if !ok {
+				continue
+			}
+			if err := notify(db, pref, NotifyMatchReminder, matchReminderKey(s.id), title, content, now); err != nil {
+				return err
+			}
+		}
+		remindedSchedules[s.id] = true
+	}
+	return nil
+}
+
+// produceDailyRewardReminders 每天 daily_reward_reminder_hour 点之后提醒今天还没领取每日奖励的用户
+func produceDailyRewardReminders(now time.Time, prefs map[int]NotificationPreference) error {
+	hour := defaultDailyRewardRemindHour
+	if config.DailyRewardReminderHour > 0 {
+		hour = config.DailyRewardReminderHour
+	}
+	if now.In(serverLocation).Hour() < hour {
+		return nil
+	}
+	start, end := dayBounds(now)
+	key := dailyRewardKey(start)
+	if dailyRewardRemindDay == key {
+		return nil
+	}
+	ids, err := userIDs("SELECT u.user_id FROM user u WHERE NOT EXISTS (SELECT 1 FROM reward r "+
+		"WHERE r.user_id = u.user_id and r.reward_type = ? and r.reward_time >= ? and r.reward_time < ?)",
+		RewardDaily, toDBTime(start), toDBTime(end))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		pref, ok := prefs[id]
+		if !ok {
+			continue
+		}
+		if err := notify(db, pref, NotifyDailyReward, key, "今天的每日奖励还没有领取", "登录后可以领取今天的每日奖励。", now); err != nil {
+			return err
+		}
+	}
+	dailyRewardRemindDay = key
+	return nil
+}
+
+// notifySettlement 在比赛结算的事务里给每个投注的用户写入结算通知，和结算一起提交，不会漏发
+func notifySettlement(tx *sql.Tx, scheduleID int, now time.Time) error {
+	var homeTeam, awayTeam string
+	err := tx.QueryRow("SELECT home_team, away_team FROM schedule WHERE schedule_id = ?", scheduleID).Scan(&homeTeam, &awayTeam)
+	if err != nil {
+		return err
+	}
+	prefs, err := notificationPreferences(0)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query("SELECT user_id, betting_money, bet_status, win_money FROM bet WHERE schedule_id = ? and bet_status != ?",
+		scheduleID, BetNotFinish)
+	if err != nil {
+		return err
+	}
+	type settledBet struct {
+		userID          int
+		stake, winMoney Money
+		betStatus       int
+	}
+	var bets []settledBet
+	for rows.Next() {
+		var b settledBet
+		if err := rows.Scan(&b.userID, &b.stake, &b.betStatus, &b.winMoney); err != nil {
+			rows.Close()
+			return err
+		}
+		bets = append(bets, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("%s vs %s 已结算", homeTeam, awayTeam)
+	for _, b := range bets {
+		pref, ok := prefs[b.userID]
+		if !ok {
+			continue
+		}
+		var content string
+		switch b.betStatus {
+		case WinBet:
+			content = fmt.Sprintf("恭喜，你在 %s vs %s 投注 %v 猜中了，赢得 %v。", homeTeam, awayTeam, b.stake, b.winMoney)
+		case RefundBet:
+			content = fmt.Sprintf("%s vs %s 无人猜中，你投注的 %v 已经退还。", homeTeam, awayTeam, b.stake)
+		default:
+			content = fmt.Sprintf("很遗憾，你在 %s vs %s 投注的 %v 没有猜中。", homeTeam, awayTeam, b.stake)
+		}
+		if err := notify(tx, pref, NotifySettlement, settlementKey(scheduleID), title, content, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchNotifications 发送 outbox 里待发送的通知，失败的下次再试，超过次数后标记为失败
+func dispatchNotifications(now time.Time) error {
+	rows, err := db.Query("SELECT notification_id, user_id, kind, channel, title, content, status, attempts, created_at "+
+		"FROM notification WHERE status = ? ORDER BY notification_id LIMIT ?", NotificationPending, notificationDispatchBatch)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		Notification
+		attempts int
+	}
+	var notifications []pending
+	for rows.Next() {
+		var n pending
+		err := rows.Scan(&n.NotificationID, &n.UserID, &n.Kind, &n.Channel, &n.Title, &n.Content, &n.Status,
+			&n.attempts, &n.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		n.CreatedAt = formatAPITime(n.CreatedAt)
+		notifications = append(notifications, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(notifications) == 0 {
+		return err
+	}
+
+	prefs, err := notificationPreferences(0)
+	if err != nil {
+		return err
+	}
+	for _, n := range notifications {
+		sender, ok := notificationSenders[n.Channel]
+		var sendErr error
+		if !ok {
+			sendErr = fmt.Errorf("unknown channel %v", n.Channel)
+		} else {
+			pref, ok := prefs[n.UserID]
+			if !ok {
+				pref = defaultNotificationPreference(n.UserID)
+			}
+			sendErr = sender.Send(n.Notification, pref)
+		}
+
+		if sendErr == nil {
+			_, err = db.Exec("UPDATE notification SET status = ?, attempts = ?, sent_at = ? WHERE notification_id = ?",
+				NotificationSent, n.attempts+1, toDBTime(now), n.NotificationID)
+		} else {
+			status := NotificationPending
+			if n.attempts+1 >= notificationMaxAttempts {
+				status = NotificationFailed
+			}
+			fmt.Fprintf(os.Stderr, "send notification %v via %v failed, err: %v\n", n.NotificationID, n.Channel, sendErr)
+			_, err = db.Exec("UPDATE notification SET status = ?, attempts = ?, last_error = ? WHERE notification_id = ?",
+				status, n.attempts+1, truncateUTF8(sendErr.Error(), maxWebhookErrorLength), n.NotificationID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runNotificationJobs(now time.Time) error {
+	prefs, err := notificationPreferences(0)
+	if err != nil {
+		return err
+	}
+	if err := produceMatchReminders(now, prefs); err != nil {
+		return err
+	}
+	if err := produceDailyRewardReminders(now, prefs); err != nil {
+		return err
+	}
+	return dispatchNotifications(now)
+}
+
+func handleNotifications(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		illegalParametersRsp(c)
+		return
+	}
+
+	rows, err := db.Query("SELECT notification_id, user_id, kind, channel, title, content, status, created_at "+
+		"FROM notification WHERE user_id = ? and channel = ? ORDER BY notification_id DESC LIMIT ? OFFSET ?",
+		userID, ChannelInbox, pageSize, (page-1)*pageSize)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query notifications failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.NotificationID, &n.UserID, &n.Kind, &n.Channel, &n.Title, &n.Content, &n.Status, &n.CreatedAt)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan notification failed, err: %v\n", err)
+			return
+		}
+		n.CreatedAt = formatAPITime(n.CreatedAt)
+		notifications = append(notifications, n)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":        0,
+		"desc":          "OK",
+		"notifications": notifications,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+}
+
+func handleNotificationPreference(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	prefs, err := notificationPreferences(userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query notification preference failed, err: %v\n", err)
+		return
+	}
+	pref, ok := prefs[userID]
+	if !ok {
+		userNotExist(c)
+		return
+	}
+	// 查询只凭 user_id，不返回邮箱和 webhook 地址，免得别人拿到
+	pref.Email, pref.WebhookURL = "", ""
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"preference": pref,
+	})
+}
+
+// UpdateNotificationPreferenceReq 修改通知偏好需要带上登陆用的中英文名和密码，user_id 以验证结果为准
+type UpdateNotificationPreferenceReq struct {
+	AuthorizeRequest
+	NotificationPreference
+}
+
+func handleUpdateNotificationPreference(c *gin.Context) {
+	var req UpdateNotificationPreferenceReq
+	if c.BindJSON(&req) != nil || (req.WebhookURL != "" && !validWebhookURL(req.WebhookURL)) ||
+		(req.EnableWebhook && req.WebhookURL == "") {
+		illegalParametersRsp(c)
+		return
+	}
+	if req.WebhookURL != "" && !validUserWebhookURL(req.WebhookURL) {
+		webhookURLNotAllowedRsp(c)
+		return
+	}
+
+	userID, err := checkUserCredential(req.AuthorizeRequest)
+	switch err {
+	case nil:
+	case errUserNotExist:
+		userNotExist(c)
+		return
+	case errIncorrectPassword:
+		incorrectPasswordRsp(c)
+		return
+	default:
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "check user credential failed, err: %v\n", err)
+		return
+	}
+
+	pref := req.NotificationPreference
+	pref.UserID = userID
+	_, err = db.Exec("INSERT INTO notification_preference(user_id, email, webhook_url, enable_email, enable_webhook, "+
+		"match_reminder, settlement, daily_reward) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE "+
+		"email = VALUES(email), webhook_url = VALUES(webhook_url), enable_email = VALUES(enable_email), "+
+		"enable_webhook = VALUES(enable_webhook), match_reminder = VALUES(match_reminder), "+
+		"settlement = VALUES(settlement), daily_reward = VALUES(daily_reward)",
+		pref.UserID, pref.Email, pref.WebhookURL, pref.EnableEmail, pref.EnableWebhook,
+		pref.MatchReminder, pref.Settlement, pref.DailyReward)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "save notification preference failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
+}
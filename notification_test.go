@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationDedupKeys(t *testing.T) {
+	defer func(loc *time.Location) { serverLocation = loc }(serverLocation)
+	serverLocation = time.FixedZone("CST", 8*3600)
+
+	// 北京时间 6 月 15 日凌晨在 UTC 还是 6 月 14 日，按部署时区算是同一天
+	start, _ := dayBounds(time.Date(2018, 6, 14, 17, 0, 0, 0, time.UTC))
+	later, _ := dayBounds(time.Date(2018, 6, 15, 15, 59, 0, 0, time.UTC))
+	next, _ := dayBounds(time.Date(2018, 6, 15, 16, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		got, want string
+	}{
+		{matchReminderKey(12), "match_reminder:12"},
+		{settlementKey(12), "settlement:12"},
+		{dailyRewardKey(start), "daily_reward:2018-06-15"},
+		{dailyRewardKey(later), "daily_reward:2018-06-15"},
+		{dailyRewardKey(next), "daily_reward:2018-06-16"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("dedup key = %q, want %q", tt.got, tt.want)
+		}
+	}
+	if matchReminderKey(1) == settlementKey(1) {
+		t.Errorf("match reminder and settlement of the same schedule share a dedup key")
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"203.0.113.10", true},
+		{"2001:4860:4860::8888", true},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"224.0.0.1", false},
+		{"::", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidUserWebhookURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://203.0.113.10/hook", true},
+		{"http://203.0.113.10:8080/hook", true},
+		{"ftp://203.0.113.10/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.1/hook", false},
+		{"http://192.168.1.1/hook", false},
+	}
+	for _, tt := range tests {
+		if got := validUserWebhookURL(tt.url); got != tt.want {
+			t.Errorf("validUserWebhookURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+// 保存之后域名可能被解析到内网，发送时连接前还要再检查一次
+func TestWebhookSenderRefusesPrivateAddress(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	err := webhookSender{}.Send(Notification{Title: "test"}, NotificationPreference{WebhookURL: server.URL})
+	if err == nil || called {
+		t.Errorf("Send to %v = %v, called %v, want refused", server.URL, err, called)
+	}
+}
+
+func TestNotificationPreference(t *testing.T) {
+	tests := []struct {
+		pref     NotificationPreference
+		wants    []NotificationKind
+		channels []NotificationChannel
+	}{
+		{NotificationPreference{}, nil, []NotificationChannel{ChannelInbox}},
+		{
+			NotificationPreference{MatchReminder: true, EnableEmail: true},
+			[]NotificationKind{NotifyMatchReminder},
+			[]NotificationChannel{ChannelInbox, ChannelEmail},
+		},
+		{
+			NotificationPreference{Settlement: true, DailyReward: true, EnableEmail: true, EnableWebhook: true},
+			[]NotificationKind{NotifySettlement, NotifyDailyReward},
+			[]NotificationChannel{ChannelInbox, ChannelEmail, ChannelWebhook},
+		},
+	}
+	for _, tt := range tests {
+		var wants []NotificationKind
+		for _, kind := range []NotificationKind{NotifyMatchReminder, NotifySettlement, NotifyDailyReward} {
+			if tt.pref.wants(kind) {
+				wants = append(wants, kind)
+			}
+		}
+		if !reflect.DeepEqual(wants, tt.wants) {
+			t.Errorf("%+v wants %v, want %v", tt.pref, wants, tt.wants)
+		}
+		if got := tt.pref.channels(); !reflect.DeepEqual(got, tt.channels) {
+			t.Errorf("%+v channels = %v, want %v", tt.pref, got, tt.channels)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+)
+
+// 奖池模式的所有计算都以“分”为单位的整数进行，避免浮点误差
+
+type poolBet struct {
+	UserID        int
+	BettingResult ScheduleStatus
+	Stake         Money
+}
+
+type poolPayout struct {
+	UserID    int
+	Payout    Money // 返还给用户的总额（含本金）
+	BetStatus int
+}
+
+// 抽水比例换算成万分比
+func houseCutBasisPoints() int64 {
+	bp := int64(math.Round(config.PoolHouseCut * 100))
+	if bp < 0 {
+		return 0
+	}
+	if bp > 10000 {
+		return 10000
+	}
+	return bp
+}
+
+// 扣除抽水之后可供赢家瓜分的金额
+func poolDistributable(total Money, cutBasisPoints int64) Money {
+	return total - total*Money(cutBasisPoints)/10000
+}
+
+// computePoolPayouts 按投注比例瓜分奖池：每个赢家先向下取整拿到自己的份额，
+// 剩下的零头按余数从大到小每人补一分，余数相同时 user_id 小的优先。
+// 如果没有人猜中，所有投注原额退还，不抽水。
+func computePoolPayouts(bets []poolBet, result ScheduleStatus, cutBasisPoints int64) []poolPayout {
+	var total, winningStake Money
+	for _, b := range bets {
+		total += b.Stake
+		if b.BettingResult == result {
+			winningStake += b.Stake
+		}
+	}
+
+	payouts := make([]poolPayout, len(bets))
+	if winningStake == 0 {
+		for i, b := range bets {
+			payouts[i] = poolPayout{UserID: b.UserID, Payout: b.Stake, BetStatus: RefundBet}
+		}
+		return payouts
+	}
+
+	distributable := poolDistributable(total, cutBasisPoints)
+	var (
+		paid    Money
+		winners []int
+		remains = make([]Money, len(bets))
+	)
+	for i, b := range bets {
+		if b.BettingResult != result {
+			payouts[i] = poolPayout{UserID: b.UserID, Payout: 0, BetStatus: LostBet}
+			continue
+		}
+		share := distributable * b.Stake / winningStake
+		remains[i] = distributable * b.Stake % winningStake
+		payouts[i] = poolPayout{UserID: b.UserID, Payout: share, BetStatus: WinBet}
+		paid += share
+		winners = append(winners, i)
+	}
+
+	sort.SliceStable(winners, func(x, y int) bool {
+		i, j := winners[x], winners[y]
+		if remains[i] != remains[j] {
+			return remains[i] > remains[j]
+		}
+		return bets[i].UserID < bets[j].UserID
+	})
+	for k := Money(0); k < distributable-paid; k++ {
+		payouts[winners[k]].Payout++
+	}
+	return payouts
+}
+
+// 奖池模式下的隐含赔率，和固定赔率一样表示每投注一个金币的净收益
+func poolImpliedOdds(distributable, outcomeStake Money) Odds {
+	if outcomeStake == 0 {
+		return 0
+	}
+	// 向下取整到千分之一，展示的赔率不会高于实际派彩
+	return Odds(int64(distributable-outcomeStake) * oddsUnit / int64(outcomeStake))
+}
+
+// 查询各场奖池模式比赛当前每个结果上的投注总额，单位：分
+func poolStakes(db *sql.DB) (map[int]map[ScheduleStatus]Money, error) {
+	rows, err := db.Query("SELECT b.schedule_id, b.betting_result, SUM(b.betting_money) FROM bet b "+
+		"JOIN schedule s ON s.schedule_id = b.schedule_id WHERE s.betting_mode = ? "+
+		"GROUP BY b.schedule_id, b.betting_result", PoolBetting)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stakes := make(map[int]map[ScheduleStatus]Money)
+	for rows.Next() {
+		var (
+			scheduleID int
+			result     ScheduleStatus
+			sum        Money
+		)
+		if err := rows.Scan(&scheduleID, &result, &sum); err != nil {
+			return nil, err
+		}
+		if stakes[scheduleID] == nil {
+			stakes[scheduleID] = make(map[ScheduleStatus]Money)
+		}
+		stakes[scheduleID][result] = sum
+	}
+	return stakes, rows.Err()
+}
+
+// 用当前奖池填充赛程的隐含赔率
+func fillPoolOdds(schedule *Schedule2, stakes map[ScheduleStatus]Money) {
+	var total Money
+	for _, s := range stakes {
+		total += s
+	}
+	distributable := poolDistributable(total, houseCutBasisPoints())
+
+	schedule.HomeTeamWinOdds = poolImpliedOdds(distributable, stakes[HomeTeamWin])
+	schedule.AwayTeamWinOdds = poolImpliedOdds(distributable, stakes[AwayTeamWin])
+	schedule.TiedOdds = poolImpliedOdds(distributable, stakes[Draw])
+	schedule.Pool = &PoolInfo{
+		TotalStake:       total,
+		HomeTeamWinStake: stakes[HomeTeamWin],
+		AwayTeamWinStake: stakes[AwayTeamWin],
+		TiedStake:        stakes[Draw],
+		HouseCut:         config.PoolHouseCut,
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputePoolPayouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		bets   []poolBet
+		result ScheduleStatus
+		cut    int64 // 万分比
+		want   []poolPayout
+	}{
+		{
+			// 400 分给三个人，每人 133 余 1 分，余数相同时给 user_id 最小的
+			name: "tie broken by user id",
+			bets: []poolBet{
+				{7, HomeTeamWin, 100}, {3, HomeTeamWin, 100}, {5, HomeTeamWin, 100}, {9, Draw, 100},
+			},
+			result: HomeTeamWin,
+			want: []poolPayout{
+				{7, 133, WinBet}, {3, 134, WinBet}, {5, 133, WinBet}, {9, 0, LostBet},
+			},
+		},
+		{
+			// 5 分按 1:2 分，份额 1 余 2、3 余 1，剩下的 1 分给余数大的
+			name: "largest remainder first",
+			bets: []poolBet{
+				{1, AwayTeamWin, 2}, {2, Draw, 1}, {3, Draw, 2},
+			},
+			result: Draw,
+			want: []poolPayout{
+				{1, 0, LostBet}, {2, 2, WinBet}, {3, 3, WinBet},
+			},
+		},
+		{
+			// 1000 分抽水 2.5% 剩 975 分，三个赢家各 325 分
+			name: "house cut",
+			bets: []poolBet{
+				{4, HomeTeamWin, 300}, {2, HomeTeamWin, 300}, {8, HomeTeamWin, 300}, {1, AwayTeamWin, 100},
+			},
+			result: HomeTeamWin,
+			cut:    250,
+			want: []poolPayout{
+				{4, 325, WinBet}, {2, 325, WinBet}, {8, 325, WinBet}, {1, 0, LostBet},
+			},
+		},
+		{
+			name: "no winner refunds without cut",
+			bets: []poolBet{
+				{1, HomeTeamWin, 150}, {2, AwayTeamWin, 99},
+			},
+			result: Draw,
+			cut:    500,
+			want: []poolPayout{
+				{1, 150, RefundBet}, {2, 99, RefundBet},
+			},
+		},
+		{
+			name: "full cut",
+			bets: []poolBet{
+				{1, HomeTeamWin, 150}, {2, AwayTeamWin, 99},
+			},
+			result: HomeTeamWin,
+			cut:    10000,
+			want: []poolPayout{
+				{1, 0, WinBet}, {2, 0, LostBet},
+			},
+		},
+		{
+			name: "zero cut pays the whole pool",
+			bets: []poolBet{
+				{1, HomeTeamWin, 1}, {2, HomeTeamWin, 1}, {3, HomeTeamWin, 1}, {4, AwayTeamWin, 98},
+			},
+			result: HomeTeamWin,
+			want: []poolPayout{
+				{1, 34, WinBet}, {2, 34, WinBet}, {3, 33, WinBet}, {4, 0, LostBet},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := computePoolPayouts(tt.bets, tt.result, tt.cut)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: computePoolPayouts = %v, want %v", tt.name, got, tt.want)
+		}
+
+		var total, paid Money
+		winners := false
+		for i, b := range tt.bets {
+			total += b.Stake
+			paid += got[i].Payout
+			winners = winners || b.BettingResult == tt.result
+		}
+		want := total
+		if winners {
+			want = poolDistributable(total, tt.cut)
+		}
+		if paid != want {
+			t.Errorf("%v: paid %v in total, want %v", tt.name, paid, want)
+		}
+	}
+}
+
+func TestPoolDistributable(t *testing.T) {
+	tests := []struct {
+		total Money
+		cut   int64
+		want  Money
+	}{
+		{1000, 0, 1000},
+		{1000, 250, 975},
+		{999, 250, 975}, // 抽水 24.975 分向下取整为 24 分
+		{1000, 10000, 0},
+	}
+	for _, tt := range tests {
+		if got := poolDistributable(tt.total, tt.cut); got != tt.want {
+			t.Errorf("poolDistributable(%v, %v) = %v, want %v", tt.total, tt.cut, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 竞猜比分：不需要金币，每场比赛猜一个比分，比赛结果通过 /update_schedule 公布后计算积分。
+// 猜中比分、净胜球或者胜负得到不同的积分，积分排行榜和金币排行榜分开
+
+type Prediction struct {
+	ScheduleID     int            `json:"schedule_id"`
+	HomeTeam       int            `json:"home_team"`
+	AwayTeam       int            `json:"away_team"`
+	ScheduleTime   string         `json:"schedule_time"`
+	ScheduleStatus ScheduleStatus `json:"schedule_status"`
+	HomeScore      int            `json:"home_score"`            // 猜的主队进球
+	AwayScore      int            `json:"away_score"`            // 猜的客队进球
+	ActualHome     *int           `json:"actual_home,omitempty"` // 实际主队进球
+	ActualAway     *int           `json:"actual_away,omitempty"` // 实际客队进球
+	Points         int            `json:"points"`                // 获得的积分
+	Scored         bool           `json:"scored"`                // 是否已经计算积分
+}
+
+type PredictionRequest struct {
+	UserID     int `json:"user_id"`
+	ScheduleID int `json:"schedule_id"`
+	HomeScore  int `json:"home_score"`
+	AwayScore  int `json:"away_score"`
+}
+
+type PredictionRank struct {
+	Rank        int    `json:"rank"`
+	UserID      int    `json:"user_id"`
+	RTXName     string `json:"en_name"`
+	ChineseName string `json:"cn_name"`
+	Points      int    `json:"points"`
+	ExactCount  int    `json:"exact_count"`  // 猜中比分的场次
+	ScoredCount int    `json:"scored_count"` // 已经计算积分的场次
+}
+
+const maxPredictionScore = 99
+
+func validScore(score *int) bool {
+	return score == nil || (*score >= 0 && *score <= maxPredictionScore)
+}
+
+// scoreChanged 判断更新赛程时是否修改了比分，没传比分表示保留原来的
+func scoreChanged(old, updated *int) bool {
+	return updated != nil && (old == nil || *old != *updated)
+}
+
+// orOldScore 返回更新之后的比分，没传比分时是原来的比分
+func orOldScore(updated, old *int) *int {
+	if updated != nil {
+		return updated
+	}
+	return old
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// 比分对应的胜负
+func scoreOutcome(home, away int) ScheduleStatus {
+	switch sign(home - away) {
+	case 1:
+		return HomeTeamWin
+	case -1:
+		return AwayTeamWin
+	}
+	return Draw
+}
+
+// validResultScore 检查录入的比分和比赛结果是否一致，否则投注按结果结算、比分竞猜按比分计分会对不上。
+// 淘汰赛比分相同时可以是点球决胜的一方获胜；还没有比分时不检查
+func validResultScore(scheduleType ScheduleType, status ScheduleStatus, home, away *int) bool {
+	if status == NotStarted || home == nil || away == nil {
+		return true
+	}
+	outcome := scoreOutcome(*home, *away)
+	if outcome == status {
+		return true
+	}
+	return outcome == Draw && scheduleType != GroupMatches && (status == HomeTeamWin || status == AwayTeamWin)
+}
+
+// predictionPoints 计算一次竞猜的积分。公布了比分时按比分判断，
+// 没有公布比分时只能按比赛结果判断胜负
+func predictionPoints(home, away int, status ScheduleStatus, actualHome, actualAway *int) int {
+	if actualHome == nil || actualAway == nil {
+		if scoreOutcome(home, away) == status {
+			return config.PredictionOutcomePoints
+		}
+		return 0
+	}
+	switch {
+	case home == *actualHome && away == *actualAway:
+		return config.PredictionExactPoints
+	case home-away == *actualHome-*actualAway:
+		return config.PredictionGoalDiffPoints
+	case sign(home-away) == sign(*actualHome-*actualAway):
+		return config.PredictionOutcomePoints
+	}
+	return 0
+}
+
+// scorePredictions 按比赛结果重新计算这场比赛所有竞猜的积分，修改比分后再次调用会覆盖之前的积分
+func scorePredictions(scheduleID int) error {
+	var (
+		status                 ScheduleStatus
+		actualHome, actualAway *int
+	)
+	err := db.QueryRow("SELECT schedule_status, home_score, away_score FROM schedule WHERE schedule_id = ?", scheduleID).
+		Scan(&status, &actualHome, &actualAway)
+	if err != nil {
+		return err
+	}
+	if status == NotStarted {
+		return nil
+	}
+
+	rows, err := db.Query("SELECT user_id, home_score, away_score FROM prediction WHERE schedule_id = ?", scheduleID)
+	if err != nil {
+		return err
+	}
+	points := make(map[int]int)
+	for rows.Next() {
+		var userID, home, away int
+		if err := rows.Scan(&userID, &home, &away); err != nil {
+			rows.Close()
+			return err
+		}
+		points[userID] = predictionPoints(home, away, status, actualHome, actualAway)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for userID, p := range points {
+		_, err := tx.Exec("UPDATE prediction SET points = ?, scored = ? WHERE user_id = ? and schedule_id = ?",
+			p, true, userID, scheduleID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func handlePredict(c *gin.Context) {
+	var req PredictionRequest
+	if c.Bind(&req) != nil || req.HomeScore < 0 || req.AwayScore < 0 ||
+		req.HomeScore > maxPredictionScore || req.AwayScore > maxPredictionScore {
+		illegalParametersRsp(c)
+		return
+	}
+
+	now := time.Now()
+	open, err := scheduleOpen(db, req.ScheduleID, now)
+	if err == sql.ErrNoRows {
+		scheduleNotExistRsp(c)
+		return
+	}
+	var users int
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*) FROM user WHERE user_id = ?", req.UserID).Scan(&users)
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query prediction schedule failed, err: %v\n", err)
+		return
+	}
+	if users == 0 {
+		userNotExist(c)
+		return
+	}
+	if !open {
+		disableBet(c)
+		return
+	}
+
+	// 截止之前可以修改竞猜
+	_, err = db.Exec("INSERT INTO prediction(user_id, schedule_id, home_score, away_score, points, scored, updated_at) "+
+		"VALUES (?,?,?,?,0,?,?) ON DUPLICATE KEY UPDATE home_score = VALUES(home_score), "+
+		"away_score = VALUES(away_score), updated_at = VALUES(updated_at)",
+		req.UserID, req.ScheduleID, req.HomeScore, req.AwayScore, false, toDBTime(now))
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "save prediction failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+	})
+}
+
+func handlePredictions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	rows, err := db.Query("SELECT p.schedule_id, s.home_team, s.away_team, s.schedule_time, s.schedule_status, "+
+		"p.home_score, p.away_score, s.home_score, s.away_score, p.points, p.scored FROM prediction p "+
+		"JOIN schedule s ON s.schedule_id = p.schedule_id WHERE p.user_id = ? ORDER BY s.schedule_time", userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query predictions failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	predictions := []Prediction{}
+	total := 0
+	for rows.Next() {
+		var (
+			p                  Prediction
+			homeTeam, awayTeam string
+		)
+		err := rows.Scan(&p.ScheduleID, &homeTeam, &awayTeam, &p.ScheduleTime, &p.ScheduleStatus,
+			&p.HomeScore, &p.AwayScore, &p.ActualHome, &p.ActualAway, &p.Points, &p.Scored)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan prediction failed, err: %v\n", err)
+			return
+		}
+		p.HomeTeam = countryToID(homeTeam)
+		p.AwayTeam = countryToID(awayTeam)
+		p.ScheduleTime = formatAPITime(p.ScheduleTime)
+		total += p.Points
+		predictions = append(predictions, p)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"points":      total,
+		"predictions": predictions,
+	})
+}
+
+func handlePredictionRank(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(DISTINCT user_id) FROM prediction").Scan(&total)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query prediction rank failed, err: %v\n", err)
+		return
+	}
+	rows, err := db.Query("SELECT p.user_id, u.rtx_name, u.chinese_name, SUM(p.points) AS total_points, "+
+		"SUM(COALESCE(p.scored and p.home_score = s.home_score and p.away_score = s.away_score, 0)) AS exact_count, "+
+		"SUM(p.scored) FROM prediction p JOIN user u ON u.user_id = p.user_id "+
+		"JOIN schedule s ON s.schedule_id = p.schedule_id GROUP BY p.user_id "+
+		"ORDER BY total_points DESC, exact_count DESC, p.user_id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query prediction rank failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	ranks := []PredictionRank{}
+	for rows.Next() {
+		r := PredictionRank{Rank: (page-1)*pageSize + len(ranks) + 1}
+		err := rows.Scan(&r.UserID, &r.RTXName, &r.ChineseName, &r.Points, &r.ExactCount, &r.ScoredCount)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan prediction rank failed, err: %v\n", err)
+			return
+		}
+		ranks = append(ranks, r)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"desc":      "OK",
+		"rank":      ranks,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
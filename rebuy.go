@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 破产重买：余额低于 rebuy_threshold 的用户可以领取固定金额重新开始，
+// 整届比赛最多 rebuy_max_count 次。重买的金币和其他奖励一样不计入盈亏
+
+func rebuyCount(q queryer, userID int) (int, error) {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM reward WHERE user_id = ? and reward_type = ?",
+		userID, RewardRebuy).Scan(&count)
+	return count, err
+}
+
+func handleRebuy(c *gin.Context) {
+	var req DailyRewardRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	if !config.EnableRebuy {
+		rebuyNotAllowedRsp(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var money Money
+	err = tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", req.UserID).Scan(&money)
+	if err == sql.ErrNoRows {
+		userNotExist(c)
+		return
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query user failed, err: %v\n", err)
+		return
+	}
+	if money >= Coins(config.RebuyThreshold) {
+		rebuyNotAllowedRsp(c)
+		return
+	}
+	count, err := rebuyCount(tx, req.UserID)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query rebuy count failed, err: %v\n", err)
+		return
+	}
+	if count >= config.RebuyMaxCount {
+		rebuyNotAllowedRsp(c)
+		return
+	}
+
+	before := money
+	money, err = grantReward(tx, req.UserID, RewardGrant{RewardRebuy, Coins(config.RebuyMoney)}, time.Now())
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "rebuy failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{Action: "reward", UserID: req.UserID, Before: gin.H{"money": before},
+		After: gin.H{"rewards": []RewardGrant{{RewardRebuy, Coins(config.RebuyMoney)}}, "money": money}})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"money":       money,
+		"rebuy_count": count + 1,
+		"rebuy_left":  config.RebuyMaxCount - count - 1,
+	})
+}
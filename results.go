@@ -0,0 +1,691 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 比赛结果导入：定时从数据源拉取已经结束的比赛，按队名和开赛时间对应到 schedule_id，
+// 记到 pending_result 表里等管理员确认；开启 results_auto_settle 时直接结算。
+// 数据源通过 ResultProvider 接口接入，内置本地 JSON 文件和 HTTP JSON 两种，
+// 字段名通过 results_*_field 配置映射，支持用点号访问嵌套字段，例如 "score.home"
+
+type PendingResultStatus string
+
+const (
+	ResultPending     PendingResultStatus = "pending"      // 等待管理员确认
+	ResultUnmatched   PendingResultStatus = "unmatched"    // 没有找到对应的比赛，确认时需要指定 schedule_id
+	ResultApproved    PendingResultStatus = "approved"     // 管理员确认后已结算
+	ResultAutoSettled PendingResultStatus = "auto_settled" // 自动结算
+	ResultRejected    PendingResultStatus = "rejected"     // 管理员驳回
+)
+
+const (
+	defaultResultsPollInterval = 5 * time.Minute
+	defaultResultsMatchWindow  = 6 * time.Hour
+	resultsFetchTimeout        = 30 * time.Second
+)
+
+var errScheduleFinished = errors.New("schedule already has a result")
+
+// FeedResult 是数据源里的一场比赛，队名还是数据源里的写法
+type FeedResult struct {
+	ExternalID string
+	HomeTeam   string
+	AwayTeam   string
+	Kickoff    time.Time // 数据源没有开赛时间时为零值
+	HomeScore  int
+	AwayScore  int
+	Winner     string // 淘汰赛点球决胜时的胜者，可以是 home / away 或者队名
+	Finished   bool
+}
+
+type ResultProvider interface {
+	Name() string
+	Fetch() ([]FeedResult, error)
+}
+
+type PendingResult struct {
+	ResultID       int                 `json:"result_id"`
+	Provider       string              `json:"provider"`
+	ExternalID     string              `json:"external_id"`
+	ScheduleID     int                 `json:"schedule_id"`
+	HomeTeam       string              `json:"home_team"`
+	AwayTeam       string              `json:"away_team"`
+	HomeScore      int                 `json:"home_score"`
+	AwayScore      int                 `json:"away_score"`
+	Winner         string              `json:"winner"` // 数据源给出的点球胜者，没有时为空
+	ScheduleStatus ScheduleStatus      `json:"schedule_status"`
+	Status         PendingResultStatus `json:"status"`
+	CreatedAt      string              `json:"created_at"`
+	DecidedAt      *string             `json:"decided_at"`
+}
+
+// schedule_id 不为 0 时以它为准，用于确认没有自动对应上的结果
+type ResultDecisionRequest struct {
+	ResultID   int `json:"result_id"`
+	ScheduleID int `json:"schedule_id"`
+}
+
+// 数据源常用的英文队名
+var teamEnglishNames = map[string]string{
+	"russia": "俄罗斯", "saudi arabia": "沙特阿拉伯", "egypt": "埃及", "uruguay": "乌拉圭",
+	"morocco": "摩洛哥", "iran": "伊朗", "ir iran": "伊朗", "portugal": "葡萄牙", "spain": "西班牙",
+	"france": "法国", "australia": "澳大利亚", "argentina": "阿根廷", "iceland": "冰岛",
+	"peru": "秘鲁", "denmark": "丹麦", "croatia": "克罗地亚", "nigeria": "尼日利亚",
+	"costa rica": "哥斯达黎加", "serbia": "塞尔维亚", "germany": "德国", "mexico": "墨西哥",
+	"brazil": "巴西", "switzerland": "瑞士", "sweden": "瑞典", "korea republic": "韩国",
+	"south korea": "韩国", "belgium": "比利时", "panama": "巴拿马", "tunisia": "突尼斯",
+	"england": "英格兰", "colombia": "哥伦比亚", "japan": "日本", "poland": "波兰", "senegal": "塞内加尔",
+}
+
+// resolveTeam 把数据源里的队名转换成赛程里用的队名，找不到时返回空字符串
+func resolveTeam(name string) string {
+	name = strings.TrimSpace(name)
+	if _, ok := countryMap[name]; ok {
+		return name
+	}
+	for _, alias := range config.ResultsTeamAliases {
+		i := strings.LastIndex(alias, "=")
+		if i > 0 && strings.EqualFold(strings.TrimSpace(alias[:i]), name) {
+			return strings.TrimSpace(alias[i+1:])
+		}
+	}
+	return teamEnglishNames[strings.ToLower(name)]
+}
+
+// 字段映射，配置为空时使用默认字段名
+type feedMapping struct {
+	ListPath       string
+	ID             string
+	HomeTeam       string
+	AwayTeam       string
+	Kickoff        string
+	HomeScore      string
+	AwayScore      string
+	Status         string
+	Winner         string
+	FinishedValues []string
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func configFeedMapping() feedMapping {
+	finished := config.ResultsFinishedValues
+	if len(finished) == 0 {
+		finished = []string{"finished"}
+	}
+	return feedMapping{
+		ListPath:       config.ResultsListPath,
+		ID:             orDefault(config.ResultsIDField, "id"),
+		HomeTeam:       orDefault(config.ResultsHomeTeamField, "home_team"),
+		AwayTeam:       orDefault(config.ResultsAwayTeamField, "away_team"),
+		Kickoff:        orDefault(config.ResultsKickoffField, "kickoff"),
+		HomeScore:      orDefault(config.ResultsHomeScoreField, "home_score"),
+		AwayScore:      orDefault(config.ResultsAwayScoreField, "away_score"),
+		Status:         orDefault(config.ResultsStatusField, "status"),
+		Winner:         orDefault(config.ResultsWinnerField, "winner"),
+		FinishedValues: finished,
+	}
+}
+
+// lookupPath 按点号分隔的路径取 JSON 里的值，数组用下标访问
+func lookupPath(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func feedString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return ""
+}
+
+func feedInt(v interface{}) (int, bool) {
+	switch x := v.(type) {
+	case float64:
+		return int(x), x >= 0 && x == float64(int(x))
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(x))
+		return n, err == nil && n >= 0
+	}
+	return 0, false
+}
+
+// parseFeed 按字段映射解析数据源返回的 JSON，比分不完整的比赛视为还没结束，
+// 开赛时间解析不了的比赛跳过并打日志，不影响同一次拉取的其他比赛
+func parseFeed(body []byte, m feedMapping) ([]FeedResult, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	list, ok := lookupPath(doc, m.ListPath).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("results list %q is not an array", m.ListPath)
+	}
+
+	results := make([]FeedResult, 0, len(list))
+	for _, item := range list {
+		r := FeedResult{
+			ExternalID: feedString(lookupPath(item, m.ID)),
+			HomeTeam:   feedString(lookupPath(item, m.HomeTeam)),
+			AwayTeam:   feedString(lookupPath(item, m.AwayTeam)),
+			Winner:     feedString(lookupPath(item, m.Winner)),
+		}
+		if kickoff := feedString(lookupPath(item, m.Kickoff)); kickoff != "" {
+			t, err := parseInputTime(kickoff)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skip feed result %q %v vs %v with bad kickoff time %q: %v\n",
+					r.ExternalID, r.HomeTeam, r.AwayTeam, kickoff, err)
+				continue
+			}
+			r.Kickoff = t
+		}
+		status := feedString(lookupPath(item, m.Status))
+		for _, v := range m.FinishedValues {
+			if strings.EqualFold(status, v) {
+				r.Finished = true
+			}
+		}
+		var homeOK, awayOK bool
+		r.HomeScore, homeOK = feedInt(lookupPath(item, m.HomeScore))
+		r.AwayScore, awayOK = feedInt(lookupPath(item, m.AwayScore))
+		r.Finished = r.Finished && homeOK && awayOK
+		if r.ExternalID == "" {
+			r.ExternalID = fmt.Sprintf("%s|%s|%s", r.HomeTeam, r.AwayTeam, r.Kickoff.UTC().Format(time.RFC3339))
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// 本地 JSON 文件，适合手工维护或者由其他脚本生成
+type fileResultProvider struct {
+	path    string
+	mapping feedMapping
+}
+
+func (p fileResultProvider) Name() string {
+	return "file"
+}
+
+func (p fileResultProvider) Fetch() ([]FeedResult, error) {
+	body, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(body, p.mapping)
+}
+
+// 通用的 HTTP JSON 数据源，results_token 不为空时以 Bearer token 认证
+type httpResultProvider struct {
+	url     string
+	token   string
+	mapping feedMapping
+	client  *http.Client
+}
+
+func (p httpResultProvider) Name() string {
+	return "http"
+}
+
+func (p httpResultProvider) Fetch() ([]FeedResult, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", rsp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(body, p.mapping)
+}
+
+// newResultProvider 按配置创建数据源，没有配置时返回 nil
+func newResultProvider() (ResultProvider, error) {
+	switch config.ResultsProvider {
+	case "":
+		return nil, nil
+	case "file":
+		return fileResultProvider{path: config.ResultsSource, mapping: configFeedMapping()}, nil
+	case "http":
+		if !validWebhookURL(config.ResultsSource) {
+			return nil, fmt.Errorf("invalid results_source %q", config.ResultsSource)
+		}
+		return httpResultProvider{
+			url:     config.ResultsSource,
+			token:   config.ResultsToken,
+			mapping: configFeedMapping(),
+			client:  &http.Client{Timeout: resultsFetchTimeout},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown results_provider %q", config.ResultsProvider)
+}
+
+// resultStatus 按比分得出比赛结果，比分相同但有胜者（点球决胜）时以胜者为准
+func resultStatus(r FeedResult, homeTeam, awayTeam string) ScheduleStatus {
+	status := scoreOutcome(r.HomeScore, r.AwayScore)
+	if status != Draw || r.Winner == "" {
+		return status
+	}
+	switch winner := strings.ToLower(strings.TrimSpace(r.Winner)); {
+	case winner == "home" || resolveTeam(r.Winner) == homeTeam:
+		return HomeTeamWin
+	case winner == "away" || resolveTeam(r.Winner) == awayTeam:
+		return AwayTeamWin
+	}
+	return status
+}
+
+// matchSchedule 找到数据源里这场比赛对应的还没有结果的比赛。主客队和赛程相反时交换比分，
+// 返回的 FeedResult 按赛程里的主客队排列
+func matchSchedule(r FeedResult, now time.Time) (int, FeedResult, error) {
+	home, away := resolveTeam(r.HomeTeam), resolveTeam(r.AwayTeam)
+	if home == "" || away == "" {
+		return 0, r, nil
+	}
+
+	window := defaultResultsMatchWindow
+	if config.ResultsMatchWindowHours > 0 {
+		window = time.Duration(config.ResultsMatchWindowHours) * time.Hour
+	}
+	from, to := now.Add(-365*24*time.Hour), now
+	if !r.Kickoff.IsZero() {
+		from, to = r.Kickoff.Add(-window), r.Kickoff.Add(window)
+	}
+
+	var (
+		scheduleID   int
+		scheduleHome string
+	)
+	err := db.QueryRow("SELECT schedule_id, home_team FROM schedule WHERE ((home_team = ? and away_team = ?) or "+
+		"(home_team = ? and away_team = ?)) and schedule_status = ? and schedule_time >= ? and schedule_time <= ? "+
+		"ORDER BY schedule_time LIMIT 1", home, away, away, home, NotStarted, toDBTime(from), toDBTime(to)).
+		Scan(&scheduleID, &scheduleHome)
+	if err == sql.ErrNoRows {
+		return 0, r, nil
+	}
+	if err != nil {
+		return 0, r, err
+	}
+	if scheduleHome != home {
+		r = swapSides(r)
+	}
+	return scheduleID, r, nil
+}
+
+// swapSides 交换主客队以及对应的比分和点球胜者
+func swapSides(r FeedResult) FeedResult {
+	r.HomeTeam, r.AwayTeam = r.AwayTeam, r.HomeTeam
+	r.HomeScore, r.AwayScore = r.AwayScore, r.HomeScore
+	switch strings.ToLower(strings.TrimSpace(r.Winner)) {
+	case "home":
+		r.Winner = "away"
+	case "away":
+		r.Winner = "home"
+	}
+	return r
+}
+
+// applyResult 写入比赛结果并结算，两步在同一个事务里提交，不会出现有结果但没有结算的比赛。
+// 比赛已经有结果时返回 errScheduleFinished
+func applyResult(scheduleID int, status ScheduleStatus, homeScore, awayScore int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE schedule SET schedule_status = ?, home_score = ?, away_score = ?, disable_betting = ? "+
+		"WHERE schedule_id = ? and schedule_status = ?", status, homeScore, awayScore, true, scheduleID, NotStarted)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return errScheduleFinished
+	}
+	var (
+		mode         BettingMode
+		scheduleType ScheduleType
+	)
+	err = tx.QueryRow("SELECT betting_mode, schedule_type FROM schedule WHERE schedule_id = ?", scheduleID).
+		Scan(&mode, &scheduleType)
+	if err != nil {
+		return err
+	}
+	if !validKnockoutResult(scheduleType, status) {
+		return errKnockoutNeedWinner
+	}
+	changed, err := settleScheduleTx(tx, scheduleID, status, mode)
+	if err != nil {
+		return fmt.Errorf("settle schedule %v failed: %v", scheduleID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	return afterSettlement(scheduleID, status, mode)
+}
+
+// importResults 拉取一次数据源，已经导入过的比赛不会重复导入
+func importResults(now time.Time) error {
+	provider, err := newResultProvider()
+	if err != nil || provider == nil {
+		return err
+	}
+	_, err = importFrom(provider, now)
+	return err
+}
+
+func importFrom(provider ResultProvider, now time.Time) (int, error) {
+	results, err := provider.Fetch()
+	if err != nil {
+		return 0, fmt.Errorf("fetch results from %v failed: %v", provider.Name(), err)
+	}
+
+	imported := 0
+	for _, r := range results {
+		if !r.Finished {
+			continue
+		}
+		var exists int
+		err := db.QueryRow("SELECT COUNT(*) FROM pending_result WHERE provider = ? and external_id = ?",
+			provider.Name(), r.ExternalID).Scan(&exists)
+		if err != nil {
+			return imported, err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		scheduleID, r, err := matchSchedule(r, now)
+		if err != nil {
+			return imported, err
+		}
+		status, scheduleStatus := ResultUnmatched, NotStarted
+		if scheduleID != 0 {
+			status = ResultPending
+			scheduleStatus = resultStatus(r, resolveTeam(r.HomeTeam), resolveTeam(r.AwayTeam))
+		}
+		result, err := db.Exec("INSERT IGNORE INTO pending_result(provider, external_id, schedule_id, home_team, away_team, "+
+			"home_score, away_score, winner, schedule_status, status, created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?)",
+			provider.Name(), r.ExternalID, scheduleID, r.HomeTeam, r.AwayTeam, r.HomeScore, r.AwayScore,
+			r.Winner, scheduleStatus, status, toDBTime(now))
+		var affected int64
+		if err == nil {
+			affected, err = result.RowsAffected()
+		}
+		if err != nil {
+			return imported, err
+		}
+		if affected == 0 {
+			// 同时有另一次导入已经写入了这场比赛
+			continue
+		}
+		imported++
+
+		if status != ResultPending || !config.ResultsAutoSettle {
+			continue
+		}
+		resultID, err := result.LastInsertId()
+		if err != nil {
+			return imported, err
+		}
+		err = applyResult(scheduleID, scheduleStatus, r.HomeScore, r.AwayScore)
+		if err == errKnockoutNeedWinner {
+			// 淘汰赛打平但数据源没有给出点球胜者，留给管理员审核时确认
+			continue
+		}
+		if err == errScheduleFinished {
+			// 管理员已经手工录入了结果，这条不再需要处理
+			err = decideResult(int(resultID), scheduleID, ResultRejected, now)
+		} else if err == nil {
+			err = decideResult(int(resultID), scheduleID, ResultAutoSettled, now)
+		}
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+func decideResult(resultID, scheduleID int, status PendingResultStatus, now time.Time) error {
+	_, err := db.Exec("UPDATE pending_result SET status = ?, schedule_id = ?, decided_at = ? WHERE result_id = ?",
+		status, scheduleID, toDBTime(now), resultID)
+	return err
+}
+
+func queryPendingResult(resultID int) (PendingResult, error) {
+	var r PendingResult
+	err := db.QueryRow("SELECT result_id, provider, external_id, schedule_id, home_team, away_team, home_score, "+
+		"away_score, winner, schedule_status, status, created_at, decided_at FROM pending_result "+
+		"WHERE result_id = ?", resultID).
+		Scan(&r.ResultID, &r.Provider, &r.ExternalID, &r.ScheduleID, &r.HomeTeam, &r.AwayTeam, &r.HomeScore,
+			&r.AwayScore, &r.Winner, &r.ScheduleStatus, &r.Status, &r.CreatedAt, &r.DecidedAt)
+	return r, err
+}
+
+func handlePendingResults(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		illegalParametersRsp(c)
+		return
+	}
+	query := "SELECT result_id, provider, external_id, schedule_id, home_team, away_team, home_score, away_score, " +
+		"winner, schedule_status, status, created_at, decided_at FROM pending_result"
+	args := []interface{}{}
+	if status := c.Query("status"); status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := db.Query(query+" ORDER BY result_id DESC LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query pending results failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	results := []PendingResult{}
+	for rows.Next() {
+		var r PendingResult
+		err := rows.Scan(&r.ResultID, &r.Provider, &r.ExternalID, &r.ScheduleID, &r.HomeTeam, &r.AwayTeam,
+			&r.HomeScore, &r.AwayScore, &r.Winner, &r.ScheduleStatus, &r.Status, &r.CreatedAt, &r.DecidedAt)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan pending result failed, err: %v\n", err)
+			return
+		}
+		r.CreatedAt = formatAPITime(r.CreatedAt)
+		if r.DecidedAt != nil {
+			decidedAt := formatAPITime(*r.DecidedAt)
+			r.DecidedAt = &decidedAt
+		}
+		results = append(results, r)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"desc":      "OK",
+		"results":   results,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// handleApproveResult 确认导入的结果并结算。没有对应上的结果需要指定 schedule_id，
+// 这时按比分重新计算结果，队名能对应上并且主客队相反时交换比分
+func handleApproveResult(c *gin.Context) {
+	var req ResultDecisionRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	r, err := queryPendingResult(req.ResultID)
+	if err == sql.ErrNoRows {
+		pendingResultNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query pending result failed, err: %v\n", err)
+		return
+	}
+	if r.Status != ResultPending && r.Status != ResultUnmatched {
+		pendingResultNotExistRsp(c)
+		return
+	}
+	scheduleID := r.ScheduleID
+	if req.ScheduleID != 0 {
+		scheduleID = req.ScheduleID
+	}
+	if scheduleID == 0 {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var homeTeam, awayTeam string
+	err = db.QueryRow("SELECT home_team, away_team FROM schedule WHERE schedule_id = ?", scheduleID).Scan(&homeTeam, &awayTeam)
+	if err == sql.ErrNoRows {
+		scheduleNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query schedule %v failed, err: %v\n", scheduleID, err)
+		return
+	}
+	status := r.ScheduleStatus
+	if scheduleID != r.ScheduleID || status == NotStarted {
+		// 换了比赛或者导入时没有对应上，按这场比赛的主客队重新计算结果，点球决胜的胜者也要算上
+		fr := FeedResult{HomeTeam: r.HomeTeam, AwayTeam: r.AwayTeam, HomeScore: r.HomeScore, AwayScore: r.AwayScore,
+			Winner: r.Winner}
+		if resolveTeam(fr.HomeTeam) == awayTeam && resolveTeam(fr.AwayTeam) == homeTeam {
+			fr = swapSides(fr)
+		}
+		r.HomeScore, r.AwayScore = fr.HomeScore, fr.AwayScore
+		status = resultStatus(fr, homeTeam, awayTeam)
+	}
+
+	err = applyResult(scheduleID, status, r.HomeScore, r.AwayScore)
+	if err == errScheduleFinished {
+		scheduleFinishedRsp(c)
+		return
+	}
+	if err == errKnockoutNeedWinner {
+		illegalParametersRsp(c)
+		return
+	}
+	if err == nil {
+		err = decideResult(r.ResultID, scheduleID, ResultApproved, time.Now())
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "approve result %v failed, err: %v\n", r.ResultID, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":          0,
+		"desc":            "OK",
+		"schedule_id":     scheduleID,
+		"schedule_status": status,
+	})
+}
+
+func handleRejectResult(c *gin.Context) {
+	var req ResultDecisionRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	result, err := db.Exec("UPDATE pending_result SET status = ?, decided_at = ? WHERE result_id = ? and status in (?, ?)",
+		ResultRejected, toDBTime(time.Now()), req.ResultID, ResultPending, ResultUnmatched)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "reject result %v failed, err: %v\n", req.ResultID, err)
+		return
+	}
+	if affected == 0 {
+		pendingResultNotExistRsp(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
+}
+
+// handleImportResults 立即拉取一次数据源，不用等定时任务
+func handleImportResults(c *gin.Context) {
+	provider, err := newResultProvider()
+	if err != nil || provider == nil {
+		illegalParametersRsp(c)
+		return
+	}
+	imported, err := importFrom(provider, time.Now())
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "import results failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"desc":     "OK",
+		"imported": imported,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLookupPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"data": map[string]interface{}{
+			"matches": []interface{}{
+				map[string]interface{}{"id": "a"},
+				map[string]interface{}{"id": "b"},
+			},
+		},
+		"score": []interface{}{2.0, 1.0},
+	}
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"", doc},
+		{"data.matches.1.id", "b"},
+		{"score.0", 2.0},
+		{"score.2", nil},
+		{"score.-1", nil},
+		{"score.home", nil},
+		{"data.missing.id", nil},
+		{"data.matches.0.id.x", nil},
+	}
+	for _, tt := range tests {
+		if got := lookupPath(doc, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	defer func(loc *time.Location) { serverLocation = loc }(serverLocation)
+	serverLocation = time.FixedZone("CST", 8*3600)
+
+	nested := feedMapping{
+		ListPath:       "data.matches",
+		ID:             "match.id",
+		HomeTeam:       "teams.0.name",
+		AwayTeam:       "teams.1.name",
+		Kickoff:        "match.kickoff",
+		HomeScore:      "score.home",
+		AwayScore:      "score.away",
+		Status:         "match.state",
+		Winner:         "penalties.winner",
+		FinishedValues: []string{"FT", "AET"},
+	}
+	body := `{"data": {"matches": [
+		{"match": {"id": 101, "kickoff": "2018-06-14T15:00:00Z", "state": "ft"},
+		 "teams": [{"name": "Russia"}, {"name": "Saudi Arabia"}], "score": {"home": 5, "away": 0}},
+		{"match": {"id": "102", "kickoff": "2018-07-01 22:00:00", "state": "AET"},
+		 "teams": [{"name": "Spain"}, {"name": "Russia"}], "score": {"home": "1", "away": "1"},
+		 "penalties": {"winner": "away"}},
+		{"match": {"id": 103, "kickoff": "next tuesday", "state": "FT"},
+		 "teams": [{"name": "Brazil"}, {"name": "Mexico"}], "score": {"home": 2, "away": 0}},
+		{"match": {"id": 104, "kickoff": "2018-07-02T14:00:00Z", "state": "FT"},
+		 "teams": [{"name": "Belgium"}, {"name": "Japan"}], "score": {"home": 3}},
+		{"match": {"kickoff": "2018-07-03T14:00:00Z", "state": "live"},
+		 "teams": [{"name": "Sweden"}, {"name": "Switzerland"}], "score": {"home": 1, "away": 0}}
+	]}}`
+
+	got, err := parseFeed([]byte(body), nested)
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+	want := []FeedResult{
+		{ExternalID: "101", HomeTeam: "Russia", AwayTeam: "Saudi Arabia", HomeScore: 5, AwayScore: 0,
+			Kickoff: time.Date(2018, 6, 14, 15, 0, 0, 0, time.UTC), Finished: true},
+		{ExternalID: "102", HomeTeam: "Spain", AwayTeam: "Russia", HomeScore: 1, AwayScore: 1, Winner: "away",
+			Kickoff: time.Date(2018, 7, 1, 14, 0, 0, 0, time.UTC), Finished: true},
+		// 103 的开赛时间解析不了，跳过这一场，其他比赛照常导入
+		{ExternalID: "104", HomeTeam: "Belgium", AwayTeam: "Japan", HomeScore: 3,
+			Kickoff: time.Date(2018, 7, 2, 14, 0, 0, 0, time.UTC), Finished: false},
+		{ExternalID: "Sweden|Switzerland|2018-07-03T14:00:00Z", HomeTeam: "Sweden", AwayTeam: "Switzerland",
+			HomeScore: 1, Kickoff: time.Date(2018, 7, 3, 14, 0, 0, 0, time.UTC), Finished: false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseFeed returned %v results, want %v: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Kickoff.Equal(want[i].Kickoff) {
+			t.Errorf("result %v kickoff = %v, want %v", i, got[i].Kickoff, want[i].Kickoff)
+		}
+		got[i].Kickoff, want[i].Kickoff = time.Time{}, time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("result %v = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []struct {
+		body    string
+		mapping feedMapping
+	}{
+		{`not json`, nested},
+		{`{"data": {"matches": {}}}`, nested},
+		{`[{"id": 1}]`, feedMapping{ListPath: "data"}},
+	} {
+		if _, err := parseFeed([]byte(bad.body), bad.mapping); err == nil {
+			t.Errorf("parseFeed(%q) succeeded, want error", bad.body)
+		}
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	tests := []struct {
+		home, away int
+		winner     string
+		want       ScheduleStatus
+	}{
+		{2, 1, "", HomeTeamWin},
+		{0, 3, "", AwayTeamWin},
+		{1, 1, "", Draw},
+		{1, 1, "home", HomeTeamWin},
+		{1, 1, " Away ", AwayTeamWin},
+		{1, 1, "Russia", AwayTeamWin},
+		{1, 1, "西班牙", HomeTeamWin},
+		{1, 1, "Brazil", Draw},
+		{2, 1, "away", HomeTeamWin},
+	}
+	for _, tt := range tests {
+		r := FeedResult{HomeScore: tt.home, AwayScore: tt.away, Winner: tt.winner}
+		if got := resultStatus(r, "西班牙", "俄罗斯"); got != tt.want {
+			t.Errorf("resultStatus(%v-%v, winner %q) = %v, want %v", tt.home, tt.away, tt.winner, got, tt.want)
+		}
+	}
+}
+
+func TestSwapSides(t *testing.T) {
+	tests := []struct {
+		winner, want string
+	}{
+		{"", ""},
+		{"home", "away"},
+		{" Away ", "home"},
+		{"Russia", "Russia"},
+	}
+	for _, tt := range tests {
+		r := FeedResult{HomeTeam: "Spain", AwayTeam: "Russia", HomeScore: 1, AwayScore: 1, Winner: tt.winner}
+		want := FeedResult{HomeTeam: "Russia", AwayTeam: "Spain", HomeScore: 1, AwayScore: 1, Winner: tt.want}
+		got := swapSides(r)
+		if got != want {
+			t.Errorf("swapSides(winner %q) = %+v, want %+v", tt.winner, got, want)
+		}
+		// 交换前后点球胜者是同一支球队
+		before, after := resultStatus(r, "西班牙", "俄罗斯"), resultStatus(got, "俄罗斯", "西班牙")
+		if (before == Draw) != (after == Draw) || (before == HomeTeamWin) != (after == AwayTeamWin) {
+			t.Errorf("winner %q: result %v before swap, %v after", tt.winner, before, after)
+		}
+	}
+}
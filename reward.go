@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reward 表中每一条奖励的类型
+type RewardType string
+
+const (
+	RewardInitial       RewardType = "initial"         // 第一次登陆赠送
+	RewardDaily         RewardType = "daily"           // 每日奖励
+	RewardStreakBonus   RewardType = "streak_bonus"    // 连续领取每日奖励的额外奖励
+	RewardMatchDayBonus RewardType = "match_day_bonus" // 比赛日额外奖励
+	RewardBrokeTopUp    RewardType = "broke_top_up"    // 余额过低时的补助
+	RewardRebuy         RewardType = "rebuy"           // 破产重买
+)
+
+// 每种奖励在账本中对应的记账原因
+var rewardLedgerReasons = map[RewardType]LedgerReason{
+	RewardInitial:       LedgerInitialGrant,
+	RewardDaily:         LedgerDailyReward,
+	RewardStreakBonus:   LedgerStreakBonus,
+	RewardMatchDayBonus: LedgerMatchDayBonus,
+	RewardBrokeTopUp:    LedgerBrokeTopUp,
+	RewardRebuy:         LedgerRebuy,
+}
+
+// 计算每日奖励时需要的用户状态
+type rewardContext struct {
+	UserID     int
+	Now        time.Time
+	Balance    Money
+	StreakDays int  // 截止到昨天连续领取每日奖励的天数
+	IsMatchDay bool // 今天是否有比赛
+}
+
+type RewardGrant struct {
+	Type  RewardType `json:"reward_type"`
+	Money Money      `json:"reward_money"`
+}
+
+// rewardRule 返回这条规则发放的奖励，金额为 0 表示不发放
+type rewardRule func(ctx rewardContext) RewardGrant
+
+// 每日奖励规则，按顺序计算，新增规则只需要在这里追加
+var dailyRewardRules = []rewardRule{
+	func(ctx rewardContext) RewardGrant {
+		return RewardGrant{RewardDaily, Coins(config.DailyRewardMoney)}
+	},
+	func(ctx rewardContext) RewardGrant {
+		days := ctx.StreakDays
+		if config.StreakBonusMaxDays > 0 && days > config.StreakBonusMaxDays {
+			days = config.StreakBonusMaxDays
+		}
+		return RewardGrant{RewardStreakBonus, Coins(config.StreakBonusMoney * days)}
+	},
+	func(ctx rewardContext) RewardGrant {
+		if !ctx.IsMatchDay {
+			return RewardGrant{RewardMatchDayBonus, 0}
+		}
+		return RewardGrant{RewardMatchDayBonus, Coins(config.MatchDayBonusMoney)}
+	},
+	func(ctx rewardContext) RewardGrant {
+		if ctx.Balance >= Coins(config.BrokeThreshold) {
+			return RewardGrant{RewardBrokeTopUp, 0}
+		}
+		return RewardGrant{RewardBrokeTopUp, Coins(config.BrokeTopUpMoney)}
+	},
+}
+
+func evaluateDailyRewards(ctx rewardContext) []RewardGrant {
+	grants := []RewardGrant{}
+	for _, rule := range dailyRewardRules {
+		if grant := rule(ctx); grant.Money > 0 {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+// *sql.DB 和 *sql.Tx 都可以用来查询
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// isDailyReward 判断用户今天（按部署时区）是否还可以领取每日奖励
+func isDailyReward(q queryer, userID int, now time.Time) (bool, error) {
+	lowerBound, upperBound := dayBounds(now)
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM reward WHERE user_id = ? and reward_type = ? and reward_time >= ? and reward_time < ?",
+		userID, RewardDaily, toDBTime(lowerBound), toDBTime(upperBound)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	// 如果查到 reward 表中已经有了记录，说明今天已经送过金币
+	return count == 0, nil
+}
+
+// 截止到昨天，用户连续领取每日奖励的天数
+func dailyRewardStreak(q queryer, userID int, now time.Time) (int, error) {
+	today, _ := dayBounds(now)
+	rows, err := q.Query("SELECT reward_time FROM reward WHERE user_id = ? and reward_type = ? and reward_time < ? "+
+		"ORDER BY reward_time DESC", userID, RewardDaily, toDBTime(today))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	streak := 0
+	expected := today.AddDate(0, 0, -1)
+	for rows.Next() {
+		var rewardTime string
+		if err := rows.Scan(&rewardTime); err != nil {
+			return 0, err
+		}
+		t, err := fromDBTime(rewardTime)
+		if err != nil {
+			return 0, err
+		}
+		day, _ := dayBounds(t)
+		if day.Equal(expected) {
+			streak++
+			expected = expected.AddDate(0, 0, -1)
+			continue
+		}
+		if day.Before(expected) {
+			break
+		}
+	}
+	return streak, rows.Err()
+}
+
+func isMatchDay(q queryer, now time.Time) (bool, error) {
+	lowerBound, upperBound := dayBounds(now)
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM schedule WHERE schedule_time >= ? and schedule_time < ?",
+		toDBTime(lowerBound), toDBTime(upperBound)).Scan(&count)
+	return count > 0, err
+}
+
+// grantReward 在事务中写一条奖励记录并记账
+func grantReward(tx *sql.Tx, userID int, grant RewardGrant, now time.Time) (Money, error) {
+	_, err := tx.Exec("INSERT INTO reward(user_id, reward_time, reward_money, reward_type) VALUES (?,?,?,?)",
+		userID, toDBTime(now), grant.Money, grant.Type)
+	if err != nil {
+		return 0, err
+	}
+	return postLedger(tx, userID, grant.Money, rewardLedgerReasons[grant.Type], RefNone, 0)
+}
+
+func handleDailyReward(c *gin.Context) {
+	var req DailyRewardRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// 先锁住用户，避免同一个用户并发领取两次
+	ctx := rewardContext{UserID: req.UserID, Now: now}
+	err = tx.QueryRow("SELECT money FROM user WHERE user_id = ? FOR UPDATE", req.UserID).Scan(&ctx.Balance)
+	if err == sql.ErrNoRows {
+		userNotExist(c)
+		return
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query user failed, err: %v\n", err)
+		return
+	}
+
+	available, err := isDailyReward(tx, req.UserID, now)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query reward failed, err: %v\n", err)
+		return
+	}
+	if !available {
+		alreayGetDailyReward(c)
+		return
+	}
+	if ctx.StreakDays, err = dailyRewardStreak(tx, req.UserID, now); err == nil {
+		ctx.IsMatchDay, err = isMatchDay(tx, now)
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "evaluate reward rules failed, err: %v\n", err)
+		return
+	}
+
+	var (
+		grants = evaluateDailyRewards(ctx)
+		money  = ctx.Balance
+		total  Money
+	)
+	for _, grant := range grants {
+		if money, err = grantReward(tx, req.UserID, grant, now); err != nil {
+			operateMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "grant reward %v failed, err: %v\n", grant.Type, err)
+			return
+		}
+		total += grant.Money
+	}
+	if err := tx.Commit(); err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "commit reward failed, err: %v\n", err)
+		return
+	}
+	recordAudit(c, auditRecord{Action: "reward", UserID: req.UserID,
+		Before: gin.H{"money": ctx.Balance}, After: gin.H{"rewards": grants, "money": money}})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       0,
+		"desc":         "OK",
+		"rewards":      grants,
+		"reward_money": total,
+		"money":        money,
+		"streak_days":  ctx.StreakDays + 1,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultCutoffCheckInterval = 30 * time.Second
+
+type BettingClosedEvent struct {
+	ScheduleID   int    `json:"schedule_id"`
+	ScheduleTime string `json:"schedule_time"`
+}
+
+// 比赛的截止投注时间：开赛时间往前推 betting_cutoff_minutes 分钟
+func bettingDeadline(scheduleTime string) (time.Time, error) {
+	t, err := fromDBTime(scheduleTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(-time.Duration(config.BettingCutoffMinutes) * time.Minute), nil
+}
+
+// closeBetting 把比赛设置为不可投注，只有真正改变了状态的那一次才会发布事件
+func closeBetting(scheduleID int, scheduleTime string) error {
+	result, err := db.Exec("UPDATE schedule SET disable_betting = ? WHERE schedule_id = ? and disable_betting = ?",
+		true, scheduleID, false)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		bus.Publish(EventBettingClosed, BettingClosedEvent{
+			ScheduleID:   scheduleID,
+			ScheduleTime: formatAPITime(scheduleTime),
+		})
+	}
+	return nil
+}
+
+// closeDueSchedules 关闭所有已经过了截止投注时间但还开放投注的比赛。
+// 状态都在数据库里，所以服务重启之后第一次执行就会把错过的比赛补上
+func closeDueSchedules(now time.Time) error {
+	rows, err := db.Query("SELECT schedule_id, schedule_time FROM schedule WHERE disable_betting = ? and schedule_status = ?",
+		false, NotStarted)
+	if err != nil {
+		return err
+	}
+
+	type openSchedule struct {
+		id   int
+		time string
+	}
+	var open []openSchedule
+	for rows.Next() {
+		var s openSchedule
+		if err := rows.Scan(&s.id, &s.time); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range open {
+		deadline, err := bettingDeadline(s.time)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "parse schedule %v time %v failed, error: %v\n", s.id, s.time, err)
+			continue
+		}
+		if now.Before(deadline) {
+			continue
+		}
+		if err := closeBetting(s.id, s.time); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "close betting for schedule %v, schedule time: %v\n", s.id, s.time)
+	}
+	return nil
+}
+
+// runScheduler 在后台定时执行 task，单次执行出错或 panic 都不会让调度停止
+func runScheduler(name string, interval time.Duration, task func(now time.Time) error) {
+	run := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(os.Stderr, "scheduler %v panic: %v\n", name, r)
+			}
+		}()
+		if err := task(time.Now()); err != nil {
+			handleError(fmt.Errorf("scheduler %v failed: %v", name, err))
+		}
+	}
+
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		run()
+	}
+}
+
+func startSchedulers() {
+	interval := defaultCutoffCheckInterval
+	if config.CutoffCheckInterval > 0 {
+		interval = time.Duration(config.CutoffCheckInterval) * time.Second
+	}
+	go runScheduler("betting cutoff", interval, closeDueSchedules)
+	go runScheduler("challenge expiry", interval, expireDueChallenges)
+	go runScheduler("ledger reconciliation", defaultReconcileInterval, runReconciliation)
+
+	rankInterval := defaultLeaderboardRefresh
+	if config.RankRefreshSeconds > 0 {
+		rankInterval = time.Duration(config.RankRefreshSeconds) * time.Second
+	}
+	go runScheduler("leaderboard refresh", rankInterval, refreshLeaderboardTask)
+	go runScheduler("stats average", rankInterval, refreshStatsAverageTask)
+
+	go runScheduler("balance events", balancePollInterval, publishBalanceChanges)
+	if config.ResultsProvider != "" {
+		resultsInterval := defaultResultsPollInterval
+		if config.ResultsPollSeconds > 0 {
+			resultsInterval = time.Duration(config.ResultsPollSeconds) * time.Second
+		}
+		go runScheduler("results import", resultsInterval, importResults)
+	}
+
+	go runAchievementWorker()
+	go runWebhookWorker()
+	go runScheduler("notifications", notificationCheckInterval, runNotificationJobs)
+}
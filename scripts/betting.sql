@@ -4,32 +4,369 @@ CREATE TABLE IF NOT EXISTS `schedule` (
   schedule_id        INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
   home_team          VARCHAR(20),
   away_team          VARCHAR(20),
-  home_team_win_odds FLOAT(4,3),
-  away_team_win_odds FLOAT(4,3),
-  tied_odds          FLOAT(4,3),
+  home_team_win_odds INT,          -- 赔率，单位：千分之一
+  away_team_win_odds INT,
+  tied_odds          INT,
   schedule_time      DATETIME,
   schedule_group     VARCHAR(20),
   schedule_type      SMALLINT,
   schedule_status    SMALLINT,
-  disable_betting    SMALLINT
+  disable_betting    SMALLINT,
+  enable_display     SMALLINT,
+  betting_mode       SMALLINT NOT NULL DEFAULT 0,
+  home_score         INT NULL,     -- 比分，比赛结束后公布
+  away_score         INT NULL,
+  updated_at         DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- 日历订阅据此判断比赛是否有改动
+  settled_at         DATETIME NULL -- 第一次结算的时间，重复录入结果时据此判断不用再刷新排行榜、推送事件
 ) ENGINE = InnoDB DEFAULT CHARSET = utf8;
 
 CREATE TABLE IF NOT EXISTS `bet` (
-  user_id        varchar(200),
+  user_id        int,
   schedule_id    int,
-  betting_monery int,
+  betting_money  bigint,       -- 金额，单位：分
   betting_result int,
-  betting_odds   float(4,3),
+  betting_odds   int,          -- 赔率，单位：千分之一
+  bet_status     smallint,
+  win_money      bigint,
   PRIMARY KEY (user_id, schedule_id)
 )
   ENGINE = InnoDB
   DEFAULT CHARSET = utf8;
 
 CREATE TABLE IF NOT EXISTS `user` (
-  user_id      int,
-  rtx_name     varchar(200),
-  chinese_name varchar(200),
-  password     varchar(200),
-  money        float(10,4)
+  user_id               int NOT NULL AUTO_INCREMENT,
+  rtx_name              varchar(200),
+  chinese_name          varchar(200),
+  password              varchar(200),
+  money                 bigint,     -- 金额，单位：分
+  enable_reset_password smallint,
+  last_login_time       datetime,
+  win_count             int,
+  bet_count             int,
   PRIMARY KEY (user_id)
-) ENGINE = InnoDB DEFAULT CHARSET = utf8;
\ No newline at end of file
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `reward` (
+  user_id      int,
+  reward_time  datetime,
+  reward_money bigint,
+  reward_type  varchar(32) NOT NULL DEFAULT 'daily',
+  KEY (user_id, reward_time)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `tips` (
+  tips_id        int NOT NULL PRIMARY KEY,
+  content        varchar(1024),
+  enable_display smallint
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：增加奖池模式
+-- ALTER TABLE schedule ADD COLUMN betting_mode SMALLINT NOT NULL DEFAULT 0;
+
+-- 已有数据库升级：时间统一按 UTC 存储（原来按北京时间存储）
+-- UPDATE schedule SET schedule_time = CONVERT_TZ(schedule_time, '+08:00', '+00:00');
+-- UPDATE user SET last_login_time = CONVERT_TZ(last_login_time, '+08:00', '+00:00');
+-- UPDATE reward SET reward_time = CONVERT_TZ(reward_time, '+08:00', '+00:00');
+
+CREATE TABLE IF NOT EXISTS `ledger` (
+  entry_id   BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id    INT NOT NULL,
+  amount     BIGINT NOT NULL,
+  balance    BIGINT NOT NULL,
+  reason     VARCHAR(32) NOT NULL,
+  ref_type   VARCHAR(32) NOT NULL DEFAULT '',
+  ref_id     INT NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  KEY (user_id, entry_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：把上线账本之前的余额记为期初余额
+-- INSERT INTO ledger(user_id, amount, balance, reason, created_at)
+--   SELECT user_id, money, money, 'opening_balance', UTC_TIMESTAMP() FROM user;
+
+-- 已有数据库升级：金额改为以分为单位的整数，赔率改为以千分之一为单位的整数
+-- ALTER TABLE schedule MODIFY home_team_win_odds DECIMAL(10,3), MODIFY away_team_win_odds DECIMAL(10,3), MODIFY tied_odds DECIMAL(10,3);
+-- UPDATE schedule SET home_team_win_odds = ROUND(home_team_win_odds * 1000), away_team_win_odds = ROUND(away_team_win_odds * 1000), tied_odds = ROUND(tied_odds * 1000);
+-- ALTER TABLE schedule MODIFY home_team_win_odds INT, MODIFY away_team_win_odds INT, MODIFY tied_odds INT;
+-- ALTER TABLE bet MODIFY betting_odds DECIMAL(10,3), MODIFY win_money DECIMAL(16,4), MODIFY betting_money BIGINT;
+-- UPDATE bet SET betting_money = betting_money * 100, betting_odds = ROUND(betting_odds * 1000), win_money = ROUND(win_money * 100);
+-- ALTER TABLE bet MODIFY betting_odds INT, MODIFY win_money BIGINT;
+-- ALTER TABLE user MODIFY money DECIMAL(16,4);
+-- UPDATE user SET money = ROUND(money * 100);
+-- ALTER TABLE user MODIFY money BIGINT;
+-- ALTER TABLE reward MODIFY reward_money BIGINT;
+-- UPDATE reward SET reward_money = reward_money * 100;
+-- UPDATE ledger SET amount = ROUND(amount * 100), balance = ROUND(balance * 100);
+-- ALTER TABLE ledger MODIFY amount BIGINT NOT NULL, MODIFY balance BIGINT NOT NULL;
+
+-- 已有数据库升级：奖励增加类型，第一次登陆赠送的金币记为 initial
+-- ALTER TABLE reward ADD COLUMN reward_type VARCHAR(32) NOT NULL DEFAULT 'daily';
+-- UPDATE reward r JOIN (SELECT user_id, MIN(reward_time) t FROM reward GROUP BY user_id) f
+--   ON r.user_id = f.user_id AND r.reward_time = f.t SET r.reward_type = 'initial';
+
+CREATE TABLE IF NOT EXISTS `leaderboard_snapshot` (
+  snapshot_id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  schedule_id INT NOT NULL DEFAULT 0,
+  created_at  DATETIME NOT NULL,
+  KEY (created_at)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `leaderboard_snapshot_entry` (
+  snapshot_id    INT NOT NULL,
+  metric         VARCHAR(32) NOT NULL,
+  user_id        INT NOT NULL,
+  rank_no        INT NOT NULL,
+  money          BIGINT NOT NULL,
+  net_profit     BIGINT NOT NULL,
+  win_count      INT NOT NULL,
+  bet_count      INT NOT NULL,
+  settled_count  INT NOT NULL,
+  win_rate       DOUBLE NOT NULL,
+  roi            DOUBLE NOT NULL,
+  longest_streak INT NOT NULL,
+  PRIMARY KEY (snapshot_id, metric, user_id),
+  KEY (user_id, metric, snapshot_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `leaderboard_setting` (
+  setting_id   INT NOT NULL PRIMARY KEY,
+  display_rank BOOL NOT NULL DEFAULT TRUE,
+  snapshot_id  INT NOT NULL DEFAULT 0,
+  metric       VARCHAR(32) NOT NULL DEFAULT 'balance'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `user_group` (
+  group_id    INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  name        VARCHAR(64) NOT NULL,
+  kind        VARCHAR(16) NOT NULL,
+  invite_code VARCHAR(16) NULL,
+  owner_id    INT NOT NULL DEFAULT 0,
+  created_at  DATETIME NOT NULL,
+  UNIQUE KEY (kind, name),
+  UNIQUE KEY (invite_code)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `group_member` (
+  group_id  INT NOT NULL,
+  user_id   INT NOT NULL,
+  joined_at DATETIME NOT NULL,
+  PRIMARY KEY (group_id, user_id),
+  KEY (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `challenge` (
+  challenge_id      INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  schedule_id       INT NOT NULL,
+  challenger_id     INT NOT NULL,
+  opponent_id       INT NOT NULL,
+  challenger_result SMALLINT NOT NULL,
+  stake             BIGINT NOT NULL,
+  status            VARCHAR(16) NOT NULL,
+  winner_id         INT NOT NULL DEFAULT 0,
+  created_at        DATETIME NOT NULL,
+  accepted_at       DATETIME NULL,
+  closed_at         DATETIME NULL,
+  KEY (schedule_id, status),
+  KEY (challenger_id),
+  KEY (opponent_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `achievement` (
+  user_id        INT NOT NULL,
+  achievement_id VARCHAR(64) NOT NULL,
+  awarded_at     DATETIME NOT NULL,
+  PRIMARY KEY (user_id, achievement_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `futures_market` (
+  market_id   INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  name        VARCHAR(128) NOT NULL,
+  description VARCHAR(1024) NOT NULL DEFAULT '',
+  kind        VARCHAR(16) NOT NULL,
+  status      VARCHAR(16) NOT NULL,
+  created_at  DATETIME NOT NULL,
+  settled_at  DATETIME NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `futures_selection` (
+  selection_id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  market_id    INT NOT NULL,
+  team_id      INT NOT NULL DEFAULT 0,
+  name         VARCHAR(128) NOT NULL,
+  odds         INT NOT NULL,
+  status       VARCHAR(16) NOT NULL,
+  won          BOOL NOT NULL DEFAULT FALSE,
+  KEY (market_id),
+  KEY (team_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `futures_bet` (
+  bet_id        INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id       INT NOT NULL,
+  market_id     INT NOT NULL,
+  selection_id  INT NOT NULL,
+  betting_money BIGINT NOT NULL,
+  betting_odds  INT NOT NULL,
+  bet_status    SMALLINT NOT NULL DEFAULT 0,
+  win_money     BIGINT NOT NULL DEFAULT 0,
+  bet_time      DATETIME NOT NULL,
+  KEY (user_id),
+  KEY (market_id, bet_status)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：比赛增加比分
+-- ALTER TABLE schedule ADD COLUMN home_score INT NULL, ADD COLUMN away_score INT NULL;
+
+CREATE TABLE IF NOT EXISTS `prediction` (
+  user_id     INT NOT NULL,
+  schedule_id INT NOT NULL,
+  home_score  INT NOT NULL,
+  away_score  INT NOT NULL,
+  points      INT NOT NULL DEFAULT 0,
+  scored      BOOL NOT NULL DEFAULT FALSE,
+  updated_at  DATETIME NOT NULL,
+  PRIMARY KEY (user_id, schedule_id),
+  KEY (schedule_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `webhook` (
+  webhook_id  INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  url         VARCHAR(512) NOT NULL,
+  secret      VARCHAR(128) NOT NULL,
+  event_types VARCHAR(512) NOT NULL DEFAULT '', -- 逗号分隔，为空表示订阅全部事件
+  enabled     BOOL NOT NULL DEFAULT TRUE,
+  created_at  DATETIME NOT NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `webhook_delivery` (
+  delivery_id     INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  webhook_id      INT NOT NULL,
+  event_id        BIGINT NOT NULL,
+  event_type      VARCHAR(64) NOT NULL,
+  payload         MEDIUMTEXT NOT NULL,
+  status          VARCHAR(16) NOT NULL, -- pending / succeeded / failed
+  attempts        INT NOT NULL DEFAULT 0,
+  response_code   INT NOT NULL DEFAULT 0,
+  last_error      VARCHAR(1024) NOT NULL DEFAULT '',
+  next_attempt_at DATETIME NOT NULL,
+  created_at      DATETIME NOT NULL,
+  delivered_at    DATETIME NULL,
+  KEY (status, next_attempt_at),
+  KEY (webhook_id, delivery_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+CREATE TABLE IF NOT EXISTS `notification_preference` (
+  user_id        INT NOT NULL PRIMARY KEY,
+  email          VARCHAR(256) NOT NULL DEFAULT '',
+  webhook_url    VARCHAR(512) NOT NULL DEFAULT '',
+  enable_email   BOOL NOT NULL DEFAULT FALSE,
+  enable_webhook BOOL NOT NULL DEFAULT FALSE,
+  match_reminder BOOL NOT NULL DEFAULT TRUE,
+  settlement     BOOL NOT NULL DEFAULT TRUE,
+  daily_reward   BOOL NOT NULL DEFAULT TRUE
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 通知的 outbox，每个渠道一行；站内信渠道的记录就是用户的收件箱
+CREATE TABLE IF NOT EXISTS `notification` (
+  notification_id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id         INT NOT NULL,
+  kind            VARCHAR(32) NOT NULL,
+  dedup_key       VARCHAR(128) NOT NULL,
+  channel         VARCHAR(16) NOT NULL,
+  title           VARCHAR(256) NOT NULL,
+  content         VARCHAR(1024) NOT NULL,
+  status          VARCHAR(16) NOT NULL, -- pending / sent / failed
+  attempts        INT NOT NULL DEFAULT 0,
+  last_error      VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at      DATETIME NOT NULL,
+  sent_at         DATETIME NULL,
+  UNIQUE KEY (user_id, dedup_key, channel),
+  KEY (status, notification_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 从数据源导入的比赛结果，等待管理员确认或者已经自动结算
+CREATE TABLE IF NOT EXISTS `pending_result` (
+  result_id       INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  provider        VARCHAR(32) NOT NULL,
+  external_id     VARCHAR(191) NOT NULL,
+  schedule_id     INT NOT NULL DEFAULT 0, -- 0 表示没有找到对应的比赛
+  home_team       VARCHAR(128) NOT NULL,
+  away_team       VARCHAR(128) NOT NULL,
+  home_score      INT NOT NULL,
+  away_score      INT NOT NULL,
+  winner          VARCHAR(128) NOT NULL DEFAULT '', -- 点球决胜的胜者：home / away / 球队名，没有时为空
+  schedule_status INT NOT NULL,
+  status          VARCHAR(16) NOT NULL, -- pending / unmatched / approved / auto_settled / rejected
+  created_at      DATETIME NOT NULL,
+  decided_at      DATETIME NULL,
+  UNIQUE KEY (provider, external_id),
+  KEY (status)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：比赛增加修改时间，供日历订阅判断比赛是否有改动
+-- ALTER TABLE schedule ADD COLUMN updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+-- 管理员调整余额的记录，对应的账目在 ledger 里，reason 为 admin_grant 或 admin_correction
+CREATE TABLE IF NOT EXISTS `balance_adjustment` (
+  adjustment_id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  request_id    VARCHAR(64) NULL,              -- 客户端生成的请求 ID，重试时不会重复调整
+  entry_id      BIGINT NOT NULL,
+  user_id       INT NOT NULL,
+  amount        BIGINT NOT NULL,               -- 单位：分，负数为扣币
+  reason        VARCHAR(32) NOT NULL,          -- settlement_fix / compensation / prize / penalty / other
+  note          VARCHAR(512) NOT NULL DEFAULT '',
+  ref_type      VARCHAR(32) NOT NULL DEFAULT '', -- schedule / futures_bet
+  ref_id        INT NOT NULL DEFAULT 0,
+  operator      VARCHAR(64) NOT NULL DEFAULT '', -- 来自 X-Admin-Operator 头，服务端没有验证
+  created_at    DATETIME NOT NULL,
+  UNIQUE KEY (entry_id),
+  UNIQUE KEY (request_id),
+  KEY (user_id, adjustment_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：调整余额增加请求 ID，之前的记录为 NULL
+-- ALTER TABLE balance_adjustment ADD COLUMN request_id VARCHAR(64) NULL AFTER adjustment_id, ADD UNIQUE KEY (request_id);
+
+-- 审计日志，只追加不修改；生产环境可以只给服务端账号这张表的 INSERT 和 SELECT 权限：
+-- GRANT SELECT, INSERT ON betting.audit_log TO 'betting'@'%';
+CREATE TABLE IF NOT EXISTS `audit_log` (
+  audit_id     BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  actor_type   VARCHAR(16) NOT NULL,            -- user / admin / system
+  actor_id     INT NOT NULL DEFAULT 0,          -- actor_type 为 user 时是用户 ID
+  actor_name   VARCHAR(64) NOT NULL DEFAULT '', -- 管理操作的操作人，来自 X-Admin-Operator 头，服务端没有验证
+  action       VARCHAR(64) NOT NULL,
+  target_type  VARCHAR(32) NOT NULL DEFAULT '',
+  target_id    INT NOT NULL DEFAULT 0,
+  user_id      INT NOT NULL DEFAULT 0,          -- 涉及的用户
+  schedule_id  INT NOT NULL DEFAULT 0,          -- 涉及的比赛
+  before_value TEXT NOT NULL,                   -- JSON
+  after_value  TEXT NOT NULL,                   -- JSON
+  ip           VARCHAR(64) NOT NULL DEFAULT '',
+  created_at   DATETIME NOT NULL,
+  KEY (user_id, audit_id),
+  KEY (actor_type, actor_id, audit_id),
+  KEY (schedule_id, audit_id),
+  KEY (action, audit_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：比赛增加结算时间，已经有结果的比赛按修改时间算作已结算
+-- ALTER TABLE schedule ADD COLUMN settled_at DATETIME NULL;
+-- UPDATE schedule SET settled_at = updated_at WHERE schedule_status != 0;
+
+-- 复式记账中系统账户一方的分录：每一笔 ledger 都有一条金额相反的记录，对账时两边加起来必须为 0。
+-- 用户得到的金币都是从系统账户转出的，用户输掉、抽水的金币都转入系统账户
+CREATE TABLE IF NOT EXISTS `house_ledger` (
+  entry_id   BIGINT NOT NULL PRIMARY KEY,    -- 对应的 ledger.entry_id
+  amount     BIGINT NOT NULL,                -- 单位：分，等于 ledger.amount 的相反数
+  reason     VARCHAR(32) NOT NULL,
+  ref_type   VARCHAR(32) NOT NULL DEFAULT '',
+  ref_id     INT NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 已有数据库升级：给已有的账目补上系统账户的分录
+-- INSERT INTO house_ledger(entry_id, amount, reason, ref_type, ref_id, created_at)
+--   SELECT entry_id, -amount, reason, ref_type, ref_id, created_at FROM ledger;
+
+-- 已有数据库升级：待确认的比赛结果记录点球胜者，审核时重新计算结果要用到
+-- ALTER TABLE pending_result ADD COLUMN winner VARCHAR(128) NOT NULL DEFAULT '' AFTER away_score;
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 结算时从 bet 表中读出的一条未结算投注
+type unsettledBet struct {
+	UserID        int
+	BettingMoney  Money
+	BettingResult ScheduleStatus
+	BettingOdds   Odds
+}
+
+// unsettledBets 在结算事务中读出并锁住还没结算的投注，同时结算同一场比赛的请求会等前一个提交
+func unsettledBets(tx *sql.Tx, scheduleID int) ([]unsettledBet, error) {
+	rows, err := tx.Query("SELECT user_id, betting_money, betting_result, betting_odds FROM bet "+
+		"WHERE schedule_id = ? and bet_status = ? FOR UPDATE", scheduleID, BetNotFinish)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bets []unsettledBet
+	for rows.Next() {
+		var bet unsettledBet
+		if err := rows.Scan(&bet.UserID, &bet.BettingMoney, &bet.BettingResult, &bet.BettingOdds); err != nil {
+			return nil, err
+		}
+		bets = append(bets, bet)
+	}
+	return bets, rows.Err()
+}
+
+// afterSettlement 结算事务提交之后记审计日志、发布事件、刷新排行榜和计算比分竞猜的积分。
+// 比赛已经结算过、这次没有结算任何投注时调用方不再调用
+func afterSettlement(scheduleID int, result ScheduleStatus, mode BettingMode) error {
+	err := recordSystemAudit(db, auditRecord{
+		Action:     "settle_schedule",
+		TargetType: RefSchedule,
+		TargetID:   scheduleID,
+		ScheduleID: scheduleID,
+		After:      map[string]interface{}{"schedule_status": result, "betting_mode": mode},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "record settle audit of schedule %v failed, err: %v\n", scheduleID, err)
+	}
+	bus.Publish(EventScheduleSettled, ScheduleSettledEvent{scheduleID, result})
+	refreshLeaderboardAfterSettlement(scheduleID)
+	if err := scorePredictions(scheduleID); err != nil {
+		return fmt.Errorf("score predictions of schedule %v failed: %v", scheduleID, err)
+	}
+	return nil
+}
+
+// settleScheduleTx 遍历竞猜表，计算出每个人竞猜的结果，如果竞猜成功，增加相应用户的金币数，派彩都记入账本。
+// 在调用方的事务里结算，手动更新赛程和自动导入比赛结果都把写入结果和结算放在同一个事务里提交。
+// 第一次结算这场比赛或者结算了投注时返回 true，调用方在提交之后调用 afterSettlement
+func settleScheduleTx(tx *sql.Tx, scheduleID int, result ScheduleStatus, mode BettingMode) (bool, error) {
+	// 先锁住赛程，同一场比赛的结算依次进行
+	first, err := markScheduleSettled(tx, scheduleID)
+	if err != nil {
+		return false, err
+	}
+	bets, err := unsettledBets(tx, scheduleID)
+	if err != nil {
+		return false, err
+	}
+
+	var settled int
+	if mode == PoolBetting {
+		settled, err = settlePool(tx, scheduleID, result, bets)
+	} else {
+		settled, err = settleFixedOdds(tx, scheduleID, result, bets)
+	}
+	if err == nil {
+		err = settleChallenges(tx, scheduleID, result)
+	}
+	if err == nil {
+		err = settleFutures(tx, scheduleID, result)
+	}
+	if err != nil {
+		return false, err
+	}
+	changed := first || settled > 0
+	if changed {
+		if err := notifySettlement(tx, scheduleID, time.Now()); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// markScheduleSettled 记下比赛的结算时间，已经结算过时返回 false
+func markScheduleSettled(tx *sql.Tx, scheduleID int) (bool, error) {
+	result, err := tx.Exec("UPDATE schedule SET settled_at = ? WHERE schedule_id = ? and settled_at IS NULL",
+		toDBTime(time.Now()), scheduleID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func settleFixedOdds(tx *sql.Tx, scheduleID int, result ScheduleStatus, bets []unsettledBet) (int, error) {
+	var count int
+	for _, bet := range bets {
+		betStatus, winMoney := LostBet, -bet.BettingMoney
+		if bet.BettingResult == result {
+			betStatus, winMoney = WinBet, bet.BettingMoney.MulOdds(bet.BettingOdds)
+		}
+		settled, err := finishBet(tx, bet.UserID, scheduleID, betStatus, winMoney)
+		if err != nil {
+			return count, err
+		}
+		if !settled {
+			continue
+		}
+		count++
+		if betStatus == WinBet {
+			if err := creditWinner(tx, bet.UserID, scheduleID, winMoney+bet.BettingMoney); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// 奖池模式：所有投注进入奖池，扣除抽水后由赢家按投注比例瓜分
+func settlePool(tx *sql.Tx, scheduleID int, result ScheduleStatus, bets []unsettledBet) (int, error) {
+	pool := make([]poolBet, len(bets))
+	for i, bet := range bets {
+		pool[i] = poolBet{
+			UserID:        bet.UserID,
+			BettingResult: bet.BettingResult,
+			Stake:         bet.BettingMoney,
+		}
+	}
+
+	var count int
+	for i, payout := range computePoolPayouts(pool, result, houseCutBasisPoints()) {
+		var winMoney Money
+		switch payout.BetStatus {
+		case WinBet:
+			winMoney = payout.Payout - pool[i].Stake
+		case LostBet:
+			winMoney = -pool[i].Stake
+		}
+		settled, err := finishBet(tx, payout.UserID, scheduleID, payout.BetStatus, winMoney)
+		if err != nil {
+			return count, err
+		}
+		if !settled {
+			continue
+		}
+		count++
+		switch payout.BetStatus {
+		case WinBet:
+			err = creditWinner(tx, payout.UserID, scheduleID, payout.Payout)
+		case RefundBet:
+			_, err = postLedger(tx, payout.UserID, payout.Payout, LedgerRefund, RefSchedule, scheduleID)
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "settle pool schedule %v, bets: %v, house cut: %v%%\n",
+		scheduleID, count, config.PoolHouseCut)
+	return count, nil
+}
+
+func creditWinner(tx *sql.Tx, userID, scheduleID int, money Money) error {
+	if _, err := postLedger(tx, userID, money, LedgerPayout, RefSchedule, scheduleID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE user SET win_count = win_count + 1 WHERE user_id = ?", userID)
+	return err
+}
+
+// finishBet 更新一笔投注的结算结果，同时在事务里记审计日志。
+// 只更新还没结算的投注，返回 false 说明已经被别的请求结算过，调用方不能再派彩
+func finishBet(tx *sql.Tx, userID, scheduleID, betStatus int, winMoney Money) (bool, error) {
+	result, err := tx.Exec("UPDATE bet SET bet_status = ?, win_money = ? WHERE user_id = ? and schedule_id = ? and bet_status = ?",
+		betStatus, winMoney, userID, scheduleID, BetNotFinish)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+	return true, recordSystemAudit(tx, auditRecord{
+		Action:     "settle_bet",
+		TargetType: RefSchedule,
+		TargetID:   scheduleID,
+		UserID:     userID,
+		ScheduleID: scheduleID,
+		Before:     map[string]interface{}{"bet_status": BetNotFinish},
+		After:      map[string]interface{}{"bet_status": betStatus, "win_money": winMoney},
+	})
+}
+
+// voidSchedule 取消一场还没有结果的比赛：所有投注和挑战退还本金，长线竞猜不受影响。
+// 比赛已经有结果或者已经取消时返回 errScheduleFinished
+func voidSchedule(scheduleID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE schedule SET schedule_status = ?, disable_betting = ?, settled_at = ? "+
+		"WHERE schedule_id = ? and schedule_status = ?", Voided, true, toDBTime(time.Now()), scheduleID, NotStarted)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, errScheduleFinished
+	}
+
+	rows, err := tx.Query("SELECT user_id, betting_money FROM bet WHERE schedule_id = ? and bet_status = ? FOR UPDATE",
+		scheduleID, BetNotFinish)
+	if err != nil {
+		return 0, err
+	}
+	var bets []unsettledBet
+	for rows.Next() {
+		var bet unsettledBet
+		if err := rows.Scan(&bet.UserID, &bet.BettingMoney); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bets = append(bets, bet)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, bet := range bets {
+		settled, err := finishBet(tx, bet.UserID, scheduleID, RefundBet, 0)
+		if err != nil {
+			return 0, err
+		}
+		if !settled {
+			continue
+		}
+		if _, err := postLedger(tx, bet.UserID, bet.BettingMoney, LedgerRefund, RefSchedule, scheduleID); err != nil {
+			return 0, err
+		}
+	}
+
+	challenges, err := scheduleChallenges(tx, scheduleID, ChallengePending, ChallengeAccepted)
+	if err != nil {
+		return 0, err
+	}
+	for _, ch := range challenges {
+		if err := closeChallengeBySystem(tx, ch, ChallengeCancelled); err != nil {
+			return 0, err
+		}
+	}
+	return len(bets), tx.Commit()
+}
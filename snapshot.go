@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/gin-gonic/gin"
+)
+
+// 每场比赛结算之后把排行榜保存为一个快照，用于查询名次变化，
+// 管理员也可以把某个快照冻结为对外展示的排行榜
+
+type LeaderboardSnapshot = types.LeaderboardSnapshot
+
+type RankHistory struct {
+	LeaderboardSnapshot
+	Rank      int   `json:"rank"`
+	Money     Money `json:"money"`
+	NetProfit Money `json:"net_profit"`
+}
+
+// 对外展示的排行榜设置，持久化在 leaderboard_setting 表中，重启后不会丢失
+type rankSetting struct {
+	mu         sync.RWMutex
+	display    bool
+	snapshotID int // 冻结的快照，0 表示展示实时排行榜
+	metric     RankMetric
+	frozen     []RankRsp
+}
+
+var rankDisplay = &rankSetting{display: true, metric: RankByBalance}
+
+func takeLeaderboardSnapshot(scheduleID int, boards map[RankMetric][]RankRsp, now time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO leaderboard_snapshot(schedule_id, created_at) VALUES (?,?)",
+		scheduleID, toDBTime(now))
+	if err != nil {
+		return 0, err
+	}
+	snapshotID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO leaderboard_snapshot_entry(snapshot_id, metric, user_id, rank_no, money, " +
+		"net_profit, win_count, bet_count, settled_count, win_rate, roi, longest_streak) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, metric := range rankMetrics {
+		for _, r := range boards[metric] {
+			_, err := stmt.Exec(snapshotID, metric, r.UserID, r.Rank, r.Money, r.NetProfit, r.WinCount,
+				r.BetCount, r.SettledCount, r.WinRate, r.ROI, r.LongestStreak)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int(snapshotID), tx.Commit()
+}
+
+// 最近一个比赛日结束时的名次：取今天（按部署时区）之前的最后一个快照
+func baselineRanks(now time.Time) (map[RankMetric]map[int]int, error) {
+	today, _ := dayBounds(now)
+	var snapshotID int
+	err := db.QueryRow("SELECT snapshot_id FROM leaderboard_snapshot WHERE created_at < ? ORDER BY snapshot_id DESC LIMIT 1",
+		toDBTime(today)).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT metric, user_id, rank_no FROM leaderboard_snapshot_entry WHERE snapshot_id = ?", snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranks := make(map[RankMetric]map[int]int)
+	for rows.Next() {
+		var (
+			metric RankMetric
+			userID int
+			rank   int
+		)
+		if err := rows.Scan(&metric, &userID, &rank); err != nil {
+			return nil, err
+		}
+		if ranks[metric] == nil {
+			ranks[metric] = make(map[int]int)
+		}
+		ranks[metric][userID] = rank
+	}
+	return ranks, rows.Err()
+}
+
+func snapshotExists(snapshotID int) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM leaderboard_snapshot WHERE snapshot_id = ?", snapshotID).Scan(&count)
+	return count > 0, err
+}
+
+func snapshotBoard(snapshotID int, metric RankMetric) ([]RankRsp, error) {
+	rows, err := db.Query("SELECT e.rank_no, e.user_id, u.rtx_name, u.chinese_name, e.money, e.net_profit, e.win_count, "+
+		"e.bet_count, e.settled_count, e.win_rate, e.roi, e.longest_streak FROM leaderboard_snapshot_entry e "+
+		"JOIN user u ON u.user_id = e.user_id WHERE e.snapshot_id = ? and e.metric = ? ORDER BY e.rank_no",
+		snapshotID, metric)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	board := []RankRsp{}
+	for rows.Next() {
+		var r RankRsp
+		err := rows.Scan(&r.Rank, &r.UserID, &r.RTXName, &r.ChineseName, &r.Money, &r.NetProfit, &r.WinCount,
+			&r.BetCount, &r.SettledCount, &r.WinRate, &r.ROI, &r.LongestStreak)
+		if err != nil {
+			return nil, err
+		}
+		board = append(board, r)
+	}
+	return board, rows.Err()
+}
+
+func leaderboardSnapshots(limit int) ([]LeaderboardSnapshot, error) {
+	rows, err := db.Query("SELECT snapshot_id, schedule_id, created_at FROM leaderboard_snapshot "+
+		"ORDER BY snapshot_id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []LeaderboardSnapshot{}
+	for rows.Next() {
+		var s LeaderboardSnapshot
+		if err := rows.Scan(&s.SnapshotID, &s.ScheduleID, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.CreatedAt = formatAPITime(s.CreatedAt)
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+func rankHistory(userID int, metric RankMetric) ([]RankHistory, error) {
+	rows, err := db.Query("SELECT s.snapshot_id, s.schedule_id, s.created_at, e.rank_no, e.money, e.net_profit "+
+		"FROM leaderboard_snapshot_entry e JOIN leaderboard_snapshot s ON s.snapshot_id = e.snapshot_id "+
+		"WHERE e.user_id = ? and e.metric = ? ORDER BY s.snapshot_id", userID, metric)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []RankHistory{}
+	for rows.Next() {
+		var h RankHistory
+		err := rows.Scan(&h.SnapshotID, &h.ScheduleID, &h.CreatedAt, &h.Rank, &h.Money, &h.NetProfit)
+		if err != nil {
+			return nil, err
+		}
+		h.CreatedAt = formatAPITime(h.CreatedAt)
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+// loadRankSetting 启动时恢复管理员设置的排行榜展示状态
+func loadRankSetting() error {
+	var (
+		display    bool
+		snapshotID int
+		metric     RankMetric
+	)
+	err := db.QueryRow("SELECT display_rank, snapshot_id, metric FROM leaderboard_setting WHERE setting_id = 1").
+		Scan(&display, &snapshotID, &metric)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return rankDisplay.set(display, snapshotID, metric)
+}
+
+func (s *rankSetting) set(display bool, snapshotID int, metric RankMetric) error {
+	frozen := []RankRsp{}
+	if snapshotID > 0 {
+		board, err := snapshotBoard(snapshotID, metric)
+		if err != nil {
+			return err
+		}
+		frozen = board
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.display = display
+	s.snapshotID = snapshotID
+	s.metric = metric
+	s.frozen = frozen
+	return nil
+}
+
+func (s *rankSetting) get() (bool, int, RankMetric, []RankRsp) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.display, s.snapshotID, s.metric, s.frozen
+}
+
+func saveRankSetting(display bool, snapshotID int, metric RankMetric) error {
+	_, err := db.Exec("INSERT INTO leaderboard_setting(setting_id, display_rank, snapshot_id, metric) VALUES (1,?,?,?) "+
+		"ON DUPLICATE KEY UPDATE display_rank = VALUES(display_rank), snapshot_id = VALUES(snapshot_id), "+
+		"metric = VALUES(metric)", display, snapshotID, metric)
+	return err
+}
+
+func handleRankHistory(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	metric, ok := parseRankMetric(c.Query("metric"))
+	if err != nil || !ok {
+		illegalParametersRsp(c)
+		return
+	}
+
+	history, err := rankHistory(userID, metric)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query rank history failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"desc":    "OK",
+		"metric":  metric,
+		"history": history,
+	})
+}
+
+func handleRankSnapshots(c *gin.Context) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 500 {
+			illegalParametersRsp(c)
+			return
+		}
+	}
+
+	snapshots, err := leaderboardSnapshots(limit)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query leaderboard snapshots failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"desc":      "OK",
+		"snapshots": snapshots,
+	})
+}
+
+// 管理员设置排行榜是否展示，以及冻结在哪个快照上；snapshot_id 为 0 表示展示实时排行榜
+func handleUpdateRanks(c *gin.Context) {
+	var req UpdateRankReq
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	metric, ok := parseRankMetric(req.Metric)
+	if !ok || req.SnapshotID < 0 {
+		illegalParametersRsp(c)
+		return
+	}
+	if req.SnapshotID > 0 {
+		exists, err := snapshotExists(req.SnapshotID)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "query leaderboard snapshot failed, err: %v\n", err)
+			return
+		}
+		if !exists {
+			snapshotNotExistRsp(c)
+			return
+		}
+	}
+
+	display, snapshotID, oldMetric, _ := rankDisplay.get()
+	if err := saveRankSetting(req.EnableDisplayRank, req.SnapshotID, metric); err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "save rank setting failed, err: %v\n", err)
+		return
+	}
+	if err := rankDisplay.set(req.EnableDisplayRank, req.SnapshotID, metric); err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "load leaderboard snapshot %v failed, err: %v\n", req.SnapshotID, err)
+		return
+	}
+	recordAudit(c, auditRecord{
+		Action: "update_ranks",
+		Before: UpdateRankReq{EnableDisplayRank: display, SnapshotID: snapshotID, Metric: string(oldMetric)},
+		After:  UpdateRankReq{EnableDisplayRank: req.EnableDisplayRank, SnapshotID: req.SnapshotID, Metric: string(metric)},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": 0,
+		"desc":   "OK",
+	})
+}
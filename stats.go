@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户投注统计：都从 bet 表计算，compare=true 时同时返回所有用户的平均值用于对比。
+// 比赛取消或者奖池退还本金的投注不算输赢，和未结算的投注一样不计入胜率和收益
+
+type StageStats struct {
+	ScheduleType ScheduleType `json:"schedule_type"`
+	BetCount     int          `json:"bet_count"`
+	WinCount     int          `json:"win_count"`
+	WinRate      float64      `json:"win_rate"`
+	NetProfit    Money        `json:"net_profit"`
+}
+
+// 按支持的球队统计：押主队胜算主队，押客队胜算客队，押平局的不计入
+type TeamStats struct {
+	TeamID    int     `json:"team_id"`
+	BetCount  int     `json:"bet_count"`
+	WinCount  int     `json:"win_count"`
+	WinRate   float64 `json:"win_rate"`
+	NetProfit Money   `json:"net_profit"`
+}
+
+type UserStats struct {
+	BetCount      int          `json:"bet_count"`
+	SettledCount  int          `json:"settled_count"`
+	PendingStake  Money        `json:"pending_stake"`  // 还未结算的投注金额
+	TotalStaked   Money        `json:"total_staked"`   // 已结算投注的本金
+	TotalReturned Money        `json:"total_returned"` // 已结算投注返还的金额（含本金）
+	NetProfit     Money        `json:"net_profit"`
+	ROI           float64      `json:"roi"`
+	WinRate       float64      `json:"win_rate"`
+	AverageOdds   Odds         `json:"average_odds"`   // 固定赔率投注的平均赔率
+	BiggestWin    Money        `json:"biggest_win"`    // 单场最大净收益
+	CurrentStreak int          `json:"current_streak"` // 正数为当前连胜，负数为当前连败
+	BestStreak    int          `json:"best_streak"`
+	ByStage       []StageStats `json:"by_stage"`
+	ByTeam        []TeamStats  `json:"by_team"`
+}
+
+type statsBet struct {
+	UserID        int
+	ScheduleType  ScheduleType
+	HomeTeam      string
+	AwayTeam      string
+	BettingMoney  Money
+	BettingResult ScheduleStatus
+	BettingOdds   Odds
+	BetStatus     int
+	WinMoney      Money
+}
+
+// loadStatsBets 按比赛时间顺序读出投注，userID 为 0 时读出所有用户的投注
+func loadStatsBets(userID int) (map[int][]statsBet, error) {
+	query := "SELECT b.user_id, s.schedule_type, s.home_team, s.away_team, b.betting_money, b.betting_result, " +
+		"b.betting_odds, b.bet_status, b.win_money FROM bet b JOIN schedule s ON s.schedule_id = b.schedule_id"
+	args := []interface{}{}
+	if userID != 0 {
+		query += " WHERE b.user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.Query(query+" ORDER BY s.schedule_time, s.schedule_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bets := make(map[int][]statsBet)
+	for rows.Next() {
+		var b statsBet
+		err := rows.Scan(&b.UserID, &b.ScheduleType, &b.HomeTeam, &b.AwayTeam, &b.BettingMoney, &b.BettingResult,
+			&b.BettingOdds, &b.BetStatus, &b.WinMoney)
+		if err != nil {
+			return nil, err
+		}
+		bets[b.UserID] = append(bets[b.UserID], b)
+	}
+	return bets, rows.Err()
+}
+
+func computeStats(bets []statsBet) UserStats {
+	stats := UserStats{BetCount: len(bets), ByStage: []StageStats{}, ByTeam: []TeamStats{}}
+	stages := make(map[ScheduleType]*StageStats)
+	teams := make(map[int]*TeamStats)
+	var (
+		wins, streak int
+		oddsSum      Odds
+		oddsCount    int
+	)
+	for _, b := range bets {
+		if b.BetStatus == BetNotFinish {
+			stats.PendingStake += b.BettingMoney
+			continue
+		}
+		if b.BetStatus == RefundBet {
+			continue
+		}
+		stats.SettledCount++
+		stats.TotalStaked += b.BettingMoney
+		stats.TotalReturned += b.BettingMoney + b.WinMoney
+		if b.BettingOdds > 0 {
+			oddsSum += b.BettingOdds
+			oddsCount++
+		}
+		if b.WinMoney > stats.BiggestWin {
+			stats.BiggestWin = b.WinMoney
+		}
+
+		won := b.BetStatus == WinBet
+		switch b.BetStatus {
+		case WinBet:
+			wins++
+			if streak < 0 {
+				streak = 0
+			}
+			streak++
+			if streak > stats.BestStreak {
+				stats.BestStreak = streak
+			}
+		case LostBet:
+			if streak > 0 {
+				streak = 0
+			}
+			streak--
+		}
+
+		stage := stages[b.ScheduleType]
+		if stage == nil {
+			stage = &StageStats{ScheduleType: b.ScheduleType}
+			stages[b.ScheduleType] = stage
+		}
+		stage.BetCount++
+		stage.NetProfit += b.WinMoney
+		if won {
+			stage.WinCount++
+		}
+
+		var teamID int
+		switch b.BettingResult {
+		case HomeTeamWin:
+			teamID = countryToID(b.HomeTeam)
+		case AwayTeamWin:
+			teamID = countryToID(b.AwayTeam)
+		default:
+			continue
+		}
+		team := teams[teamID]
+		if team == nil {
+			team = &TeamStats{TeamID: teamID}
+			teams[teamID] = team
+		}
+		team.BetCount++
+		team.NetProfit += b.WinMoney
+		if won {
+			team.WinCount++
+		}
+	}
+
+	stats.CurrentStreak = streak
+	stats.NetProfit = stats.TotalReturned - stats.TotalStaked
+	stats.ROI = ratio(float64(stats.NetProfit), float64(stats.TotalStaked))
+	stats.WinRate = ratio(float64(wins), float64(stats.SettledCount))
+	if oddsCount > 0 {
+		stats.AverageOdds = Odds(roundDiv(int64(oddsSum), int64(oddsCount)))
+	}
+	for _, s := range stages {
+		s.WinRate = ratio(float64(s.WinCount), float64(s.BetCount))
+		stats.ByStage = append(stats.ByStage, *s)
+	}
+	for _, t := range teams {
+		t.WinRate = ratio(float64(t.WinCount), float64(t.BetCount))
+		stats.ByTeam = append(stats.ByTeam, *t)
+	}
+	sort.Slice(stats.ByStage, func(i, j int) bool { return stats.ByStage[i].ScheduleType < stats.ByStage[j].ScheduleType })
+	sort.Slice(stats.ByTeam, func(i, j int) bool {
+		if stats.ByTeam[i].BetCount != stats.ByTeam[j].BetCount {
+			return stats.ByTeam[i].BetCount > stats.ByTeam[j].BetCount
+		}
+		return stats.ByTeam[i].TeamID < stats.ByTeam[j].TeamID
+	})
+	return stats
+}
+
+func averageMoney(sum Money, n int) Money {
+	return Money(roundDiv(int64(sum), int64(n)))
+}
+
+func averageFloat(sum float64, n int) float64 {
+	return ratio(sum, float64(n))
+}
+
+// averageStats 计算所有下过注的用户的平均值，按阶段和球队的统计只在有相关投注的用户之间平均
+func averageStats(all []UserStats) UserStats {
+	avg := UserStats{ByStage: []StageStats{}, ByTeam: []TeamStats{}}
+	n := len(all)
+	if n == 0 {
+		return avg
+	}
+
+	var (
+		betCount, settledCount, currentStreak, bestStreak int
+		pending, staked, returned, profit, biggest        Money
+		roi, winRate                                      float64
+		oddsSum                                           Odds
+		oddsUsers                                         int
+		stageSums                                         = make(map[ScheduleType]*StageStats)
+		stageUsers                                        = make(map[ScheduleType]int)
+		stageRates                                        = make(map[ScheduleType]float64)
+		teamSums                                          = make(map[int]*TeamStats)
+		teamUsers                                         = make(map[int]int)
+		teamRates                                         = make(map[int]float64)
+	)
+	for _, s := range all {
+		betCount += s.BetCount
+		settledCount += s.SettledCount
+		pending += s.PendingStake
+		staked += s.TotalStaked
+		returned += s.TotalReturned
+		profit += s.NetProfit
+		roi += s.ROI
+		winRate += s.WinRate
+		biggest += s.BiggestWin
+		currentStreak += s.CurrentStreak
+		bestStreak += s.BestStreak
+		if s.AverageOdds > 0 {
+			oddsSum += s.AverageOdds
+			oddsUsers++
+		}
+		for _, stage := range s.ByStage {
+			sum := stageSums[stage.ScheduleType]
+			if sum == nil {
+				sum = &StageStats{ScheduleType: stage.ScheduleType}
+				stageSums[stage.ScheduleType] = sum
+			}
+			sum.BetCount += stage.BetCount
+			sum.WinCount += stage.WinCount
+			sum.NetProfit += stage.NetProfit
+			stageUsers[stage.ScheduleType]++
+			stageRates[stage.ScheduleType] += stage.WinRate
+		}
+		for _, team := range s.ByTeam {
+			sum := teamSums[team.TeamID]
+			if sum == nil {
+				sum = &TeamStats{TeamID: team.TeamID}
+				teamSums[team.TeamID] = sum
+			}
+			sum.BetCount += team.BetCount
+			sum.WinCount += team.WinCount
+			sum.NetProfit += team.NetProfit
+			teamUsers[team.TeamID]++
+			teamRates[team.TeamID] += team.WinRate
+		}
+	}
+
+	avg.BetCount = betCount / n
+	avg.SettledCount = settledCount / n
+	avg.PendingStake = averageMoney(pending, n)
+	avg.TotalStaked = averageMoney(staked, n)
+	avg.TotalReturned = averageMoney(returned, n)
+	avg.NetProfit = averageMoney(profit, n)
+	avg.ROI = averageFloat(roi, n)
+	avg.WinRate = averageFloat(winRate, n)
+	avg.BiggestWin = averageMoney(biggest, n)
+	avg.CurrentStreak = currentStreak / n
+	avg.BestStreak = bestStreak / n
+	if oddsUsers > 0 {
+		avg.AverageOdds = Odds(roundDiv(int64(oddsSum), int64(oddsUsers)))
+	}
+	for stageType, sum := range stageSums {
+		users := stageUsers[stageType]
+		avg.ByStage = append(avg.ByStage, StageStats{
+			ScheduleType: stageType,
+			BetCount:     sum.BetCount / users,
+			WinCount:     sum.WinCount / users,
+			WinRate:      averageFloat(stageRates[stageType], users),
+			NetProfit:    averageMoney(sum.NetProfit, users),
+		})
+	}
+	for teamID, sum := range teamSums {
+		users := teamUsers[teamID]
+		avg.ByTeam = append(avg.ByTeam, TeamStats{
+			TeamID:    teamID,
+			BetCount:  sum.BetCount / users,
+			WinCount:  sum.WinCount / users,
+			WinRate:   averageFloat(teamRates[teamID], users),
+			NetProfit: averageMoney(sum.NetProfit, users),
+		})
+	}
+	sort.Slice(avg.ByStage, func(i, j int) bool { return avg.ByStage[i].ScheduleType < avg.ByStage[j].ScheduleType })
+	sort.Slice(avg.ByTeam, func(i, j int) bool { return avg.ByTeam[i].TeamID < avg.ByTeam[j].TeamID })
+	return avg
+}
+
+// 平均值要扫描整张 bet 表，和排行榜一样在后台定时计算好，请求时直接返回
+type statsAverage struct {
+	mu        sync.RWMutex
+	average   UserStats
+	userCount int
+	ready     bool
+}
+
+var averageCache = &statsAverage{}
+
+func (a *statsAverage) get() (UserStats, int, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.average, a.userCount, a.ready
+}
+
+func refreshStatsAverage() error {
+	bets, err := loadStatsBets(0)
+	if err != nil {
+		return err
+	}
+	all := make([]UserStats, 0, len(bets))
+	for _, userBets := range bets {
+		all = append(all, computeStats(userBets))
+	}
+	average := averageStats(all)
+
+	averageCache.mu.Lock()
+	defer averageCache.mu.Unlock()
+	averageCache.average, averageCache.userCount, averageCache.ready = average, len(all), true
+	return nil
+}
+
+func refreshStatsAverageTask(now time.Time) error {
+	return refreshStatsAverage()
+}
+
+func handleStats(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userID <= 0 {
+		illegalParametersRsp(c)
+		return
+	}
+	compare := c.Query("compare") == "true"
+
+	bets, err := loadStatsBets(userID)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query stats failed, err: %v\n", err)
+		return
+	}
+
+	rsp := gin.H{
+		"status": 0,
+		"desc":   "OK",
+		"stats":  computeStats(bets[userID]),
+	}
+	if compare {
+		average, userCount, ready := averageCache.get()
+		if !ready {
+			// 启动之后还没有算过
+			if err := refreshStatsAverage(); err != nil {
+				queryMySQLFailedRsp(c)
+				fmt.Fprintf(os.Stderr, "compute average stats failed, err: %v\n", err)
+				return
+			}
+			average, userCount, _ = averageCache.get()
+		}
+		rsp["average"] = average
+		rsp["user_count"] = userCount
+	}
+	c.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// 实时推送：GET /events 以 Server-Sent Events 的方式推送赔率变化、停止投注、比赛结算、
+// 余额变化和排行榜变化，前端不需要再轮询 /schedules、/my 和 /rank。
+// 断线重连时浏览器会带上 Last-Event-ID，从事件总线的历史里补发中间漏掉的事件，
+// 历史里已经找不到时推送 reset 事件，客户端收到后重新拉取一次完整数据
+
+const (
+	EventStreamReset = "reset" // 补发不完整，客户端需要重新拉取完整数据
+
+	streamKeepAliveInterval = 15 * time.Second
+	balancePollInterval     = 2 * time.Second
+	balancePollBatch        = 1000
+)
+
+// streamVisible 公开的事件推送给所有人，余额和成就只推送给用户自己，
+// 投注事件在开赛前不公开，不推送
+func streamVisible(event Event, userID int) bool {
+	switch payload := event.Payload.(type) {
+	case OddsChangedEvent, BettingClosedEvent, ScheduleSettledEvent, ScheduleVoidedEvent, LeaderboardUpdatedEvent:
+		return true
+	case BalanceChangedEvent:
+		return userID != 0 && payload.UserID == userID
+	case AchievementUnlockedEvent:
+		return userID != 0 && payload.UserID == userID
+	}
+	return false
+}
+
+// ledger 是所有余额变动的唯一入口，所以余额事件直接按 entry_id 读取新的流水发布，
+// 不需要每个改余额的地方在事务提交之后各自发布。
+// 并发的事务提交顺序和 entry_id 的顺序不一定一致，小的 entry_id 可能晚一点才能读到，
+// 所以 ledgerCursor 只推进到连续发布过的位置，之后的流水每次重新扫描，跳过已经发布的。
+// 回滚的事务会留下永远读不到的 ID，后面的流水已经发布超过 ledgerGapTimeout 时不再等它
+const ledgerGapTimeout = time.Minute
+
+var (
+	ledgerCursor      int64 // 这个 ID 及之前的流水都已经发布或者不再等待
+	ledgerCursorReady bool
+	ledgerPublished   = make(map[int64]time.Time) // 大于 ledgerCursor、已经发布的流水和发布时间
+)
+
+func publishBalanceChanges(now time.Time) error {
+	if !ledgerCursorReady {
+		// 启动时从最新的流水开始，之前的变动不再推送
+		if err := db.QueryRow("SELECT COALESCE(MAX(entry_id), 0) FROM ledger").Scan(&ledgerCursor); err != nil {
+			return err
+		}
+		ledgerCursorReady = true
+		return nil
+	}
+
+	after := ledgerCursor
+	for {
+		n, last, err := publishLedgerBatch(after, now)
+		if err != nil {
+			return err
+		}
+		if n < balancePollBatch {
+			break
+		}
+		after = last
+	}
+	advanceLedgerCursor(now)
+	return nil
+}
+
+func publishLedgerBatch(after int64, now time.Time) (int, int64, error) {
+	rows, err := db.Query("SELECT entry_id, user_id, amount, balance, reason FROM ledger WHERE entry_id > ? "+
+		"ORDER BY entry_id LIMIT ?", after, balancePollBatch)
+	if err != nil {
+		return 0, after, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var e BalanceChangedEvent
+		if err := rows.Scan(&e.EntryID, &e.UserID, &e.Amount, &e.Balance, &e.Reason); err != nil {
+			return n, after, err
+		}
+		n++
+		after = e.EntryID
+		if _, ok := ledgerPublished[e.EntryID]; ok {
+			continue
+		}
+		bus.Publish(EventBalanceChanged, e)
+		ledgerPublished[e.EntryID] = now
+	}
+	return n, after, rows.Err()
+}
+
+// advanceLedgerCursor 把 ledgerCursor 推进到连续发布过的位置，缺的 ID 等待超时之后跳过
+func advanceLedgerCursor(now time.Time) {
+	for len(ledgerPublished) > 0 {
+		if _, ok := ledgerPublished[ledgerCursor+1]; ok {
+			delete(ledgerPublished, ledgerCursor+1)
+			ledgerCursor++
+			continue
+		}
+		next := int64(-1)
+		for id := range ledgerPublished {
+			if next < 0 || id < next {
+				next = id
+			}
+		}
+		if now.Sub(ledgerPublished[next]) < ledgerGapTimeout {
+			return
+		}
+		ledgerCursor = next - 1
+	}
+}
+
+// publishPoolOdds 奖池模式下投注之后推送新的隐含赔率
+func publishPoolOdds(scheduleID int) {
+	stakes, err := poolStakes(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query pool stakes of schedule %v failed, err: %v\n", scheduleID, err)
+		return
+	}
+	var schedule Schedule2
+	fillPoolOdds(&schedule, stakes[scheduleID])
+	bus.Publish(EventOddsChanged, OddsChangedEvent{
+		ScheduleID:      scheduleID,
+		HomeTeamWinOdds: schedule.HomeTeamWinOdds,
+		AwayTeamWinOdds: schedule.AwayTeamWinOdds,
+		TiedOdds:        schedule.TiedOdds,
+		Pool:            schedule.Pool,
+	})
+}
+
+func renderStreamEvent(c *gin.Context, event Event) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(event.ID, 10),
+		Event: event.Type,
+		Data:  event,
+	})
+}
+
+func handleEvents(c *gin.Context) {
+	var userID int
+	if s := c.Query("user_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			illegalParametersRsp(c)
+			return
+		}
+		userID = id
+	}
+	// EventSource 重连时用 Last-Event-ID 请求头，第一次连接也可以用 last_event_id 参数指定
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	var (
+		subID    int
+		missed   []Event
+		complete = true
+		events   <-chan Event
+	)
+	if lastEventID == "" {
+		subID, events = bus.Subscribe()
+	} else {
+		lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			illegalParametersRsp(c)
+			return
+		}
+		subID, missed, complete, events = bus.SubscribeSince(lastID)
+	}
+	defer bus.Unsubscribe(subID)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !complete {
+		c.Render(-1, sse.Event{Event: EventStreamReset, Data: gin.H{"desc": "missed events, please reload"}})
+	}
+	for _, event := range missed {
+		if streamVisible(event, userID) {
+			renderStreamEvent(c, event)
+		}
+	}
+	// 告诉浏览器断线 3 秒后重连
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+	clientGone := c.Writer.CloseNotify()
+	for {
+		select {
+		case <-clientGone:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !streamVisible(event, userID) {
+				continue
+			}
+			renderStreamEvent(c, event)
+		case <-keepAlive.C:
+			// 注释行，防止代理因为连接空闲而断开
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
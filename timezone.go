@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// 数据库中所有的时间统一按 UTC 存储，接口返回带时区偏移的 RFC 3339 时间
+const dbTimeLayout = "2006-01-02 15:04:05"
+
+// 部署时区，用来解释不带时区的输入以及计算“今天”
+var serverLocation = time.Local
+
+func loadServerLocation() {
+	if config.Timezone == "" {
+		return
+	}
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		log.Fatalf("load timezone %v failed, error: %v\n", config.Timezone, err)
+	}
+	serverLocation = loc
+}
+
+// parseInputTime 解析接口传入的时间：带偏移的 RFC 3339 原样使用，
+// "2006-01-02 15:04:05" 这种不带时区的时间按部署时区解释
+func parseInputTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(dbTimeLayout, s, serverLocation)
+}
+
+func toDBTime(t time.Time) string {
+	return t.UTC().Format(dbTimeLayout)
+}
+
+func fromDBTime(s string) (time.Time, error) {
+	return time.ParseInLocation(dbTimeLayout, s, time.UTC)
+}
+
+// formatAPITime 把数据库中的 UTC 时间转成部署时区的 RFC 3339 字符串
+func formatAPITime(s string) string {
+	t, err := fromDBTime(s)
+	if err != nil {
+		return s
+	}
+	return t.In(serverLocation).Format(time.RFC3339)
+}
+
+// 部署时区下 t 所在自然日的起止时间 [start, end)
+func dayBounds(t time.Time) (time.Time, time.Time) {
+	local := t.In(serverLocation)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, serverLocation)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// 把接口传入的比赛时间统一转换成数据库存储的 UTC 时间
+func normalizeScheduleTime(schedule *Schedule) error {
+	t, err := parseInputTime(schedule.ScheduleTime)
+	if err != nil {
+		return err
+	}
+	schedule.ScheduleTime = toDBTime(t)
+	return nil
+}
@@ -0,0 +1,851 @@
+package main
+
+// betting-admin 是服务端管理接口的命令行工具，和服务端共用 types 包里的类型。
+// 服务端地址和 admin_token 从配置文件读取，默认是当前目录下的 betting-admin.toml，例如：
+//
+//	go run tools/betting-admin/betting_admin.go schedules list -type 0
+//	go run tools/betting-admin/betting_admin.go schedules create -home 俄罗斯 -away 沙特阿拉伯 \
+//		-time "2018-06-14 23:00:00" -group A -home-odds 2 -away-odds 3 -tied-odds 3
+//	go run tools/betting-admin/betting_admin.go schedules settle -id 1 -score 5:0
+//	go run tools/betting-admin/betting_admin.go -config prod.toml leaderboard snapshot
+//	go run tools/betting-admin/betting_admin.go fixtures import -dry-run tools/fixtures/worldcup2018.csv
+//
+// 赛程文件的格式默认按文件扩展名判断（.csv / .json / .ics），
+// tools/fixtures/worldcup2018.csv 是 2018 年世界杯的 64 场比赛，开赛时间按北京时间填写
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GhostComputing/worldcup-betting/types"
+	"github.com/spf13/viper"
+)
+
+type adminConfig struct {
+	Server     string `mapstructure:"server"`      // 服务端地址，例如 http://localhost:9614
+	AdminToken string `mapstructure:"admin_token"` // 和服务端 config.toml 里的 admin_token 一致
+	Operator   string `mapstructure:"operator"`    // 写进审计日志的操作人，默认是当前系统用户
+}
+
+var (
+	config adminConfig
+	client = &http.Client{Timeout: time.Minute}
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: betting-admin [-config file] command subcommand [flags]\n\n"+
+		"commands:\n"+
+		"  schedules list|create|update|settle|void\n"+
+		"  users grant-reset|whitelist|adjust|adjustments\n"+
+		"  tips list|add\n"+
+		"  leaderboard snapshots|snapshot|freeze\n"+
+		"  audit list\n"+
+		"  fixtures import|export\n\n"+
+		"run \"betting-admin command subcommand -h\" for the flags of each subcommand\n")
+	os.Exit(2)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fail("generate request id failed: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func loadConfig(path string) {
+	v := viper.New()
+	basename := filepath.Base(path)
+	v.SetConfigName(basename[0:(len(basename) - len(filepath.Ext(basename)))])
+	v.AddConfigPath(filepath.Dir(path))
+	if err := v.ReadInConfig(); err != nil {
+		fail("read config %v failed: %v", path, err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		fail("unmarshal config %v failed: %v", path, err)
+	}
+	if config.Server == "" {
+		fail("server is not set in %v", path)
+	}
+	config.Server = strings.TrimRight(config.Server, "/")
+	if config.Operator == "" {
+		config.Operator = os.Getenv("USER")
+	}
+}
+
+// apiStatus 是所有接口返回里共有的部分
+type apiStatus struct {
+	Status int    `json:"status"`
+	Desc   string `json:"desc"`
+	Error  string `json:"error"`
+}
+
+// send 带上 admin_token 和操作人发送请求，contentType 为空时不设置
+func send(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := config.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	httpReq, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if config.AdminToken != "" {
+		httpReq.Header.Set(types.AdminTokenHeader, config.AdminToken)
+	}
+	if config.Operator != "" {
+		httpReq.Header.Set(types.AdminOperatorHeader, config.Operator)
+	}
+	return client.Do(httpReq)
+}
+
+// call 调用服务端接口，req 不为空时以 JSON 发送，返回的 status 不为 0 时报错，否则解析到 rsp
+func call(method, path string, query url.Values, req, rsp interface{}) error {
+	var (
+		body        bytes.Buffer
+		contentType string
+	)
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+	httpRsp, err := send(method, path, query, contentType, &body)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+	data, err := ioutil.ReadAll(httpRsp.Body)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(httpRsp.StatusCode, data, rsp)
+}
+
+// decodeResponse 检查返回里的 status，不为 0 时报错，否则解析到 rsp
+func decodeResponse(statusCode int, data []byte, rsp interface{}) error {
+	var status apiStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("bad response (HTTP %v): %v", statusCode, strings.TrimSpace(string(data)))
+	}
+	if status.Status != 0 {
+		if status.Error != "" {
+			return fmt.Errorf("%v (status %v): %v", status.Desc, status.Status, status.Error)
+		}
+		return fmt.Errorf("%v (status %v)", status.Desc, status.Status)
+	}
+	if rsp != nil {
+		return json.Unmarshal(data, rsp)
+	}
+	return nil
+}
+
+func mustCall(method, path string, query url.Values, req, rsp interface{}) {
+	if err := call(method, path, query, req, rsp); err != nil {
+		fail("%v %v failed: %v", method, path, err)
+	}
+}
+
+// oddsFlag 让赔率可以直接写成 2.35 这样的小数，和接口里的格式一致
+type oddsFlag struct{ odds *types.Odds }
+
+func (f oddsFlag) String() string {
+	if f.odds == nil {
+		return ""
+	}
+	return f.odds.String()
+}
+
+func (f oddsFlag) Set(s string) error {
+	return f.odds.UnmarshalJSON([]byte(s))
+}
+
+type moneyFlag struct{ money *types.Money }
+
+func (f moneyFlag) String() string {
+	if f.money == nil {
+		return ""
+	}
+	return f.money.String()
+}
+
+func (f moneyFlag) Set(s string) error {
+	return f.money.UnmarshalJSON([]byte(s))
+}
+
+// setFlags 返回命令行里显式给出的参数，update 只修改这些字段
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+var (
+	scheduleTypeNames = []string{"小组赛", "八强赛", "四强赛", "半决赛", "季军赛", "总决赛"}
+	statusNames       = map[types.ScheduleStatus]string{
+		types.NotStarted:  "未开始",
+		types.HomeTeamWin: "主队胜",
+		types.AwayTeamWin: "客队胜",
+		types.Draw:        "平局",
+		types.Voided:      "已取消",
+	}
+)
+
+func scheduleTypeName(t types.ScheduleType) string {
+	if t >= 0 && int(t) < len(scheduleTypeNames) {
+		return scheduleTypeNames[t]
+	}
+	return strconv.Itoa(int(t))
+}
+
+func fetchSchedules(scheduleType int) []types.Schedule {
+	query := url.Values{}
+	if scheduleType >= 0 {
+		query.Set("type", strconv.Itoa(scheduleType))
+	}
+	var rsp struct {
+		Schedules []types.Schedule `json:"schedules"`
+	}
+	mustCall("GET", "/schedules2", query, nil, &rsp)
+	return rsp.Schedules
+}
+
+func fetchSchedule(id int) types.Schedule {
+	for _, s := range fetchSchedules(-1) {
+		if s.ScheduleID == id {
+			return s
+		}
+	}
+	fail("schedule %v does not exist", id)
+	return types.Schedule{}
+}
+
+// scheduleFlags 是 create 和 update 共用的赛程字段
+func scheduleFlags(fs *flag.FlagSet, s *types.Schedule) (hidden *bool) {
+	fs.StringVar(&s.HomeTeam, "home", s.HomeTeam, "home team")
+	fs.StringVar(&s.AwayTeam, "away", s.AwayTeam, "away team")
+	fs.StringVar(&s.ScheduleTime, "time", s.ScheduleTime, "kickoff time, RFC3339 or \"2006-01-02 15:04:05\" in server time zone")
+	fs.StringVar(&s.ScheduleGroup, "group", s.ScheduleGroup, "group A-H, X for knockout matches")
+	fs.Var((*scheduleTypeFlag)(&s.ScheduleType), "type", "schedule type, 0 group matches ... 5 finals")
+	fs.Var(oddsFlag{&s.HomeTeamWinOdds}, "home-odds", "home team win odds")
+	fs.Var(oddsFlag{&s.AwayTeamWinOdds}, "away-odds", "away team win odds")
+	fs.Var(oddsFlag{&s.TiedOdds}, "tied-odds", "draw odds")
+	fs.BoolVar(&s.DisableBetting, "disable-betting", s.DisableBetting, "close betting")
+	return fs.Bool("hidden", !s.EnableDisplay, "hide from the betting page")
+}
+
+type scheduleTypeFlag types.ScheduleType
+
+func (f *scheduleTypeFlag) String() string { return strconv.Itoa(int(*f)) }
+
+func (f *scheduleTypeFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(types.GroupMatches) || n >= int(types.All) {
+		return fmt.Errorf("schedule type must be 0-%v", int(types.All)-1)
+	}
+	*f = scheduleTypeFlag(n)
+	return nil
+}
+
+func printSchedules(schedules []types.Schedule) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tTYPE\tGROUP\tMATCH\tODDS (H/D/A)\tMODE\tSTATUS\tSCORE\tFLAGS")
+	for _, s := range schedules {
+		odds := fmt.Sprintf("%v/%v/%v", s.HomeTeamWinOdds, s.TiedOdds, s.AwayTeamWinOdds)
+		mode := "fixed"
+		if s.BettingMode == types.PoolBetting {
+			mode, odds = "pool", "-"
+		}
+		score := "-"
+		if s.HomeScore != nil && s.AwayScore != nil {
+			score = fmt.Sprintf("%v:%v", *s.HomeScore, *s.AwayScore)
+		}
+		var flags []string
+		if s.DisableBetting {
+			flags = append(flags, "closed")
+		}
+		if !s.EnableDisplay {
+			flags = append(flags, "hidden")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v vs %v\t%v\t%v\t%v\t%v\t%v\n",
+			s.ScheduleID, s.ScheduleTime, scheduleTypeName(s.ScheduleType), s.ScheduleGroup,
+			s.HomeTeam, s.AwayTeam, odds, mode, statusNames[s.ScheduleStatus], score, strings.Join(flags, ","))
+	}
+	w.Flush()
+}
+
+func runSchedules(sub string, args []string) {
+	fs := flag.NewFlagSet("schedules "+sub, flag.ExitOnError)
+	switch sub {
+	case "list":
+		scheduleType := fs.Int("type", -1, "only list this schedule type, 0 group matches ... 5 finals")
+		fs.Parse(args)
+		printSchedules(fetchSchedules(*scheduleType))
+
+	case "create":
+		s := types.Schedule{ScheduleGroup: "X", EnableDisplay: true}
+		hidden := scheduleFlags(fs, &s)
+		pool := fs.Bool("pool", false, "pool betting instead of fixed odds")
+		fs.Parse(args)
+		if s.HomeTeam == "" || s.AwayTeam == "" || s.ScheduleTime == "" {
+			fail("-home, -away and -time are required")
+		}
+		s.EnableDisplay = !*hidden
+		if *pool {
+			s.BettingMode = types.PoolBetting
+		} else if s.HomeTeamWinOdds <= 0 || s.AwayTeamWinOdds <= 0 || s.TiedOdds <= 0 {
+			fail("-home-odds, -away-odds and -tied-odds are required for fixed odds betting")
+		}
+		var rsp struct {
+			ScheduleID int `json:"schedule_id"`
+		}
+		mustCall("PUT", "/new_schedule", nil, s, &rsp)
+		fmt.Printf("schedule %v created\n", rsp.ScheduleID)
+
+	case "update":
+		id := fs.Int("id", 0, "schedule id")
+		s := types.Schedule{EnableDisplay: true}
+		hidden := scheduleFlags(fs, &s)
+		fs.Parse(args)
+		if *id <= 0 {
+			fail("-id is required")
+		}
+		// 先取出当前的赛程，只覆盖命令行里给出的字段
+		updated := s
+		s = fetchSchedule(*id)
+		set := setFlags(fs)
+		if set["home"] {
+			s.HomeTeam = updated.HomeTeam
+		}
+		if set["away"] {
+			s.AwayTeam = updated.AwayTeam
+		}
+		if set["time"] {
+			s.ScheduleTime = updated.ScheduleTime
+		}
+		if set["group"] {
+			s.ScheduleGroup = updated.ScheduleGroup
+		}
+		if set["type"] {
+			s.ScheduleType = updated.ScheduleType
+		}
+		if set["home-odds"] {
+			s.HomeTeamWinOdds = updated.HomeTeamWinOdds
+		}
+		if set["away-odds"] {
+			s.AwayTeamWinOdds = updated.AwayTeamWinOdds
+		}
+		if set["tied-odds"] {
+			s.TiedOdds = updated.TiedOdds
+		}
+		if set["disable-betting"] {
+			s.DisableBetting = updated.DisableBetting
+		}
+		if set["hidden"] {
+			s.EnableDisplay = !*hidden
+		}
+		if s.ScheduleStatus != types.NotStarted {
+			fail("schedule %v is already %v", *id, statusNames[s.ScheduleStatus])
+		}
+		mustCall("POST", "/update_schedule", nil, s, nil)
+		fmt.Printf("schedule %v updated\n", *id)
+
+	case "settle":
+		id := fs.Int("id", 0, "schedule id")
+		score := fs.String("score", "", "final score as home:away, e.g. 2:1")
+		result := fs.String("result", "", "home, away or draw, by default decided by the score")
+		fs.Parse(args)
+		if *id <= 0 || (*score == "" && *result == "") {
+			fail("-id and -score or -result are required")
+		}
+		s := fetchSchedule(*id)
+		if s.ScheduleStatus != types.NotStarted {
+			fail("schedule %v is already %v", *id, statusNames[s.ScheduleStatus])
+		}
+		if *score != "" {
+			home, away, err := parseScore(*score)
+			if err != nil {
+				fail("illegal score %v: %v", *score, err)
+			}
+			s.HomeScore, s.AwayScore = &home, &away
+			switch {
+			case home > away:
+				s.ScheduleStatus = types.HomeTeamWin
+			case home < away:
+				s.ScheduleStatus = types.AwayTeamWin
+			default:
+				s.ScheduleStatus = types.Draw
+			}
+		}
+		// 淘汰赛点球决胜时比分是平的，需要用 -result 指定晋级的一方
+		switch *result {
+		case "":
+		case "home":
+			s.ScheduleStatus = types.HomeTeamWin
+		case "away":
+			s.ScheduleStatus = types.AwayTeamWin
+		case "draw":
+			s.ScheduleStatus = types.Draw
+		default:
+			fail("-result must be home, away or draw")
+		}
+		mustCall("POST", "/update_schedule", nil, s, nil)
+		fmt.Printf("schedule %v settled: %v\n", *id, statusNames[s.ScheduleStatus])
+
+	case "void":
+		id := fs.Int("id", 0, "schedule id")
+		fs.Parse(args)
+		if *id <= 0 {
+			fail("-id is required")
+		}
+		var rsp struct {
+			RefundedBets int `json:"refunded_bets"`
+		}
+		mustCall("POST", "/void_schedule", nil, types.VoidScheduleReq{ScheduleID: *id}, &rsp)
+		fmt.Printf("schedule %v voided, %v bets refunded\n", *id, rsp.RefundedBets)
+
+	default:
+		usage()
+	}
+}
+
+func parseScore(s string) (int, int, error) {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("want home:away")
+	}
+	home, err := strconv.Atoi(parts[0])
+	if err != nil || home < 0 {
+		return 0, 0, fmt.Errorf("want home:away")
+	}
+	away, err := strconv.Atoi(parts[1])
+	if err != nil || away < 0 {
+		return 0, 0, fmt.Errorf("want home:away")
+	}
+	return home, away, nil
+}
+
+func runUsers(sub string, args []string) {
+	fs := flag.NewFlagSet("users "+sub, flag.ExitOnError)
+	nameFlags := func() (*string, *string) {
+		return fs.String("ch", "", "chinese name"), fs.String("en", "", "english (rtx) name")
+	}
+	switch sub {
+	case "grant-reset":
+		chineseName, englishName := nameFlags()
+		fs.Parse(args)
+		if *chineseName == "" || *englishName == "" {
+			fail("-ch and -en are required")
+		}
+		mustCall("POST", "/grant_reset_password", nil,
+			types.GrantResetPassword{ChineseName: *chineseName, EnglishName: *englishName}, nil)
+		fmt.Printf("%v can reset password now\n", *englishName)
+
+	case "whitelist":
+		chineseName, englishName := nameFlags()
+		department := fs.String("department", "", "departments separated by ;")
+		fs.Parse(args)
+		if *chineseName == "" || *englishName == "" {
+			fail("-ch and -en are required")
+		}
+		mustCall("POST", "/add_new_user", nil, types.AddNewUserReq{
+			ChineseName: *chineseName,
+			EnglishName: *englishName,
+			Department:  *department,
+		}, nil)
+		fmt.Printf("%v added to whitelist\n", *englishName)
+
+	case "adjust":
+		var req types.AdjustBalanceReq
+		reasons := make([]string, len(types.AdjustReasons))
+		for i, r := range types.AdjustReasons {
+			reasons[i] = string(r)
+		}
+		fs.IntVar(&req.UserID, "user", 0, "user id")
+		fs.Var(moneyFlag{&req.Amount}, "amount", "coins to credit, negative to debit, e.g. 100 or -20.50")
+		reason := fs.String("reason", "", "reason code: "+strings.Join(reasons, ", "))
+		fs.StringVar(&req.Note, "note", "", "what happened, required when reason is other")
+		schedule := fs.Int("schedule", 0, "related schedule, or the user's bet on it")
+		futuresBet := fs.Int("futures-bet", 0, "related futures bet id")
+		fs.StringVar(&req.RequestID, "request-id", "", "id of this adjustment, reuse the printed one when retrying (default random)")
+		fs.Parse(args)
+		if req.RequestID == "" {
+			req.RequestID = newRequestID()
+		}
+		req.Reason = types.AdjustReason(*reason)
+		if req.UserID <= 0 || req.Amount == 0 || *reason == "" {
+			fail("-user, -amount and -reason are required")
+		}
+		switch {
+		case *schedule != 0 && *futuresBet != 0:
+			fail("-schedule and -futures-bet can not be used together")
+		case *schedule != 0:
+			req.RefType, req.RefID = types.AdjustRefSchedule, *schedule
+		case *futuresBet != 0:
+			req.RefType, req.RefID = types.AdjustRefFuturesBet, *futuresBet
+		}
+		var rsp struct {
+			Adjustment struct {
+				AdjustmentID int         `json:"adjustment_id"`
+				Balance      types.Money `json:"balance"`
+			} `json:"adjustment"`
+		}
+		// 请求失败时用同一个 request id 重试，服务端不会重复调整
+		fmt.Fprintf(os.Stderr, "request id %v\n", req.RequestID)
+		mustCall("POST", "/adjust_balance", nil, req, &rsp)
+		fmt.Printf("adjustment %v: user %v %v, balance %v\n",
+			rsp.Adjustment.AdjustmentID, req.UserID, req.Amount, rsp.Adjustment.Balance)
+
+	case "adjustments":
+		userID := fs.Int("user", 0, "only list adjustments of this user")
+		limit := fs.Int("limit", 50, "number of adjustments")
+		fs.Parse(args)
+		query := url.Values{"limit": {strconv.Itoa(*limit)}}
+		if *userID != 0 {
+			query.Set("user_id", strconv.Itoa(*userID))
+		}
+		var rsp struct {
+			Adjustments []struct {
+				AdjustmentID int                `json:"adjustment_id"`
+				UserID       int                `json:"user_id"`
+				Amount       types.Money        `json:"amount"`
+				Balance      types.Money        `json:"balance"`
+				Reason       types.AdjustReason `json:"reason"`
+				Note         string             `json:"note"`
+				RefType      string             `json:"ref_type"`
+				RefID        int                `json:"ref_id"`
+				Operator     string             `json:"operator"`
+				CreatedAt    string             `json:"created_at"`
+			} `json:"adjustments"`
+		}
+		mustCall("GET", "/adjustments", query, nil, &rsp)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tAMOUNT\tBALANCE\tREASON\tREF\tOPERATOR\tCREATED\tNOTE")
+		for _, a := range rsp.Adjustments {
+			ref := "-"
+			if a.RefType != "" {
+				ref = fmt.Sprintf("%v %v", a.RefType, a.RefID)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", a.AdjustmentID, a.UserID, a.Amount, a.Balance,
+				a.Reason, ref, a.Operator, a.CreatedAt, a.Note)
+		}
+		w.Flush()
+
+	default:
+		usage()
+	}
+}
+
+func runTips(sub string, args []string) {
+	fs := flag.NewFlagSet("tips "+sub, flag.ExitOnError)
+	switch sub {
+	case "list":
+		fs.Parse(args)
+		var rsp struct {
+			Tips types.AddTipsRequest `json:"tips"`
+		}
+		mustCall("GET", "/tips", nil, nil, &rsp)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDISPLAY\tCONTENT")
+		for _, t := range rsp.Tips.TipsList {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", t.TipsID, t.EnableDisplay, t.Content)
+		}
+		w.Flush()
+
+	case "add":
+		// 相同 id 的 tips 会被覆盖
+		id := fs.Int("id", 0, "tips id, an existing id replaces that tips")
+		content := fs.String("content", "", "tips content")
+		hidden := fs.Bool("hidden", false, "do not display this tips")
+		fs.Parse(args)
+		if *id <= 0 || *content == "" {
+			fail("-id and -content are required")
+		}
+		tips := types.Tips{TipsID: *id, Content: *content, EnableDisplay: !*hidden}
+		mustCall("POST", "/add_tips", nil, types.AddTipsRequest{TipsList: []types.Tips{tips}}, nil)
+		fmt.Printf("tips %v saved\n", *id)
+
+	default:
+		usage()
+	}
+}
+
+func runLeaderboard(sub string, args []string) {
+	fs := flag.NewFlagSet("leaderboard "+sub, flag.ExitOnError)
+	switch sub {
+	case "snapshots":
+		limit := fs.Int("limit", 50, "number of snapshots")
+		fs.Parse(args)
+		var rsp struct {
+			Snapshots []types.LeaderboardSnapshot `json:"snapshots"`
+		}
+		mustCall("GET", "/rank_snapshots", url.Values{"limit": {strconv.Itoa(*limit)}}, nil, &rsp)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SNAPSHOT\tSCHEDULE\tCREATED")
+		for _, s := range rsp.Snapshots {
+			schedule := "manual"
+			if s.ScheduleID != 0 {
+				schedule = strconv.Itoa(s.ScheduleID)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", s.SnapshotID, schedule, s.CreatedAt)
+		}
+		w.Flush()
+
+	case "snapshot":
+		fs.Parse(args)
+		var rsp struct {
+			SnapshotID int `json:"snapshot_id"`
+		}
+		mustCall("POST", "/take_snapshot", nil, nil, &rsp)
+		fmt.Printf("snapshot %v taken\n", rsp.SnapshotID)
+
+	case "freeze":
+		// -snapshot 0 解除冻结，重新展示实时排行榜
+		snapshot := fs.Int("snapshot", 0, "snapshot id to freeze on, 0 shows the live leaderboard")
+		metric := fs.String("metric", "", "default ranking metric, balance if empty")
+		hidden := fs.Bool("hidden", false, "hide the leaderboard")
+		fs.Parse(args)
+		mustCall("POST", "/update_ranks", nil, types.UpdateRankReq{
+			EnableDisplayRank: !*hidden,
+			SnapshotID:        *snapshot,
+			Metric:            *metric,
+		}, nil)
+		if *snapshot == 0 {
+			fmt.Println("leaderboard is live")
+		} else {
+			fmt.Printf("leaderboard frozen on snapshot %v\n", *snapshot)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func runAudit(sub string, args []string) {
+	fs := flag.NewFlagSet("audit "+sub, flag.ExitOnError)
+	switch sub {
+	case "list":
+		userID := fs.Int("user", 0, "only operations by or on this user")
+		scheduleID := fs.Int("schedule", 0, "only operations on this schedule")
+		action := fs.String("action", "", "only this action, e.g. login, bet, settle_bet, adjust_balance")
+		beforeID := fs.Int64("before", 0, "only entries older than this audit id, for paging")
+		limit := fs.Int("limit", 100, "number of entries")
+		fs.Parse(args)
+		query := url.Values{"limit": {strconv.Itoa(*limit)}}
+		if *userID != 0 {
+			query.Set("user_id", strconv.Itoa(*userID))
+		}
+		if *scheduleID != 0 {
+			query.Set("schedule_id", strconv.Itoa(*scheduleID))
+		}
+		if *action != "" {
+			query.Set("action", *action)
+		}
+		if *beforeID != 0 {
+			query.Set("before_id", strconv.FormatInt(*beforeID, 10))
+		}
+		var rsp struct {
+			Entries []struct {
+				AuditID    int64           `json:"audit_id"`
+				ActorType  string          `json:"actor_type"`
+				ActorID    int             `json:"actor_id"`
+				ActorName  string          `json:"actor_name"`
+				Action     string          `json:"action"`
+				TargetType string          `json:"target_type"`
+				TargetID   int             `json:"target_id"`
+				UserID     int             `json:"user_id"`
+				Before     json.RawMessage `json:"before"`
+				After      json.RawMessage `json:"after"`
+				IP         string          `json:"ip"`
+				CreatedAt  string          `json:"created_at"`
+			} `json:"entries"`
+		}
+		mustCall("GET", "/audit_log", query, nil, &rsp)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tACTOR\tACTION\tTARGET\tUSER\tIP\tBEFORE\tAFTER")
+		for _, e := range rsp.Entries {
+			actor := e.ActorType
+			switch {
+			case e.ActorName != "":
+				actor += ":" + e.ActorName
+			case e.ActorID != 0:
+				actor += ":" + strconv.Itoa(e.ActorID)
+			}
+			target, user := "-", "-"
+			if e.TargetType != "" {
+				target = fmt.Sprintf("%v %v", e.TargetType, e.TargetID)
+			}
+			if e.UserID != 0 {
+				user = strconv.Itoa(e.UserID)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%s\t%s\n", e.AuditID, e.CreatedAt, actor, e.Action,
+				target, user, e.IP, e.Before, e.After)
+		}
+		w.Flush()
+
+	default:
+		usage()
+	}
+}
+
+type fixtureResult struct {
+	Row        int    `json:"row"`
+	Action     string `json:"action"`
+	ScheduleID int    `json:"schedule_id"`
+	Error      string `json:"error"`
+}
+
+func runFixtures(sub string, args []string) {
+	fs := flag.NewFlagSet("fixtures "+sub, flag.ExitOnError)
+	switch sub {
+	case "import":
+		format := fs.String("format", "", "file format csv, json or ics, default by extension")
+		dryRun := fs.Bool("dry-run", false, "validate and show what would change without writing")
+		upsert := fs.Bool("upsert", false, "update existing schedules instead of skipping them")
+		verbose := fs.Bool("v", false, "print every row, not only changes and errors")
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			fail("usage: fixtures import [-format csv|json|ics] [-dry-run] [-upsert] [-v] file")
+		}
+		path := fs.Arg(0)
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			fail("read %v failed: %v", path, err)
+		}
+		if *format == "" {
+			*format = strings.TrimPrefix(filepath.Ext(path), ".")
+		}
+		query := url.Values{
+			"format":  {*format},
+			"dry_run": {strconv.FormatBool(*dryRun)},
+			"upsert":  {strconv.FormatBool(*upsert)},
+		}
+
+		httpRsp, err := send("POST", "/import_fixtures", query, "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			fail("import failed: %v", err)
+		}
+		defer httpRsp.Body.Close()
+		data, err := ioutil.ReadAll(httpRsp.Body)
+		if err != nil {
+			fail("import failed: %v", err)
+		}
+		var rsp struct {
+			DryRun    bool            `json:"dry_run"`
+			Created   int             `json:"created"`
+			Updated   int             `json:"updated"`
+			Unchanged int             `json:"unchanged"`
+			Skipped   int             `json:"skipped"`
+			Results   []fixtureResult `json:"results"`
+		}
+		// 校验失败时也会返回每一行的错误，先打印出来再报错
+		json.Unmarshal(data, &rsp)
+		for _, r := range rsp.Results {
+			switch {
+			case r.Error != "":
+				fmt.Printf("row %v: %v\n", r.Row, r.Error)
+			case *verbose || r.Action == "created" || r.Action == "updated":
+				fmt.Printf("row %v: %v schedule %v\n", r.Row, r.Action, r.ScheduleID)
+			}
+		}
+		if err := decodeResponse(httpRsp.StatusCode, data, nil); err != nil {
+			fail("import failed: %v", err)
+		}
+		prefix := ""
+		if rsp.DryRun {
+			prefix = "dry run, "
+		}
+		fmt.Printf("%v%v created, %v updated, %v unchanged, %v skipped\n",
+			prefix, rsp.Created, rsp.Updated, rsp.Unchanged, rsp.Skipped)
+
+	case "export":
+		format := fs.String("format", "", "file format csv, json or ics, default by output extension or csv")
+		output := fs.String("o", "", "output file, default stdout")
+		fs.Parse(args)
+		if *format == "" {
+			*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+			if *format == "" {
+				*format = "csv"
+			}
+		}
+
+		httpRsp, err := send("GET", "/export_fixtures", url.Values{"format": {*format}}, "", nil)
+		if err != nil {
+			fail("export failed: %v", err)
+		}
+		defer httpRsp.Body.Close()
+		if httpRsp.StatusCode != http.StatusOK {
+			data, _ := ioutil.ReadAll(httpRsp.Body)
+			if err := decodeResponse(httpRsp.StatusCode, data, nil); err != nil {
+				fail("export failed: %v", err)
+			}
+			fail("export failed (HTTP %v)", httpRsp.StatusCode)
+		}
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				fail("create %v failed: %v", *output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if _, err := io.Copy(w, httpRsp.Body); err != nil {
+			fail("write failed: %v", err)
+		}
+
+	default:
+		usage()
+	}
+}
+
+func main() {
+	configPath := flag.String("config", "./betting-admin.toml", "config file with server and admin_token")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		usage()
+	}
+	loadConfig(*configPath)
+
+	command, sub, args := flag.Arg(0), flag.Arg(1), flag.Args()[2:]
+	switch command {
+	case "schedules":
+		runSchedules(sub, args)
+	case "users":
+		runUsers(sub, args)
+	case "tips":
+		runTips(sub, args)
+	case "leaderboard":
+		runLeaderboard(sub, args)
+	case "audit":
+		runAudit(sub, args)
+	case "fixtures":
+		runFixtures(sub, args)
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+// 本地测试赛果导入用的数据源：返回和 config.toml 默认字段映射一致的 JSON。
+// -data 可以指定初始比赛列表（{"matches":[...]} 格式的文件），例如：
+//
+//	go run tools/mock_feed/mock_feed.go -addr :9800 -token test
+//
+// 然后在 config.toml 里设置 results_provider = "http"、
+// results_source = "http://localhost:9800/matches"、results_token = "test"。
+//
+// 接口：
+//
+//	GET  /matches                               返回全部比赛
+//	POST /add?id=&home=&away=&kickoff=          添加一场未开始的比赛，kickoff 为 RFC 3339 时间
+//	POST /finish?id=&home_score=&away_score=&winner=  把比赛标记为已结束，winner 只在点球决胜时需要
+//	POST /reset                                 恢复到初始列表
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	addr     = flag.String("addr", ":9800", "listen address")
+	token    = flag.String("token", "", "required bearer token, empty to allow all")
+	dataFile = flag.String("data", "", "initial matches file")
+
+	mu      sync.Mutex
+	initial []Match
+	matches []Match
+)
+
+type Match struct {
+	ID        string `json:"id"`
+	HomeTeam  string `json:"home_team"`
+	AwayTeam  string `json:"away_team"`
+	Kickoff   string `json:"kickoff"`
+	Status    string `json:"status"`
+	HomeScore *int   `json:"home_score"`
+	AwayScore *int   `json:"away_score"`
+	Winner    string `json:"winner,omitempty"`
+}
+
+type feed struct {
+	Matches []Match `json:"matches"`
+}
+
+func loadMatches(path string) ([]Match, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f feed
+	if err := json.Unmarshal(body, &f); err != nil {
+		return nil, err
+	}
+	return f.Matches, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func authorized(r *http.Request) bool {
+	return *token == "" || r.Header.Get("Authorization") == "Bearer "+*token
+}
+
+func handleMatches(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	writeJSON(w, http.StatusOK, feed{Matches: matches})
+}
+
+func handleAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	m := Match{
+		ID:       q.Get("id"),
+		HomeTeam: q.Get("home"),
+		AwayTeam: q.Get("away"),
+		Kickoff:  q.Get("kickoff"),
+		Status:   "scheduled",
+	}
+	if m.ID == "" || m.HomeTeam == "" || m.AwayTeam == "" {
+		http.Error(w, "id, home and away are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(time.RFC3339, m.Kickoff); err != nil {
+		http.Error(w, "kickoff must be RFC 3339", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range matches {
+		if existing.ID == m.ID {
+			http.Error(w, "match already exists", http.StatusConflict)
+			return
+		}
+	}
+	matches = append(matches, m)
+	log.Printf("added %s: %s vs %s at %s", m.ID, m.HomeTeam, m.AwayTeam, m.Kickoff)
+	writeJSON(w, http.StatusOK, m)
+}
+
+func handleFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	homeScore, err1 := strconv.Atoi(q.Get("home_score"))
+	awayScore, err2 := strconv.Atoi(q.Get("away_score"))
+	if err1 != nil || err2 != nil || homeScore < 0 || awayScore < 0 {
+		http.Error(w, "home_score and away_score are required", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range matches {
+		if matches[i].ID != q.Get("id") {
+			continue
+		}
+		matches[i].Status = "finished"
+		matches[i].HomeScore = &homeScore
+		matches[i].AwayScore = &awayScore
+		matches[i].Winner = q.Get("winner")
+		log.Printf("finished %s: %s %d:%d %s", matches[i].ID, matches[i].HomeTeam, homeScore, awayScore, matches[i].AwayTeam)
+		writeJSON(w, http.StatusOK, matches[i])
+		return
+	}
+	http.Error(w, "match not found", http.StatusNotFound)
+}
+
+func handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	matches = append([]Match(nil), initial...)
+	writeJSON(w, http.StatusOK, feed{Matches: matches})
+}
+
+func main() {
+	flag.Parse()
+	if *dataFile != "" {
+		var err error
+		if initial, err = loadMatches(*dataFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	matches = append([]Match(nil), initial...)
+
+	http.HandleFunc("/matches", handleMatches)
+	http.HandleFunc("/add", handleAdd)
+	http.HandleFunc("/finish", handleFinish)
+	http.HandleFunc("/reset", handleReset)
+	log.Printf("listening on %s with %d matches", *addr, len(matches))
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,150 @@
+package main
+
+// 本地测试邮件通知用的 SMTP 服务：接收所有邮件并打印出来，不做投递。
+// 启动之后在 config.toml 里设置 smtp_addr = "localhost:2525"，例如：
+//
+//	go run tools/smtp_sink/smtp_sink.go -addr :2525
+//
+// 支持 AUTH PLAIN（任何账号都接受），不支持 STARTTLS
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+)
+
+var addr = flag.String("addr", ":2525", "listen address")
+
+type session struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	from string
+	to   []string
+}
+
+func (s *session) reply(format string, args ...interface{}) {
+	fmt.Fprintf(s.w, format+"\r\n", args...)
+	s.w.Flush()
+}
+
+func (s *session) readLine() (string, error) {
+	line, err := s.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// parsePath 取出 <address> 里的地址，忽略后面的 BODY=8BITMIME 之类的参数
+func parsePath(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if i := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && i > 0 {
+		return arg[1:i]
+	}
+	if fields := strings.Fields(arg); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// readData 读取 DATA 之后的内容，直到单独一行的 "."
+func (s *session) readData() (string, error) {
+	var lines []string
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return "", err
+		}
+		if line == "." {
+			return strings.Join(lines, "\r\n"), nil
+		}
+		// 去掉透明处理加上的点
+		lines = append(lines, strings.TrimPrefix(line, "."))
+	}
+}
+
+func printMessage(from string, to []string, data string) {
+	decoder := new(mime.WordDecoder)
+	msg, err := mail.ReadMessage(strings.NewReader(data + "\r\n"))
+	if err != nil {
+		log.Printf("from %s to %s (unparsed):\n%s", from, strings.Join(to, ", "), data)
+		return
+	}
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	body := new(strings.Builder)
+	if _, err := bufio.NewReader(msg.Body).WriteTo(body); err != nil {
+		log.Printf("read body failed: %v", err)
+	}
+	log.Printf("from %s to %s\nSubject: %s\n\n%s", from, strings.Join(to, ", "), subject, body.String())
+}
+
+func (s *session) serve() {
+	defer s.conn.Close()
+	s.reply("220 smtp-sink ready")
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			s.reply("250-smtp-sink")
+			s.reply("250-AUTH PLAIN")
+			s.reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "HELO"):
+			s.reply("250 smtp-sink")
+		case strings.HasPrefix(cmd, "AUTH"):
+			s.reply("235 authentication succeeded")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = parsePath(line[len("MAIL FROM:"):])
+			s.to = nil
+			s.reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.to = append(s.to, parsePath(line[len("RCPT TO:"):]))
+			s.reply("250 OK")
+		case cmd == "DATA":
+			s.reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := s.readData()
+			if err != nil {
+				return
+			}
+			printMessage(s.from, s.to, data)
+			s.reply("250 OK")
+		case cmd == "RSET":
+			s.from, s.to = "", nil
+			s.reply("250 OK")
+		case cmd == "NOOP":
+			s.reply("250 OK")
+		case cmd == "QUIT":
+			s.reply("221 bye")
+			return
+		default:
+			s.reply("502 command not implemented")
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", *addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("accept failed: %v", err)
+			continue
+		}
+		s := &session{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+		go s.serve()
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+// 本地测试 webhook 用的接收端：校验签名并打印收到的事件。
+// -fail 指定前几次请求返回 500，用来测试重试和重放，例如：
+//
+//	go run tools/webhook_receiver/webhook_receiver.go -addr :9700 -secret test -fail 2
+//
+// 然后用 /add_webhook 登记 http://localhost:9700/webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	addr    = flag.String("addr", ":9700", "listen address")
+	secret  = flag.String("secret", "", "webhook secret, empty to skip signature check")
+	failN   = flag.Int("fail", 0, "respond 500 to the first N requests")
+	maxSkew = flag.Duration("max-skew", 5*time.Minute, "max allowed timestamp skew")
+
+	mu       sync.Mutex
+	received int
+)
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func verify(r *http.Request, body []byte) (bool, string) {
+	if *secret == "" {
+		return true, ""
+	}
+	timestamp := r.Header.Get("X-Webhook-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false, "bad timestamp"
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > *maxSkew || skew < -*maxSkew {
+		return false, "timestamp too old"
+	}
+	expected := sign(*secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Webhook-Signature"))) {
+		return false, "signature mismatch"
+	}
+	return true, ""
+}
+
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	received++
+	n := received
+	mu.Unlock()
+
+	event := r.Header.Get("X-Webhook-Event")
+	delivery := r.Header.Get("X-Webhook-Delivery")
+	if ok, reason := verify(r, body); !ok {
+		log.Printf("#%d delivery %s (%s): rejected, %s", n, delivery, event, reason)
+		http.Error(w, reason, http.StatusUnauthorized)
+		return
+	}
+	if n <= *failN {
+		log.Printf("#%d delivery %s (%s): simulated failure", n, delivery, event)
+		http.Error(w, "simulated failure", http.StatusInternalServerError)
+		return
+	}
+
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") != nil {
+		pretty.Write(body)
+	}
+	log.Printf("#%d delivery %s (%s):\n%s", n, delivery, event, pretty.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func main() {
+	flag.Parse()
+	http.HandleFunc("/webhook", handleWebhook)
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -1,32 +1,56 @@
 package main
 
-type ScheduleType int
+import "github.com/GhostComputing/worldcup-betting/types"
+
+// 赛程相关的类型定义在 types 包里，和管理工具共用
+
+type (
+	ScheduleType   = types.ScheduleType
+	ScheduleStatus = types.ScheduleStatus
+	BetStatus      = types.BetStatus
+	BettingMode    = types.BettingMode
+	Schedule       = types.Schedule
+	Schedule2      = types.Schedule2
+	PoolInfo       = types.PoolInfo
+
+	Tips               = types.Tips
+	AddTipsRequest     = types.AddTipsRequest
+	AddNewUserReq      = types.AddNewUserReq
+	GrantResetPassword = types.GrantResetPassword
+	UpdateRankReq      = types.UpdateRankReq
+	VoidScheduleReq    = types.VoidScheduleReq
+	AdjustBalanceReq   = types.AdjustBalanceReq
+	AdjustReason       = types.AdjustReason
+)
 
 const (
-	GroupMatches       ScheduleType = 0 // 小组赛
-	RoundEight                          // 八强赛
-	FinalFour                           // 四强赛
-	Semifinal                           // 半决赛
-	MatchForThirdPlace                  // 季军赛
-	Finals                              // 总决赛
-	All
+	GroupMatches       = types.GroupMatches
+	RoundEight         = types.RoundEight
+	FinalFour          = types.FinalFour
+	Semifinal          = types.Semifinal
+	MatchForThirdPlace = types.MatchForThirdPlace
+	Finals             = types.Finals
+	All                = types.All
 )
 
-type ScheduleStatus int
-
 const (
-	NotStarted  ScheduleStatus = 0 // 未开始
-	HomeTeamWin                    // 主队胜利
-	AwayTeamWin                    // 客队胜利
-	Draw                           // 平局
+	NotStarted  = types.NotStarted
+	HomeTeamWin = types.HomeTeamWin
+	AwayTeamWin = types.AwayTeamWin
+	Draw        = types.Draw
+	Voided      = types.Voided
 )
 
-type BetStatus int
+const (
+	BetNotFinish = types.BetNotFinish
+	WinBet       = types.WinBet
+	LostBet      = types.LostBet
+	RefundBet    = types.RefundBet
+)
 
 const (
-	BetNotFinish = 0
-	WinBet       = 1
-	LostBet      = 2
+	FixedOddsBetting = types.FixedOddsBetting
+	PoolBetting      = types.PoolBetting
 )
 
 type CountryInfo struct {
@@ -35,66 +59,40 @@ type CountryInfo struct {
 	CountryPicURL string `json:"logo"`
 }
 
-type AddTipsRequest struct {
-	TipsList []Tips `json:"tips"`
-}
-
-// 每个 Schedule 代表一场世界杯赛事
-type Schedule struct {
-	ScheduleID      int            `json:"schedule_id"`        // 赛事 ID，用以唯一标识每场比赛
-	HomeTeam        string         `json:"home_team"`          // 主队
-	AwayTeam        string         `json:"away_team"`          // 客队
-	HomeTeamWinOdds float64        `json:"home_team_win_odds"` // 主队胜利的赔率
-	AwayTeamWinOdds float64        `json:"away_team_win_odds"` // 客队胜利的赔率
-	TiedOdds        float64        `json:"tied_odds"`          // 平局的赔率
-	ScheduleTime    string         `json:"schedule_time"`      // 比赛时间
-	ScheduleGroup   string         `json:"schedule_group"`     // 比赛组别
-	ScheduleType    ScheduleType   `json:"schedule_type"`      // 比赛类别
-	ScheduleStatus  ScheduleStatus `json:"schedule_status"`    // 比赛状态
-	DisableBetting  bool           `json:"disable_betting"`    // 是否允许投注
-	EnableDisplay   bool           `json:"enable_dispaly"`     // 是否显示在投注页
-}
-
-type Schedule2 struct {
-	ScheduleID      int            `json:"schedule_id"`               // 赛事 ID，用以唯一标识每场比赛
-	HomeTeam        int            `json:"home_team"`                 // 主队
-	AwayTeam        int            `json:"away_team"`                 // 客队
-	HomeTeamWinOdds float64        `json:"home_team_win_odds"`        // 主队胜利的赔率
-	AwayTeamWinOdds float64        `json:"away_team_win_odds"`        // 客队胜利的赔率
-	TiedOdds        float64        `json:"tied_odds"`                 // 平局的赔率
-	ScheduleTime    string         `json:"schedule_time"`             // 比赛时间
-	ScheduleGroup   string         `json:"schedule_group"`            // 比赛组别
-	ScheduleType    ScheduleType   `json:"schedule_type"`             // 比赛类别
-	ScheduleStatus  ScheduleStatus `json:"schedule_status,omitempty"` // 比赛状态
-	DisableBetting  bool           `json:"disable_betting"`           // 是否允许投注
-	EnableDisplay   bool           `json:"enable_dispaly"`            // 是否显示在投注页
-}
-
 type User struct {
-	UserId              int     `json:"user_id"`
-	EnglishName         string  `json:"en_name"`
-	ChineseName         string  `json:"cn_name"`
-	Password            string  `json:"password"`
-	Money               float64 `json:"money"`
-	EnableResetPassword bool    `json:"enable_reset_password"`
-	LastLoginTime       string  `json:"last_login_time"`
-	WinCount            int     `json:"omitempty"`
-	BetCount            int     `json:"bet_count"`
+	UserId              int    `json:"user_id"`
+	EnglishName         string `json:"en_name"`
+	ChineseName         string `json:"cn_name"`
+	Password            string `json:"password"`
+	Money               Money  `json:"money"`
+	EnableResetPassword bool   `json:"enable_reset_password"`
+	LastLoginTime       string `json:"last_login_time"`
+	WinCount            int    `json:"omitempty"`
+	BetCount            int    `json:"bet_count"`
 }
 
 type RewardHistory struct {
-	UserId      int    `json:"user_id"`
-	RewardTime  string `json:"reward_time"`
-	RewardMoney int    `json:"reward_money"`
+	UserId      int        `json:"user_id"`
+	RewardTime  string     `json:"reward_time"`
+	RewardMoney Money      `json:"reward_money"`
+	RewardType  RewardType `json:"reward_type"`
 }
 
 type RankRsp struct {
-	UserID      int     `json:"user_id"`
-	RTXName     string  `json:"en_name"`
-	ChineseName string  `json:"cn_name"`
-	Money       float64 `json:"money"`
-	WinCount    int     `json:"win_count"`
-	BetCount    int     `json:"bet_count"`
+	Rank          int     `json:"rank"`
+	UserID        int     `json:"user_id"`
+	RTXName       string  `json:"en_name"`
+	ChineseName   string  `json:"cn_name"`
+	Money         Money   `json:"money"`
+	NetProfit     Money   `json:"net_profit"` // 净盈利：余额减去所有系统发放的金币
+	WinCount      int     `json:"win_count"`
+	BetCount      int     `json:"bet_count"`
+	SettledCount  int     `json:"settled_count"`  // 已结算的投注数
+	WinRate       float64 `json:"win_rate"`       // 胜率 = 赢的场次 / 已结算场次
+	ROI           float64 `json:"roi"`            // 投资回报率 = 净收益 / 已结算投注总额
+	LongestStreak int     `json:"longest_streak"` // 最长连胜场次
+	PreviousRank  int     `json:"previous_rank"`  // 上一个比赛日结束时的名次，0 表示当时不在榜上
+	Movement      int     `json:"movement"`       // 相对上一个比赛日的名次变化，正数表示上升
 }
 
 type DailyRewardRequest struct {
@@ -102,13 +100,13 @@ type DailyRewardRequest struct {
 }
 
 type BetRequest struct {
-	UserId        int     `json:"user_id"`
-	ScheduleId    int     `json:"schedule_id"`
-	BettingMoney  int     `json:"betting_money"`
-	BettingResult int     `json:"betting_result"`
-	BettingOdds   float64 `json:"betting_odds"`
-	BettingStatus int     `json:"bet_status"`
-	WinMoney      float64 `json:"win_money"`
+	UserId        int   `json:"user_id"`
+	ScheduleId    int   `json:"schedule_id"`
+	BettingMoney  Money `json:"betting_money"`
+	BettingResult int   `json:"betting_result"`
+	BettingOdds   Odds  `json:"betting_odds"`
+	BettingStatus int   `json:"bet_status"`
+	WinMoney      Money `json:"win_money"`
 }
 
 type AuthorizeRequest struct {
@@ -118,37 +116,75 @@ type AuthorizeRequest struct {
 }
 
 type Config struct {
-	MySQLUser        string `mapstructure:"mysql_server"`
-	MySQLPassword    string `mapstructure:"mysql_password"`
-	MySQLNet         string `mapstructure:"mysql_net"`
-	MySQLDBName      string `mapstructure:"mysql_db_name"`
-	MySQLAddr        string `mapstructure:"mysql_addr"`
-	CSVNameList      string `mapstructure:"csv_name_list"`
-	InitialMoney     int    `mapstructure:"initial_money"`
-	DailyRewardMoney int    `mapstructure:"daily_reward_money"`
-	EnableWhiteList  bool   `mapstructure:"enable_white_list"`
-	DomainName       string `mapstructure:"domain_name"`
-	TimiNewUser      string `mapstructure:"timi_new_user"`
-	ServerPort       string `mapstructure:"server_port"`
-}
-
-type Tips struct {
-	TipsID        int    `json:"tips_id"`
-	Content       string `json:"content"`
-	EnableDisplay bool   `json:"enable_display"`
-}
-
-type AddNewUserReq struct {
-	ChineseName string `json:"ch_name"`
-	EnglishName string `json:"en_name"`
-}
-
-type GrantResetPassword struct {
-	ChineseName string `json:"ch_name"`
-	EnglishName string `json:"en_name"`
-}
-
-type UpdateRankReq struct {
-	EnableDisplayRank bool      `json:"enable_display_rank"`
-	Rank              []RankRsp `json:"rank"`
+	MySQLUser        string  `mapstructure:"mysql_server"`
+	MySQLPassword    string  `mapstructure:"mysql_password"`
+	MySQLNet         string  `mapstructure:"mysql_net"`
+	MySQLDBName      string  `mapstructure:"mysql_db_name"`
+	MySQLAddr        string  `mapstructure:"mysql_addr"`
+	CSVNameList      string  `mapstructure:"csv_name_list"`
+	InitialMoney     int     `mapstructure:"initial_money"`
+	DailyRewardMoney int     `mapstructure:"daily_reward_money"`
+	EnableWhiteList  bool    `mapstructure:"enable_white_list"`
+	DomainName       string  `mapstructure:"domain_name"`
+	TimiNewUser      string  `mapstructure:"timi_new_user"`
+	ServerPort       string  `mapstructure:"server_port"`
+	PoolHouseCut     float64 `mapstructure:"pool_house_cut_percent"`
+
+	BettingCutoffMinutes int `mapstructure:"betting_cutoff_minutes"`        // 开赛前多少分钟停止投注
+	CutoffCheckInterval  int `mapstructure:"cutoff_check_interval_seconds"` // 后台检查截止投注的间隔
+
+	Timezone string `mapstructure:"timezone"` // 部署时区，例如 Asia/Shanghai，留空则使用服务器本地时区
+
+	// 每日奖励规则，金额都以金币为单位
+	StreakBonusMoney   int `mapstructure:"streak_bonus_money"`    // 每连续领取一天额外奖励的金币
+	StreakBonusMaxDays int `mapstructure:"streak_bonus_max_days"` // 连续奖励最多累计的天数
+	MatchDayBonusMoney int `mapstructure:"match_day_bonus_money"` // 比赛日额外奖励
+	BrokeThreshold     int `mapstructure:"broke_threshold"`       // 余额低于该值时发放补助
+	BrokeTopUpMoney    int `mapstructure:"broke_top_up_money"`    // 补助的金币
+
+	EnableRebuy    bool `mapstructure:"enable_rebuy"`    // 是否允许破产重买
+	RebuyThreshold int  `mapstructure:"rebuy_threshold"` // 余额低于该值才可以重买
+	RebuyMoney     int  `mapstructure:"rebuy_money"`     // 每次重买获得的金币
+	RebuyMaxCount  int  `mapstructure:"rebuy_max_count"` // 整届比赛最多重买的次数
+
+	RankMinSettledBets int `mapstructure:"rank_min_settled_bets"` // 参与胜率和回报率排名需要的最少结算场次
+	RankRefreshSeconds int `mapstructure:"rank_refresh_seconds"`  // 排行榜定时刷新的间隔
+
+	PredictionExactPoints    int `mapstructure:"prediction_exact_points"`     // 猜中比分的积分
+	PredictionGoalDiffPoints int `mapstructure:"prediction_goal_diff_points"` // 猜中净胜球的积分
+	PredictionOutcomePoints  int `mapstructure:"prediction_outcome_points"`   // 猜中胜负的积分
+
+	InsightsMinBettors int `mapstructure:"insights_min_bettors"` // 开赛前投注人数达到该值才公布投注分布
+
+	WebhookMaxAttempts  int `mapstructure:"webhook_max_attempts"`       // webhook 最多投递几次，之后标记为失败
+	WebhookRetrySeconds int `mapstructure:"webhook_retry_base_seconds"` // 第一次重试的间隔，之后每次翻倍
+
+	NotificationReminderMinutes int    `mapstructure:"notification_reminder_minutes"` // 截止投注前多少分钟提醒还没投注的用户
+	DailyRewardReminderHour     int    `mapstructure:"daily_reward_reminder_hour"`    // 每天几点之后提醒领取每日奖励
+	NotificationEmailDomain     string `mapstructure:"notification_email_domain"`     // 用户没有填写邮箱时使用 英文名@该域名
+	SMTPAddr                    string `mapstructure:"smtp_addr"`                     // 邮件服务器地址，例如 localhost:2525
+	SMTPFrom                    string `mapstructure:"smtp_from"`
+	SMTPUsername                string `mapstructure:"smtp_username"` // 为空时不做认证
+	SMTPPassword                string `mapstructure:"smtp_password"`
+
+	// 比赛结果导入
+	ResultsProvider         string   `mapstructure:"results_provider"`           // file / http，为空时不导入
+	ResultsSource           string   `mapstructure:"results_source"`             // 文件路径或者 URL
+	ResultsToken            string   `mapstructure:"results_token"`              // HTTP 数据源的 Bearer token
+	ResultsPollSeconds      int      `mapstructure:"results_poll_seconds"`       // 拉取间隔
+	ResultsAutoSettle       bool     `mapstructure:"results_auto_settle"`        // 是否不经确认直接结算
+	ResultsMatchWindowHours int      `mapstructure:"results_match_window_hours"` // 开赛时间相差多少小时以内视为同一场比赛
+	ResultsListPath         string   `mapstructure:"results_list_path"`          // 比赛列表在 JSON 里的路径，为空表示整个文档就是列表
+	ResultsIDField          string   `mapstructure:"results_id_field"`
+	ResultsHomeTeamField    string   `mapstructure:"results_home_team_field"`
+	ResultsAwayTeamField    string   `mapstructure:"results_away_team_field"`
+	ResultsKickoffField     string   `mapstructure:"results_kickoff_field"`
+	ResultsHomeScoreField   string   `mapstructure:"results_home_score_field"`
+	ResultsAwayScoreField   string   `mapstructure:"results_away_score_field"`
+	ResultsStatusField      string   `mapstructure:"results_status_field"`
+	ResultsWinnerField      string   `mapstructure:"results_winner_field"`
+	ResultsFinishedValues   []string `mapstructure:"results_finished_values"` // 状态字段为这些值时表示比赛已经结束
+	ResultsTeamAliases      []string `mapstructure:"results_team_aliases"`    // 数据源队名到赛程队名的映射，格式为 "数据源队名=赛程队名"
+	CalendarSecret          string   `mapstructure:"calendar_secret"`         // 日历订阅链接 token 的签名密钥，为空时不提供个人日历
+	AdminToken              string   `mapstructure:"admin_token"`             // 管理接口的 token，为空时拒绝所有管理请求
 }
@@ -0,0 +1,73 @@
+package types
+
+// 管理接口的请求和返回，管理接口需要在 X-Admin-Token 头里带上服务端配置的 admin_token
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminOperatorHeader 是管理工具自报的操作人，服务端不做验证，只用于审计日志和调整记录
+const AdminOperatorHeader = "X-Admin-Operator"
+
+type Tips struct {
+	TipsID        int    `json:"tips_id"`
+	Content       string `json:"content"`
+	EnableDisplay bool   `json:"enable_display"`
+}
+
+type AddTipsRequest struct {
+	TipsList []Tips `json:"tips"`
+}
+
+type AddNewUserReq struct {
+	ChineseName string `json:"ch_name"`
+	EnglishName string `json:"en_name"`
+	Department  string `json:"department"` // 多个部门用分号分隔，可以为空
+}
+
+type GrantResetPassword struct {
+	ChineseName string `json:"ch_name"`
+	EnglishName string `json:"en_name"`
+}
+
+type UpdateRankReq struct {
+	EnableDisplayRank bool   `json:"enable_display_rank"`
+	SnapshotID        int    `json:"snapshot_id"` // 冻结在哪个快照上，0 表示展示实时排行榜
+	Metric            string `json:"metric"`
+}
+
+type VoidScheduleReq struct {
+	ScheduleID int `json:"schedule_id"`
+}
+
+type LeaderboardSnapshot struct {
+	SnapshotID int    `json:"snapshot_id"`
+	ScheduleID int    `json:"schedule_id"` // 触发快照的比赛，0 表示手动生成
+	CreatedAt  string `json:"created_at"`
+}
+
+// AdjustReason 是管理员调整余额的原因代码
+type AdjustReason string
+
+const (
+	AdjustSettlementFix AdjustReason = "settlement_fix" // 修正结算错误，算作投注输赢
+	AdjustCompensation  AdjustReason = "compensation"   // 故障补偿，只能加币
+	AdjustPrize         AdjustReason = "prize"          // 活动奖品，只能加币
+	AdjustPenalty       AdjustReason = "penalty"        // 违规扣除，只能扣币
+	AdjustOther         AdjustReason = "other"          // 其他原因，必须写备注
+)
+
+var AdjustReasons = []AdjustReason{AdjustSettlementFix, AdjustCompensation, AdjustPrize, AdjustPenalty, AdjustOther}
+
+// 调整余额关联的对象，ref_type 为空表示不关联
+const (
+	AdjustRefSchedule   = "schedule"    // 比赛，或者用户在这场比赛上的投注
+	AdjustRefFuturesBet = "futures_bet" // 长线竞猜的一笔投注
+)
+
+type AdjustBalanceReq struct {
+	RequestID string       `json:"request_id"` // 客户端生成，重试时保持不变，同一个 request_id 只调整一次
+	UserID    int          `json:"user_id"`
+	Amount    Money        `json:"amount"` // 正数为加币，负数为扣币
+	Reason    AdjustReason `json:"reason"`
+	Note      string       `json:"note"`
+	RefType   string       `json:"ref_type"`
+	RefID     int          `json:"ref_id"`
+}
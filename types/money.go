@@ -0,0 +1,194 @@
+package types
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money 是以“分”为单位的整数金额，1 金币 = 100 分。
+// 数据库中存 BIGINT，JSON 中仍然是带两位小数的数字，例如 5000.5 金币为 5000.50
+type Money int64
+
+// Odds 是以千分之一为单位的整数赔率，表示每投注一个金币的净收益。
+// 数据库中存 INT，JSON 中是带三位小数的数字，例如 2.345
+type Odds int64
+
+const (
+	moneyScale = 2
+	oddsScale  = 3
+
+	Cent Money = 1
+	Coin Money = 100
+
+	OddsUnit = 1000
+)
+
+var errIllegalFixedPoint = errors.New("illegal fixed point number")
+
+// Coins 把配置中以金币为单位的整数转换成 Money
+func Coins(n int) Money {
+	return Money(n) * Coin
+}
+
+// MulOdds 计算按赔率 o 赢得的净收益。
+// 全站唯一的取整规则：精确计算后按四舍五入（0.5 远离零）取整到分
+func (m Money) MulOdds(o Odds) Money {
+	return Money(RoundDiv(int64(m)*int64(o), OddsUnit))
+}
+
+// RoundDiv 计算 a / b，按四舍五入（0.5 远离零）取整
+func RoundDiv(a, b int64) int64 {
+	q, r := a/b, a%b
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func (m Money) String() string {
+	return formatFixed(int64(m), moneyScale)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	v, err := parseFixed(strings.Trim(string(b), `"`), moneyScale)
+	if err != nil {
+		return err
+	}
+	*m = Money(v)
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	v, err := scanInt64(src)
+	if err != nil {
+		return err
+	}
+	*m = Money(v)
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+func (o Odds) String() string {
+	return formatFixed(int64(o), oddsScale)
+}
+
+func (o Odds) MarshalJSON() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *Odds) UnmarshalJSON(b []byte) error {
+	v, err := parseFixed(strings.Trim(string(b), `"`), oddsScale)
+	if err != nil {
+		return err
+	}
+	*o = Odds(v)
+	return nil
+}
+
+func (o *Odds) Scan(src interface{}) error {
+	v, err := scanInt64(src)
+	if err != nil {
+		return err
+	}
+	*o = Odds(v)
+	return nil
+}
+
+func (o Odds) Value() (driver.Value, error) {
+	return int64(o), nil
+}
+
+// formatFixed 把定点整数格式化成小数，例如 formatFixed(-5, 2) == "-0.05"
+func formatFixed(v int64, scale int) string {
+	sign := ""
+	u := uint64(v)
+	if v < 0 {
+		sign = "-"
+		u = uint64(-v)
+	}
+	unit := uint64(1)
+	for i := 0; i < scale; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, u/unit, scale, u%unit)
+}
+
+// parseFixed 精确解析十进制小数，小数位数超过 scale 视为非法，不做任何舍入
+func parseFixed(s string, scale int) (int64, error) {
+	if s == "" {
+		return 0, errIllegalFixedPoint
+	}
+	neg := false
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	// 只允许开头一个符号，剩下的必须都是数字，否则 strconv.ParseInt 会再接受一个符号
+	if intPart == "" || len(fracPart) > scale || !allDigits(intPart) || !allDigits(fracPart) {
+		return 0, errIllegalFixedPoint
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+	v, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, errIllegalFixedPoint
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MySQL 的 SUM() 等聚合结果会以 DECIMAL 文本返回
+func scanInt64(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case []byte:
+		return parseDecimalInt(string(v))
+	case string:
+		return parseDecimalInt(v)
+	}
+	return 0, fmt.Errorf("cannot scan %T into fixed point number", src)
+}
+
+func parseDecimalInt(s string) (int64, error) {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		if strings.Trim(s[i+1:], "0") != "" {
+			return 0, fmt.Errorf("%v is not an integer", s)
+		}
+		s = s[:i]
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,164 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		ok   bool
+	}{
+		{"5", 500, true},
+		{"5.5", 550, true},
+		{"5.50", 550, true},
+		{"5.", 500, true},
+		{"-0.05", -5, true},
+		{"+1.23", 123, true},
+		{`"12.30"`, 1230, true},
+		{"0", 0, true},
+		{"92233720368547758.07", 9223372036854775807, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"--5", 0, false},
+		{"-+5", 0, false},
+		{"+-5", 0, false},
+		{"1.-5", 0, false},
+		{"1.+5", 0, false},
+		{"1.234", 0, false},
+		{".5", 0, false},
+		{"1e3", 0, false},
+		{" 5", 0, false},
+		{"abc", 0, false},
+		{"92233720368547758.08", 0, false},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.UnmarshalJSON([]byte(tt.in))
+		if (err == nil) != tt.ok || (tt.ok && m != tt.want) {
+			t.Errorf("parse money %q = %v, %v, want %v, ok %v", tt.in, int64(m), err, int64(tt.want), tt.ok)
+		}
+	}
+}
+
+func TestParseOdds(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Odds
+		ok   bool
+	}{
+		{"2.345", 2345, true},
+		{"2", 2000, true},
+		{"0.001", 1, true},
+		{"2.3456", 0, false},
+		{"--2", 0, false},
+	}
+	for _, tt := range tests {
+		var o Odds
+		err := o.UnmarshalJSON([]byte(tt.in))
+		if (err == nil) != tt.ok || (tt.ok && o != tt.want) {
+			t.Errorf("parse odds %q = %v, %v, want %v, ok %v", tt.in, int64(o), err, int64(tt.want), tt.ok)
+		}
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	type bet struct {
+		Money Money `json:"money"`
+		Odds  Odds  `json:"odds"`
+	}
+	tests := []struct {
+		in   bet
+		want string
+	}{
+		{bet{500050, 2345}, `{"money":5000.50,"odds":2.345}`},
+		{bet{-5, 1}, `{"money":-0.05,"odds":0.001}`},
+		{bet{0, 0}, `{"money":0.00,"odds":0.000}`},
+		{bet{-123456, 10000}, `{"money":-1234.56,"odds":10.000}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.in)
+		if err != nil || string(b) != tt.want {
+			t.Errorf("json.Marshal(%+v) = %s, %v, want %s", tt.in, b, err, tt.want)
+			continue
+		}
+		var back bet
+		if err := json.Unmarshal(b, &back); err != nil || back != tt.in {
+			t.Errorf("json.Unmarshal(%s) = %+v, %v, want %+v", b, back, err, tt.in)
+		}
+	}
+}
+
+// MySQL 的 SUM() 返回 DECIMAL 文本，整数部分之外只能是 0
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+		ok   bool
+	}{
+		{int64(1234), 1234, true},
+		{nil, 0, true},
+		{[]byte("1234"), 1234, true},
+		{[]byte("-1234.0000"), -1234, true},
+		{"98765", 98765, true},
+		{[]byte("12.50"), 0, false},
+		{[]byte("abc"), 0, false},
+		{float64(12), 0, false},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.Scan(tt.src)
+		if (err == nil) != tt.ok || (tt.ok && m != tt.want) {
+			t.Errorf("Scan(%#v) = %v, %v, want %v, ok %v", tt.src, int64(m), err, int64(tt.want), tt.ok)
+		}
+	}
+}
+
+func TestRoundDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{6, 2, 3},
+		{5, 2, 3},
+		{-5, 2, -3},
+		{7, 2, 4},
+		{-7, 2, -4},
+		{1, 2, 1},
+		{-1, 2, -1},
+		{1, 3, 0},
+		{-1, 3, 0},
+		{5, 3, 2},
+		{-5, 3, -2},
+		{4, 3, 1},
+		{1499, 1000, 1},
+		{1500, 1000, 2},
+		{-1500, 1000, -2},
+	}
+	for _, tt := range tests {
+		if got := RoundDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("RoundDiv(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMulOdds(t *testing.T) {
+	tests := []struct {
+		m    Money
+		o    Odds
+		want Money
+	}{
+		{100, 2345, 235}, // 234.5 分，0.5 远离零
+		{-100, 2345, -235},
+		{333, 1500, 500}, // 499.5 分
+		{333, 1499, 499}, // 499.167 分
+		{1, 1, 0},
+		{Coins(100), 2000, Coins(200)},
+	}
+	for _, tt := range tests {
+		if got := tt.m.MulOdds(tt.o); got != tt.want {
+			t.Errorf("%v.MulOdds(%v) = %v, want %v", tt.m, tt.o, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package types 定义服务端和管理工具共用的类型：赛程、金额、赔率以及管理接口的请求
+package types
+
+type ScheduleType int
+
+const (
+	GroupMatches       ScheduleType = iota // 小组赛
+	RoundEight                             // 八强赛
+	FinalFour                              // 四强赛
+	Semifinal                              // 半决赛
+	MatchForThirdPlace                     // 季军赛
+	Finals                                 // 总决赛
+	All
+)
+
+type ScheduleStatus int
+
+const (
+	NotStarted  ScheduleStatus = iota // 未开始
+	HomeTeamWin                       // 主队胜利
+	AwayTeamWin                       // 客队胜利
+	Draw                              // 平局
+	Voided                            // 比赛取消，所有投注退还本金
+)
+
+type BetStatus int
+
+const (
+	BetNotFinish = 0
+	WinBet       = 1
+	LostBet      = 2
+	RefundBet    = 3 // 奖池模式下无人猜中或者比赛取消，退还本金
+)
+
+type BettingMode int
+
+const (
+	FixedOddsBetting BettingMode = 0 // 固定赔率
+	PoolBetting      BettingMode = 1 // 奖池（彩池）模式，赢家按投注比例瓜分奖池
+)
+
+// 每个 Schedule 代表一场世界杯赛事
+type Schedule struct {
+	ScheduleID      int            `json:"schedule_id"`        // 赛事 ID，用以唯一标识每场比赛
+	HomeTeam        string         `json:"home_team"`          // 主队
+	AwayTeam        string         `json:"away_team"`          // 客队
+	HomeTeamWinOdds Odds           `json:"home_team_win_odds"` // 主队胜利的赔率
+	AwayTeamWinOdds Odds           `json:"away_team_win_odds"` // 客队胜利的赔率
+	TiedOdds        Odds           `json:"tied_odds"`          // 平局的赔率
+	ScheduleTime    string         `json:"schedule_time"`      // 比赛时间
+	ScheduleGroup   string         `json:"schedule_group"`     // 比赛组别
+	ScheduleType    ScheduleType   `json:"schedule_type"`      // 比赛类别
+	ScheduleStatus  ScheduleStatus `json:"schedule_status"`    // 比赛状态
+	DisableBetting  bool           `json:"disable_betting"`    // 是否允许投注
+	EnableDisplay   bool           `json:"enable_dispaly"`     // 是否显示在投注页
+	BettingMode     BettingMode    `json:"betting_mode"`       // 投注模式
+	HomeScore       *int           `json:"home_score"`         // 主队进球，比赛结束后公布
+	AwayScore       *int           `json:"away_score"`         // 客队进球，比赛结束后公布
+}
+
+type Schedule2 struct {
+	ScheduleID      int            `json:"schedule_id"`               // 赛事 ID，用以唯一标识每场比赛
+	HomeTeam        int            `json:"home_team"`                 // 主队
+	AwayTeam        int            `json:"away_team"`                 // 客队
+	HomeTeamWinOdds Odds           `json:"home_team_win_odds"`        // 主队胜利的赔率
+	AwayTeamWinOdds Odds           `json:"away_team_win_odds"`        // 客队胜利的赔率
+	TiedOdds        Odds           `json:"tied_odds"`                 // 平局的赔率
+	ScheduleTime    string         `json:"schedule_time"`             // 比赛时间
+	ScheduleGroup   string         `json:"schedule_group"`            // 比赛组别
+	ScheduleType    ScheduleType   `json:"schedule_type"`             // 比赛类别
+	ScheduleStatus  ScheduleStatus `json:"schedule_status,omitempty"` // 比赛状态
+	DisableBetting  bool           `json:"disable_betting"`           // 是否允许投注
+	EnableDisplay   bool           `json:"enable_dispaly"`            // 是否显示在投注页
+	BettingMode     BettingMode    `json:"betting_mode"`              // 投注模式
+	Pool            *PoolInfo      `json:"pool,omitempty"`            // 奖池模式下当前奖池的情况
+	HomeScore       *int           `json:"home_score,omitempty"`      // 主队进球
+	AwayScore       *int           `json:"away_score,omitempty"`      // 客队进球
+}
+
+// 奖池模式下某场比赛的实时奖池
+type PoolInfo struct {
+	TotalStake       Money   `json:"total_stake"`         // 奖池总额
+	HomeTeamWinStake Money   `json:"home_team_win_stake"` // 投注主队胜利的总额
+	AwayTeamWinStake Money   `json:"away_team_win_stake"` // 投注客队胜利的总额
+	TiedStake        Money   `json:"tied_stake"`          // 投注平局的总额
+	HouseCut         float64 `json:"house_cut"`           // 抽水比例（百分比）
+}
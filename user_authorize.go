@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/subtle"
+	"database/sql"
 	"encoding/csv"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -39,7 +42,7 @@ func readUserFile(original string, newUser string) {
 		}
 
 		if len(record) != 0 {
-			timiUserWhiteList[record[2]] = record[1]
+			setWhiteListUser(record[2], record[1], parseDepartments(record[0]))
 		}
 	}
 
@@ -53,12 +56,52 @@ func readUserFile(original string, newUser string) {
 		}
 
 		if len(record) != 0 {
-			timiUserWhiteList[record[2]] = record[1]
+			setWhiteListUser(record[2], record[1], parseDepartments(record[0]))
 		}
 	}
 }
 
+var errIncorrectPassword = errors.New("incorrect password")
+
+// checkUserCredential 用和 /authorize 一样的中英文名和密码确认请求的是用户本人，返回用户 ID。
+// 修改用户自己的设置之类的接口用它，不能只凭 user_id
+func checkUserCredential(req AuthorizeRequest) (int, error) {
+	var (
+		userID   int
+		password string
+	)
+	err := db.QueryRow("SELECT user_id, password FROM user WHERE chinese_name = ? and rtx_name = ?",
+		req.ChineseName, req.EnglishName).Scan(&userID, &password)
+	if err == sql.ErrNoRows {
+		return 0, errUserNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+	if password == "" || subtle.ConstantTimeCompare([]byte(password), []byte(req.Password)) != 1 {
+		return 0, errIncorrectPassword
+	}
+	return userID, nil
+}
+
+// 白名单在登陆和添加白名单时都会读写，需要加锁，姓名和部门一起更新
+func setWhiteListUser(englishName, chineseName string, departments []string) {
+	timiUserWhiteListMu.Lock()
+	defer timiUserWhiteListMu.Unlock()
+	timiUserWhiteList[englishName] = chineseName
+	timiUserGroups[englishName] = departments
+}
+
+func userDepartments(englishName string) ([]string, bool) {
+	timiUserWhiteListMu.RLock()
+	defer timiUserWhiteListMu.RUnlock()
+	departments, ok := timiUserGroups[englishName]
+	return departments, ok
+}
+
 func isIllegalUser(chineseName, englishName string) bool {
+	timiUserWhiteListMu.RLock()
+	defer timiUserWhiteListMu.RUnlock()
 	if name, isPresent := timiUserWhiteList[englishName]; isPresent {
 		if name == chineseName {
 			return true
@@ -67,9 +110,12 @@ func isIllegalUser(chineseName, englishName string) bool {
 	return false
 }
 
-func addNewUser(file *os.File, chineseName, englishName string) bool {
-	timiUserWhiteList[englishName] = chineseName
-	record := []string{"X", chineseName, englishName}
+func addNewUser(file *os.File, chineseName, englishName, department string) bool {
+	setWhiteListUser(englishName, chineseName, parseDepartments(department))
+	if department == "" {
+		department = "X"
+	}
+	record := []string{department, chineseName, englishName}
 	w := csv.NewWriter(file)
 	if err := w.Write(record); err != nil {
 		handleError(err)
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对外的 webhook：管理员登记 URL 和密钥，事件发生时把事件 JSON POST 过去，
+// 请求头里带 HMAC-SHA256 签名。每次投递都记在 webhook_delivery 表里，失败按指数退避重试，
+// 超过重试次数后标记为失败，可以通过 /replay_webhook 重新投递
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+const (
+	defaultWebhookMaxAttempts  = 6
+	defaultWebhookRetrySeconds = 30
+	maxWebhookRetryDelay       = time.Hour
+	webhookCheckInterval       = 10 * time.Second
+	webhookTimeout             = 10 * time.Second
+	webhookDeliveryBatch       = 100
+	maxWebhookResponseLog      = 512  // 投递日志里最多保存多少字节的响应内容
+	maxWebhookErrorLength      = 1024 // last_error 字段的长度
+)
+
+// 可以订阅的事件，webhook 不指定事件类型时订阅全部
+var webhookEventTypes = []string{EventScheduleCreated, EventBettingClosed, EventScheduleSettled, EventScheduleVoided,
+	EventLeaderboardSnapshot}
+
+type Webhook struct {
+	WebhookID  int      `json:"webhook_id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Enabled    bool     `json:"enabled"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	WebhookID  int      `json:"webhook_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID    int                   `json:"delivery_id"`
+	WebhookID     int                   `json:"webhook_id"`
+	EventID       int64                 `json:"event_id"`
+	EventType     string                `json:"event_type"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	ResponseCode  int                   `json:"response_code"`
+	LastError     string                `json:"last_error"`
+	NextAttemptAt string                `json:"next_attempt_at"`
+	CreatedAt     string                `json:"created_at"`
+	DeliveredAt   *string               `json:"delivered_at"`
+}
+
+// delivery_id 指定重放一条投递；只传 webhook_id 时重放这个 webhook 所有失败的投递
+type ReplayWebhookRequest struct {
+	DeliveryID int `json:"delivery_id"`
+	WebhookID  int `json:"webhook_id"`
+}
+
+func webhookMaxAttempts() int {
+	if config.WebhookMaxAttempts > 0 {
+		return config.WebhookMaxAttempts
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// webhookRetryDelay 第 attempts 次失败之后等待多久再重试，每次翻倍，最多一小时
+func webhookRetryDelay(attempts int) time.Duration {
+	base := time.Duration(defaultWebhookRetrySeconds) * time.Second
+	if config.WebhookRetrySeconds > 0 {
+		base = time.Duration(config.WebhookRetrySeconds) * time.Second
+	}
+	delay := base
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+	return delay
+}
+
+// signWebhook 签名的内容是“时间戳.请求体”，接收方用同一个密钥计算后比较，并检查时间戳防止重放
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validWebhookEventTypes(types []string) bool {
+	for _, t := range types {
+		known := false
+		for _, e := range webhookEventTypes {
+			if t == e {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func joinEventTypes(types []string) string {
+	return strings.Join(types, ",")
+}
+
+func splitEventTypes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func subscribesTo(eventTypes string, eventType string) bool {
+	if eventTypes == "" {
+		return true
+	}
+	for _, t := range strings.Split(eventTypes, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueWebhookEvent 给订阅了这个事件的每个 webhook 记一条待投递的记录，
+// 请求体在这时就确定下来，重试和重放发送的内容完全一样
+func enqueueWebhookEvent(event Event, now time.Time) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query("SELECT webhook_id, event_types FROM webhook WHERE enabled = ?", true)
+	if err != nil {
+		return err
+	}
+	var webhookIDs []int
+	for rows.Next() {
+		var (
+			id         int
+			eventTypes string
+		)
+		if err := rows.Scan(&id, &eventTypes); err != nil {
+			rows.Close()
+			return err
+		}
+		if subscribesTo(eventTypes, event.Type) {
+			webhookIDs = append(webhookIDs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range webhookIDs {
+		_, err := db.Exec("INSERT INTO webhook_delivery(webhook_id, event_id, event_type, payload, status, attempts, "+
+			"response_code, last_error, next_attempt_at, created_at) VALUES (?,?,?,?,?,0,0,'',?,?)",
+			id, event.ID, event.Type, string(body), DeliveryPending, toDBTime(now), toDBTime(now))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pendingDelivery struct {
+	DeliveryID int
+	EventType  string
+	Payload    string
+	Attempts   int
+	URL        string
+	Secret     string
+}
+
+var (
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+	webhookKick   = make(chan struct{}, 1) // 有新的待投递记录时通知投递协程
+)
+
+func kickWebhookDelivery() {
+	select {
+	case webhookKick <- struct{}{}:
+	default:
+	}
+}
+
+// truncateUTF8 截断到 n 个字节以内，不截断在多字节字符中间
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// sendWebhook 发送一次请求，返回响应码和错误描述，2xx 以外都算失败
+func sendWebhook(d pendingDelivery, now time.Time) (int, string) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "worldcup-betting-webhook")
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.DeliveryID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhook(d.Secret, timestamp, body))
+
+	rsp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, truncateUTF8(err.Error(), maxWebhookErrorLength)
+	}
+	defer rsp.Body.Close()
+	content, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, maxWebhookResponseLog))
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.StatusCode, truncateUTF8(fmt.Sprintf("unexpected status %v: %s", rsp.StatusCode, content),
+			maxWebhookErrorLength)
+	}
+	return rsp.StatusCode, ""
+}
+
+// 每个 webhook 同时只有一个协程在投递，按顺序发送；不同的 webhook 互不影响，
+// 一个接收方很慢或者连不上时不会拖住其他 webhook
+var webhookBusy = struct {
+	sync.Mutex
+	ids map[int]bool
+}{ids: make(map[int]bool)}
+
+func startWebhookDelivery(webhookID int) bool {
+	webhookBusy.Lock()
+	defer webhookBusy.Unlock()
+	if webhookBusy.ids[webhookID] {
+		return false
+	}
+	webhookBusy.ids[webhookID] = true
+	return true
+}
+
+func finishWebhookDelivery(webhookID int) {
+	webhookBusy.Lock()
+	defer webhookBusy.Unlock()
+	delete(webhookBusy.ids, webhookID)
+}
+
+// deliverDueWebhooks 找出有到了重试时间的记录的 webhook，每个 webhook 在自己的协程里投递
+func deliverDueWebhooks(now time.Time) error {
+	rows, err := db.Query("SELECT DISTINCT d.webhook_id FROM webhook_delivery d JOIN webhook w ON w.webhook_id = d.webhook_id "+
+		"WHERE d.status = ? and d.next_attempt_at <= ? and w.enabled = ?", DeliveryPending, toDBTime(now), true)
+	if err != nil {
+		return err
+	}
+	var webhookIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		webhookIDs = append(webhookIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range webhookIDs {
+		if !startWebhookDelivery(id) {
+			continue
+		}
+		go func(webhookID int) {
+			defer finishWebhookDelivery(webhookID)
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Fprintf(os.Stderr, "deliver webhook %v panic: %v\n", webhookID, r)
+				}
+			}()
+			if err := deliverWebhook(webhookID, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "deliver webhook %v failed, err: %v\n", webhookID, err)
+			}
+		}(id)
+	}
+	return nil
+}
+
+// deliverWebhook 按顺序投递一个 webhook 到了重试时间的记录
+func deliverWebhook(webhookID int, now time.Time) error {
+	rows, err := db.Query("SELECT d.delivery_id, d.event_type, d.payload, d.attempts, w.url, w.secret "+
+		"FROM webhook_delivery d JOIN webhook w ON w.webhook_id = d.webhook_id "+
+		"WHERE d.webhook_id = ? and d.status = ? and d.next_attempt_at <= ? and w.enabled = ? ORDER BY d.delivery_id LIMIT ?",
+		webhookID, DeliveryPending, toDBTime(now), true, webhookDeliveryBatch)
+	if err != nil {
+		return err
+	}
+	var deliveries []pendingDelivery
+	for rows.Next() {
+		var d pendingDelivery
+		if err := rows.Scan(&d.DeliveryID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			rows.Close()
+			return err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		sentAt := time.Now()
+		code, errDesc := sendWebhook(d, sentAt)
+		attempts := d.Attempts + 1
+		if errDesc == "" {
+			_, err = db.Exec("UPDATE webhook_delivery SET status = ?, attempts = ?, response_code = ?, last_error = '', "+
+				"delivered_at = ? WHERE delivery_id = ?", DeliverySucceeded, attempts, code, toDBTime(sentAt), d.DeliveryID)
+		} else {
+			status := DeliveryPending
+			if attempts >= webhookMaxAttempts() {
+				status = DeliveryFailed
+			}
+			fmt.Fprintf(os.Stderr, "deliver webhook %v to %v failed, attempts: %v, err: %v\n",
+				d.DeliveryID, d.URL, attempts, errDesc)
+			_, err = db.Exec("UPDATE webhook_delivery SET status = ?, attempts = ?, response_code = ?, last_error = ?, "+
+				"next_attempt_at = ? WHERE delivery_id = ?", status, attempts, code, errDesc,
+				toDBTime(sentAt.Add(webhookRetryDelay(attempts))), d.DeliveryID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runWebhookWorker 订阅事件写入投递记录，真正的 HTTP 请求在单独的协程里发送，
+// 接收方很慢的时候也不会阻塞事件总线。订阅用的是不丢事件的队列，写入投递记录之前事件不会丢
+func runWebhookWorker() {
+	_, events := bus.SubscribeQueue()
+	go runWebhookDelivery()
+	for event := range events {
+		if !validWebhookEventTypes([]string{event.Type}) {
+			continue
+		}
+		if err := enqueueWebhookEvent(event, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "enqueue webhook event %v failed, err: %v\n", event.ID, err)
+			continue
+		}
+		kickWebhookDelivery()
+	}
+}
+
+// runWebhookDelivery 定时检查需要重试的投递，有新事件时马上投递
+func runWebhookDelivery() {
+	deliver := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(os.Stderr, "deliver webhooks panic: %v\n", r)
+			}
+		}()
+		if err := deliverDueWebhooks(time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "deliver webhooks failed, err: %v\n", err)
+		}
+	}
+
+	ticker := time.NewTicker(webhookCheckInterval)
+	defer ticker.Stop()
+	for {
+		deliver()
+		select {
+		case <-ticker.C:
+		case <-webhookKick:
+		}
+	}
+}
+
+func handleWebhooks(c *gin.Context) {
+	rows, err := db.Query("SELECT webhook_id, url, event_types, enabled, created_at FROM webhook ORDER BY webhook_id")
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query webhooks failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var (
+			w          Webhook
+			eventTypes string
+		)
+		if err := rows.Scan(&w.WebhookID, &w.URL, &eventTypes, &w.Enabled, &w.CreatedAt); err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan webhook failed, err: %v\n", err)
+			return
+		}
+		w.EventTypes = splitEventTypes(eventTypes)
+		w.CreatedAt = formatAPITime(w.CreatedAt)
+		webhooks = append(webhooks, w)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"desc":        "OK",
+		"webhooks":    webhooks,
+		"event_types": webhookEventTypes,
+	})
+}
+
+func handleAddWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if c.Bind(&req) != nil || !validWebhookURL(req.URL) || req.Secret == "" || !validWebhookEventTypes(req.EventTypes) {
+		illegalParametersRsp(c)
+		return
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	result, err := db.Exec("INSERT INTO webhook(url, secret, event_types, enabled, created_at) VALUES (?,?,?,?,?)",
+		req.URL, req.Secret, joinEventTypes(req.EventTypes), enabled, toDBTime(time.Now()))
+	var webhookID int64
+	if err == nil {
+		webhookID, err = result.LastInsertId()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "insert webhook failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"webhook_id": webhookID,
+	})
+}
+
+// handleUpdateWebhook 只修改传了的字段，密钥为空时保留原来的
+func handleUpdateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if c.Bind(&req) != nil || (req.URL != "" && !validWebhookURL(req.URL)) ||
+		(req.EventTypes != nil && !validWebhookEventTypes(req.EventTypes)) {
+		illegalParametersRsp(c)
+		return
+	}
+
+	var (
+		webhookURL, secret, eventTypes string
+		enabled                        bool
+	)
+	err := db.QueryRow("SELECT url, secret, event_types, enabled FROM webhook WHERE webhook_id = ?", req.WebhookID).
+		Scan(&webhookURL, &secret, &eventTypes, &enabled)
+	if err == sql.ErrNoRows {
+		webhookNotExistRsp(c)
+		return
+	}
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query webhook failed, err: %v\n", err)
+		return
+	}
+	if req.URL != "" {
+		webhookURL = req.URL
+	}
+	if req.Secret != "" {
+		secret = req.Secret
+	}
+	if req.EventTypes != nil {
+		eventTypes = joinEventTypes(req.EventTypes)
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	_, err = db.Exec("UPDATE webhook SET url = ?, secret = ?, event_types = ?, enabled = ? WHERE webhook_id = ?",
+		webhookURL, secret, eventTypes, enabled, req.WebhookID)
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "update webhook failed, err: %v\n", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
+}
+
+// 删除 webhook 时投递记录一起删掉
+func handleDeleteWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if c.Bind(&req) != nil {
+		illegalParametersRsp(c)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "begin transaction failed, err: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("DELETE FROM webhook WHERE webhook_id = ?", req.WebhookID)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err == nil && affected > 0 {
+		if _, err = tx.Exec("DELETE FROM webhook_delivery WHERE webhook_id = ?", req.WebhookID); err == nil {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "delete webhook failed, err: %v\n", err)
+		return
+	}
+	if affected == 0 {
+		webhookNotExistRsp(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "desc": "OK"})
+}
+
+func handleWebhookDeliveries(c *gin.Context) {
+	webhookID, err := strconv.Atoi(c.Query("webhook_id"))
+	if err != nil {
+		illegalParametersRsp(c)
+		return
+	}
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		illegalParametersRsp(c)
+		return
+	}
+	query := "SELECT delivery_id, webhook_id, event_id, event_type, status, attempts, response_code, last_error, " +
+		"next_attempt_at, created_at, delivered_at FROM webhook_delivery WHERE webhook_id = ?"
+	args := []interface{}{webhookID}
+	if status := c.Query("status"); status != "" {
+		query += " and status = ?"
+		args = append(args, status)
+	}
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := db.Query(query+" ORDER BY delivery_id DESC LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		queryMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "query webhook deliveries failed, err: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.DeliveryID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			queryMySQLFailedRsp(c)
+			fmt.Fprintf(os.Stderr, "scan webhook delivery failed, err: %v\n", err)
+			return
+		}
+		d.NextAttemptAt = formatAPITime(d.NextAttemptAt)
+		d.CreatedAt = formatAPITime(d.CreatedAt)
+		if d.DeliveredAt != nil {
+			deliveredAt := formatAPITime(*d.DeliveredAt)
+			d.DeliveredAt = &deliveredAt
+		}
+		deliveries = append(deliveries, d)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"desc":       "OK",
+		"deliveries": deliveries,
+		"page":       page,
+		"page_size":  pageSize,
+	})
+}
+
+// handleReplayWebhook 把投递重新放回待投递队列，重试次数清零，然后马上投递一次
+func handleReplayWebhook(c *gin.Context) {
+	var req ReplayWebhookRequest
+	if c.Bind(&req) != nil || (req.DeliveryID == 0 && req.WebhookID == 0) {
+		illegalParametersRsp(c)
+		return
+	}
+
+	now := time.Now()
+	var (
+		result sql.Result
+		err    error
+	)
+	if req.DeliveryID != 0 {
+		result, err = db.Exec("UPDATE webhook_delivery SET status = ?, attempts = 0, next_attempt_at = ? "+
+			"WHERE delivery_id = ?", DeliveryPending, toDBTime(now), req.DeliveryID)
+	} else {
+		result, err = db.Exec("UPDATE webhook_delivery SET status = ?, attempts = 0, next_attempt_at = ? "+
+			"WHERE webhook_id = ? and status = ?", DeliveryPending, toDBTime(now), req.WebhookID, DeliveryFailed)
+	}
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err != nil {
+		operateMySQLFailedRsp(c)
+		fmt.Fprintf(os.Stderr, "replay webhook deliveries failed, err: %v\n", err)
+		return
+	}
+	if req.DeliveryID != 0 && affected == 0 {
+		webhookDeliveryNotExistRsp(c)
+		return
+	}
+
+	kickWebhookDelivery()
+	c.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"desc":     "OK",
+		"replayed": affected,
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/hmac"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		secret, timestamp, body string
+		want                    string
+	}{
+		{"test", "1528988400", `{"id":1}`, "sha256=3f589dfa84424df30a599c97327b3dc96f9e8759dddf947d32f96761c15619cb"},
+		{"s3cr3t", "0", "", "sha256=3f9088652f6bbbf5fb267427cb173addd3621d27558a0d18d24ec8285c15944c"},
+		{"密钥", "1700000000", `{"type":"schedule_settled"}`, "sha256=dae36f366c35697803b69814ef2a54a90b1fc3aeafeffcd5703fb1cf32aa4522"},
+	}
+	for _, tt := range tests {
+		if got := signWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("signWebhook(%q, %q, %q) = %v, want %v", tt.secret, tt.timestamp, tt.body, got, tt.want)
+		}
+	}
+}
+
+// 接收方按请求头里的时间戳和收到的请求体重新计算签名，内容或者密钥不对时对不上
+func TestSendWebhookVerify(t *testing.T) {
+	tests := []struct {
+		name           string
+		receiverSecret string
+		tamper         bool
+		want           bool
+	}{
+		{"same secret", "test", false, true},
+		{"wrong secret", "other", false, false},
+		{"tampered body", "test", true, false},
+	}
+	for _, tt := range tests {
+		var verified bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if tt.tamper {
+				body = append(body, ' ')
+			}
+			expected := signWebhook(tt.receiverSecret, r.Header.Get("X-Webhook-Timestamp"), body)
+			verified = hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Webhook-Signature")))
+		}))
+		d := pendingDelivery{DeliveryID: 1, EventType: EventScheduleSettled, Payload: `{"id":1}`, URL: server.URL, Secret: "test"}
+		code, errDesc := sendWebhook(d, time.Unix(1528988400, 0))
+		server.Close()
+		if code != http.StatusOK || errDesc != "" {
+			t.Errorf("%v: sendWebhook = %v, %q", tt.name, code, errDesc)
+		}
+		if verified != tt.want {
+			t.Errorf("%v: verified = %v, want %v", tt.name, verified, tt.want)
+		}
+	}
+}
+
+func TestSendWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	code, errDesc := sendWebhook(pendingDelivery{URL: server.URL, Payload: "{}"}, time.Now())
+	if code != http.StatusInternalServerError || errDesc == "" {
+		t.Errorf("sendWebhook = %v, %q, want 500 with error", code, errDesc)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	defer func(seconds int) { config.WebhookRetrySeconds = seconds }(config.WebhookRetrySeconds)
+
+	tests := []struct {
+		retrySeconds int
+		attempts     int
+		want         time.Duration
+	}{
+		{0, 1, 30 * time.Second},
+		{0, 2, time.Minute},
+		{0, 3, 2 * time.Minute},
+		{0, 6, 16 * time.Minute},
+		{0, 8, time.Hour},
+		{0, 100, time.Hour},
+		{10, 1, 10 * time.Second},
+		{10, 4, 80 * time.Second},
+		{7200, 1, time.Hour},
+	}
+	for _, tt := range tests {
+		config.WebhookRetrySeconds = tt.retrySeconds
+		if got := webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryDelay(%v) with retry seconds %v = %v, want %v", tt.attempts, tt.retrySeconds, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribesTo(t *testing.T) {
+	tests := []struct {
+		eventTypes, eventType string
+		want                  bool
+	}{
+		{"", EventScheduleSettled, true},
+		{EventScheduleSettled, EventScheduleSettled, true},
+		{EventScheduleCreated + "," + EventScheduleSettled, EventScheduleSettled, true},
+		{EventScheduleCreated, EventScheduleSettled, false},
+		{"schedule", EventScheduleSettled, false},
+	}
+	for _, tt := range tests {
+		if got := subscribesTo(tt.eventTypes, tt.eventType); got != tt.want {
+			t.Errorf("subscribesTo(%q, %q) = %v, want %v", tt.eventTypes, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"比赛结算", 7, "比赛"},
+		{"比赛结算", 6, "比赛"},
+		{"比赛结算", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %v) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}